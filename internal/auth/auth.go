@@ -0,0 +1,318 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/config"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token expired")
+)
+
+// signingMethod is the only algorithm accepted when verifying tokens
+var signingMethod = jwt.SigningMethodHS256
+
+const tokenTypeAccess = "access"
+
+// touchInterval limits how often a session's last-seen time is written
+const touchInterval = time.Minute
+
+// Claims carried by an access token. Subject is the user ID. Tokens are
+// revoked by session (sid), which rejects every token issued for it; the jti
+// only tells tokens apart and is not checked.
+type Claims struct {
+	Type      string `json:"typ"`
+	SessionID string `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// UserID returns the subject as a UUID
+func (c *Claims) UserID() (uuid.UUID, error) {
+	return uuid.Parse(c.Subject)
+}
+
+// Session returns the sid claim as a UUID
+func (c *Claims) Session() (uuid.UUID, error) {
+	return uuid.Parse(c.SessionID)
+}
+
+// ClientInfo describes the device a session was opened from
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
+// TokenPair is returned by Login and /token/refresh
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"` // access token lifetime in seconds
+}
+
+// Service is the single place that issues and verifies tokens
+type Service struct {
+	secret     []byte
+	issuer     string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	tokens     store.RefreshTokenStore
+	sessions   store.SessionStore
+}
+
+func NewService(cfg config.JWTConfig, tokens store.RefreshTokenStore, sessions store.SessionStore) *Service {
+	return &Service{
+		secret:     []byte(cfg.Secret),
+		issuer:     cfg.Issuer,
+		accessTTL:  cfg.AccessTTL,
+		refreshTTL: cfg.RefreshTTL,
+		tokens:     tokens,
+		sessions:   sessions,
+	}
+}
+
+// Login opens a new session, which also starts its refresh token family
+func (s *Service) Login(userID uuid.UUID, client ClientInfo) (*TokenPair, error) {
+	now := time.Now()
+	session := &models.Session{
+		ID:         uuid.New(),
+		UserID:     userID,
+		UserAgent:  truncate(client.UserAgent, 255),
+		IP:         client.IP,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(s.refreshTTL),
+		CreatedAt:  now,
+	}
+	if err := s.sessions.Create(session); err != nil {
+		return nil, err
+	}
+	return s.issue(userID, session.ID, nil)
+}
+
+// Logout revokes the session the access token belongs to, which rejects it
+// and every other token issued for that session
+func (s *Service) Logout(claims *Claims) error {
+	userID, err := claims.UserID()
+	if err != nil {
+		return ErrInvalidToken
+	}
+	sessionID, err := claims.Session()
+	if err != nil {
+		return ErrInvalidToken
+	}
+	return s.sessions.Revoke(userID, sessionID)
+}
+
+// Refresh exchanges a refresh token for a new pair. Each refresh token works
+// once; presenting a rotated one again revokes its whole family, since it
+// means the token was copied.
+func (s *Service) Refresh(refreshToken string, client ClientInfo) (*TokenPair, error) {
+	current, err := s.tokens.GetByHash(HashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	if current.RevokedAt != nil {
+		return nil, ErrInvalidToken
+	}
+	if current.UsedAt != nil {
+		if err := s.revokeFamily(current); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidToken
+	}
+	if time.Now().After(current.ExpiresAt) {
+		return nil, ErrExpiredToken
+	}
+
+	session, err := s.sessions.GetByID(current.FamilyID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	if !session.Active(time.Now()) {
+		return nil, ErrInvalidToken
+	}
+
+	pair, err := s.issue(current.UserID, current.FamilyID, current)
+	if errors.Is(err, store.ErrTokenUsed) {
+		// Lost a race against another refresh with the same token
+		if err := s.revokeFamily(current); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(s.refreshTTL)
+	if err := s.sessions.Touch(session.ID, client.IP, &expiresAt); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// revokeFamily ends the session a replayed refresh token belongs to
+func (s *Service) revokeFamily(token *models.RefreshToken) error {
+	err := s.sessions.Revoke(token.UserID, token.FamilyID)
+	if errors.Is(err, store.ErrNotFound) {
+		// Already revoked; make sure no token of the family survives
+		return s.tokens.RevokeFamily(token.FamilyID)
+	}
+	return err
+}
+
+// Authenticate verifies an access token and checks that its session has not
+// been revoked. This is what RequireAuth runs on every request. Revoking the
+// session stands in for revoking single tokens by jti: logout and session
+// revocation end every token of the session at once, so no per-token list
+// is kept.
+func (s *Service) Authenticate(tokenString, ip string) (*Claims, error) {
+	claims, err := s.ParseAccessToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionID, err := claims.Session()
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	session, err := s.sessions.GetByID(sessionID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if !session.Active(now) || session.UserID.String() != claims.Subject {
+		return nil, ErrInvalidToken
+	}
+
+	if now.Sub(session.LastSeenAt) > touchInterval {
+		if err := s.sessions.Touch(session.ID, ip, nil); err != nil {
+			return nil, err
+		}
+	}
+	return claims, nil
+}
+
+// ParseAccessToken verifies signature, algorithm, issuer and expiry
+func (s *Service) ParseAccessToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		return s.secret, nil
+	},
+		jwt.WithValidMethods([]string{signingMethod.Alg()}),
+		jwt.WithIssuer(s.issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrExpiredToken
+		}
+		return nil, ErrInvalidToken
+	}
+
+	if claims.Type != tokenTypeAccess {
+		return nil, ErrInvalidToken
+	}
+	if _, err := claims.UserID(); err != nil {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// issue signs an access token for the session and stores a fresh refresh
+// token in its family. When previous is set it is rotated out atomically.
+func (s *Service) issue(userID, sessionID uuid.UUID, previous *models.RefreshToken) (*TokenPair, error) {
+	now := time.Now()
+
+	claims := Claims{
+		Type:      tokenTypeAccess,
+		SessionID: sessionID.String(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   userID.String(),
+			Issuer:    s.issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.accessTTL)),
+		},
+	}
+	accessToken, err := jwt.NewWithClaims(signingMethod, claims).SignedString(s.secret)
+	if err != nil {
+		return nil, fmt.Errorf("sign access token: %w", err)
+	}
+
+	refreshToken, refreshHash, err := NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	next := &models.RefreshToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		FamilyID:  sessionID,
+		TokenHash: refreshHash,
+		ExpiresAt: now.Add(s.refreshTTL),
+		CreatedAt: now,
+	}
+
+	if previous != nil {
+		err = s.tokens.Rotate(previous, next)
+	} else {
+		err = s.tokens.Create(next)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.accessTTL.Seconds()),
+	}, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// NewOpaqueToken returns a random URL-safe token for the client and the hash
+// to persist in its place
+func NewOpaqueToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("generate token: %w", err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken is what gets persisted, so a database leak exposes no usable tokens
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/config"
+	db "github.com/am4rknvl/local-micro-blogging-service.git/internal/database"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+	"github.com/google/uuid"
+	"gorm.io/gorm/logger"
+)
+
+// newTestService returns a service over a fresh in-memory SQLite store and a
+// user to log in as
+func newTestService(t *testing.T) (*Service, uuid.UUID) {
+	t.Helper()
+	conn, err := db.Open(config.DatabaseConfig{
+		Driver:       db.DriverSQLite,
+		DSN:          "file:" + t.Name() + "?mode=memory&cache=shared",
+		MaxOpenConns: 1,
+		MaxIdleConns: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Logger = logger.Discard
+	t.Cleanup(func() {
+		if sqlDB, err := conn.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	s := store.New(conn)
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	user := models.User{ID: uuid.New(), Username: "alice", Email: "alice@example.com", EmailVerified: true}
+	if err := s.Users.Create(&user); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Default().JWT
+	cfg.Secret = "test secret"
+	return NewService(cfg, s.RefreshTokens, s.Sessions), user.ID
+}
+
+func TestRefreshRotation(t *testing.T) {
+	svc, userID := newTestService(t)
+	client := ClientInfo{UserAgent: "test", IP: "127.0.0.1"}
+
+	first, err := svc.Login(userID, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := svc.Refresh(first.RefreshToken, client)
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("refresh returned the same refresh token")
+	}
+	if _, err := svc.Authenticate(second.AccessToken, client.IP); err != nil {
+		t.Fatalf("rotated access token: %v", err)
+	}
+	third, err := svc.Refresh(second.RefreshToken, client)
+	if err != nil {
+		t.Fatalf("refresh of the rotated token: %v", err)
+	}
+
+	// Replaying a used token means it was copied: the whole family goes
+	if _, err := svc.Refresh(first.RefreshToken, client); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("replayed refresh token: err %v, want %v", err, ErrInvalidToken)
+	}
+	if _, err := svc.Refresh(third.RefreshToken, client); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("newest refresh token after a replay: err %v, want %v", err, ErrInvalidToken)
+	}
+	if _, err := svc.Authenticate(third.AccessToken, client.IP); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("access token after a replay: err %v, want %v", err, ErrInvalidToken)
+	}
+
+	// Other sessions of the user are not affected
+	other, err := svc.Login(userID, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Refresh(other.RefreshToken, client); err != nil {
+		t.Errorf("refresh in another session: %v", err)
+	}
+}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	svc, userID := newTestService(t)
+	client := ClientInfo{UserAgent: "test", IP: "127.0.0.1"}
+
+	pair, err := svc.Login(userID, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := svc.Authenticate(pair.AccessToken, client.IP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Logout(claims); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.Authenticate(pair.AccessToken, client.IP); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("access token after logout: err %v, want %v", err, ErrInvalidToken)
+	}
+	if _, err := svc.Refresh(pair.RefreshToken, client); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("refresh token after logout: err %v, want %v", err, ErrInvalidToken)
+	}
+}
@@ -1,3 +1,486 @@
 package config
 
-var JwtSecret = []byte("azsxdrcftuyihjjnbhvfcdsw") // Replace with a strong secret in production
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v2"
+)
+
+type Config struct {
+	Server        ServerConfig        `yaml:"server"`
+	Database      DatabaseConfig      `yaml:"database"`
+	JWT           JWTConfig           `yaml:"jwt"`
+	PasswordReset PasswordResetConfig `yaml:"password_reset"`
+	Verification  VerificationConfig  `yaml:"verification"`
+	Mail          MailConfig          `yaml:"mail"`
+	Messages      MessageConfig       `yaml:"messages"`
+	Timeline      TimelineConfig      `yaml:"timeline"`
+	Comments      CommentsConfig      `yaml:"comments"`
+	Search        SearchConfig        `yaml:"search"`
+	Admin         AdminConfig         `yaml:"admin"`
+	Deletion      DeletionConfig      `yaml:"deletion"`
+	Jobs          JobsConfig          `yaml:"jobs"`
+}
+
+type ServerConfig struct {
+	ListenAddr string `yaml:"listen_addr"`
+	// PublicURL is the externally reachable base URL used in emailed links
+	PublicURL string `yaml:"public_url"`
+	UploadDir string `yaml:"upload_dir"`
+}
+
+type DatabaseConfig struct {
+	Driver          string        `yaml:"driver"` // postgres or sqlite
+	DSN             string        `yaml:"dsn"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+}
+
+type JWTConfig struct {
+	Secret     string        `yaml:"secret"`
+	Issuer     string        `yaml:"issuer"`
+	AccessTTL  time.Duration `yaml:"access_ttl"`
+	RefreshTTL time.Duration `yaml:"refresh_ttl"`
+}
+
+type PasswordResetConfig struct {
+	TokenTTL time.Duration `yaml:"token_ttl"`
+	// At most MaxRequests reset emails per address within Window
+	MaxRequests int           `yaml:"max_requests"`
+	Window      time.Duration `yaml:"window"`
+}
+
+// Policies for accounts whose email is not verified yet
+const (
+	UnverifiedAllow    = "allow"     // full access
+	UnverifiedReadOnly = "read_only" // may read but not create or change anything
+	UnverifiedBlock    = "block"     // no authenticated access besides verifying
+)
+
+type VerificationConfig struct {
+	TokenTTL         time.Duration `yaml:"token_ttl"`
+	UnverifiedPolicy string        `yaml:"unverified_policy"`
+	// At most MaxResends verification emails per user within Window
+	MaxResends int           `yaml:"max_resends"`
+	Window     time.Duration `yaml:"window"`
+}
+
+type MailConfig struct {
+	Driver       string `yaml:"driver"` // smtp or log
+	From         string `yaml:"from"`
+	SMTPHost     string `yaml:"smtp_host"`
+	SMTPPort     int    `yaml:"smtp_port"`
+	SMTPUsername string `yaml:"smtp_username"`
+	SMTPPassword string `yaml:"smtp_password"`
+	// OutboxDir is where the log driver also writes .eml files, if set
+	OutboxDir string `yaml:"outbox_dir"`
+}
+
+type MessageConfig struct {
+	// Unsaved messages older than Retention are removed every CleanupInterval
+	Retention       time.Duration `yaml:"retention"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval"`
+}
+
+type TimelineConfig struct {
+	// Accounts with at least FanoutThreshold followers are not pushed to
+	// follower timelines on write; their posts are pulled when read instead
+	FanoutThreshold int `yaml:"fanout_threshold"`
+	// BackfillLimit is how many recent posts a new follow copies in
+	BackfillLimit int `yaml:"backfill_limit"`
+}
+
+type CommentsConfig struct {
+	// MaxDepth is how deep replies may nest; top-level comments are depth 0
+	MaxDepth int `yaml:"max_depth"`
+}
+
+type SearchConfig struct {
+	// Engine is postgres (tsvector columns), memory (an in-process index
+	// built from the database) or auto, which picks postgres on the postgres
+	// driver and memory otherwise
+	Engine string `yaml:"engine"`
+}
+
+type AdminConfig struct {
+	// Email of an existing account promoted to admin at startup, so a fresh
+	// deployment has someone who can assign roles
+	Email string `yaml:"email"`
+}
+
+type DeletionConfig struct {
+	// Deleted posts, comments and accounts can be restored for GracePeriod,
+	// after which the purge job removes them for good
+	GracePeriod time.Duration `yaml:"grace_period"`
+}
+
+// JobsConfig holds the run interval of each background job
+type JobsConfig struct {
+	TokenCleanup time.Duration `yaml:"token_cleanup"`
+	Purge        time.Duration `yaml:"purge"`
+	// CounterRepair recomputes denormalized vote, comment, follow and post
+	// counts from their source tables
+	CounterRepair time.Duration `yaml:"counter_repair"`
+	Trending      time.Duration `yaml:"trending"`
+	// Digest emails waiting notifications; each user gets at most one
+	// daily digest, sooner only to deliver emails held by quiet hours
+	Digest time.Duration `yaml:"digest"`
+}
+
+// Default returns the settings used when nothing overrides them
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			ListenAddr: ":3000",
+			PublicURL:  "http://localhost:3000",
+			UploadDir:  "./uploads",
+		},
+		Database: DatabaseConfig{
+			Driver:          "postgres",
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+		},
+		JWT: JWTConfig{
+			Issuer:     "microblog",
+			AccessTTL:  15 * time.Minute,
+			RefreshTTL: 30 * 24 * time.Hour,
+		},
+		PasswordReset: PasswordResetConfig{
+			TokenTTL:    time.Hour,
+			MaxRequests: 3,
+			Window:      time.Hour,
+		},
+		Verification: VerificationConfig{
+			TokenTTL:         48 * time.Hour,
+			UnverifiedPolicy: UnverifiedReadOnly,
+			MaxResends:       3,
+			Window:           time.Hour,
+		},
+		Mail: MailConfig{
+			Driver:   "log",
+			From:     "Microblog <no-reply@localhost>",
+			SMTPPort: 587,
+		},
+		Messages: MessageConfig{
+			Retention:       24 * time.Hour,
+			CleanupInterval: time.Hour,
+		},
+		Timeline: TimelineConfig{
+			FanoutThreshold: 10000,
+			BackfillLimit:   100,
+		},
+		Comments: CommentsConfig{
+			MaxDepth: 8,
+		},
+		Search: SearchConfig{
+			Engine: "auto",
+		},
+		Deletion: DeletionConfig{
+			GracePeriod: 30 * 24 * time.Hour,
+		},
+		Jobs: JobsConfig{
+			TokenCleanup:  6 * time.Hour,
+			Purge:         24 * time.Hour,
+			CounterRepair: 24 * time.Hour,
+			Trending:      5 * time.Minute,
+			Digest:        15 * time.Minute,
+		},
+	}
+}
+
+// Load builds the configuration from, in increasing precedence: defaults, an
+// optional YAML file, environment variables (a .env file is loaded first) and
+// command line flags. The result is validated before it is returned.
+func Load(args []string) (*Config, error) {
+	if err := godotenv.Load(); err != nil {
+		log.Println("Warning: No .env file found, reading from environment variables")
+	}
+
+	cfg := Default()
+
+	fs := flag.NewFlagSet("microblog", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	listenAddr := fs.String("addr", "", "listen address, e.g. :3000")
+	dbDriver := fs.String("db-driver", "", "database driver (postgres or sqlite)")
+	dbDSN := fs.String("db-dsn", "", "database connection string")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configFile != "" {
+		if err := cfg.loadFile(*configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	if *listenAddr != "" {
+		cfg.Server.ListenAddr = *listenAddr
+	}
+	if *dbDriver != "" {
+		cfg.Database.Driver = *dbDriver
+	}
+	if *dbDSN != "" {
+		cfg.Database.DSN = *dbDSN
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	e := &envReader{}
+
+	e.str("LISTEN_ADDR", &c.Server.ListenAddr)
+	e.str("PUBLIC_URL", &c.Server.PublicURL)
+	e.str("UPLOAD_DIR", &c.Server.UploadDir)
+
+	e.str("DB_DRIVER", &c.Database.Driver)
+	e.str("DB_DSN", &c.Database.DSN)
+	e.int("DB_MAX_OPEN_CONNS", &c.Database.MaxOpenConns)
+	e.int("DB_MAX_IDLE_CONNS", &c.Database.MaxIdleConns)
+	e.duration("DB_CONN_MAX_LIFETIME", &c.Database.ConnMaxLifetime)
+
+	e.str("JWT_SECRET", &c.JWT.Secret)
+	e.str("JWT_ISSUER", &c.JWT.Issuer)
+	e.duration("JWT_ACCESS_TTL", &c.JWT.AccessTTL)
+	e.duration("JWT_REFRESH_TTL", &c.JWT.RefreshTTL)
+
+	e.duration("PASSWORD_RESET_TTL", &c.PasswordReset.TokenTTL)
+	e.int("PASSWORD_RESET_MAX_REQUESTS", &c.PasswordReset.MaxRequests)
+	e.duration("PASSWORD_RESET_WINDOW", &c.PasswordReset.Window)
+
+	e.duration("EMAIL_VERIFICATION_TTL", &c.Verification.TokenTTL)
+	e.str("UNVERIFIED_POLICY", &c.Verification.UnverifiedPolicy)
+	e.int("EMAIL_VERIFICATION_MAX_RESENDS", &c.Verification.MaxResends)
+	e.duration("EMAIL_VERIFICATION_WINDOW", &c.Verification.Window)
+
+	e.str("MAIL_DRIVER", &c.Mail.Driver)
+	e.str("MAIL_FROM", &c.Mail.From)
+	e.str("SMTP_HOST", &c.Mail.SMTPHost)
+	e.int("SMTP_PORT", &c.Mail.SMTPPort)
+	e.str("SMTP_USERNAME", &c.Mail.SMTPUsername)
+	e.str("SMTP_PASSWORD", &c.Mail.SMTPPassword)
+	e.str("MAIL_OUTBOX_DIR", &c.Mail.OutboxDir)
+
+	e.duration("MESSAGE_RETENTION", &c.Messages.Retention)
+	e.duration("MESSAGE_CLEANUP_INTERVAL", &c.Messages.CleanupInterval)
+
+	e.int("TIMELINE_FANOUT_THRESHOLD", &c.Timeline.FanoutThreshold)
+	e.int("TIMELINE_BACKFILL_LIMIT", &c.Timeline.BackfillLimit)
+
+	e.int("COMMENT_MAX_DEPTH", &c.Comments.MaxDepth)
+
+	e.str("SEARCH_ENGINE", &c.Search.Engine)
+
+	e.str("ADMIN_EMAIL", &c.Admin.Email)
+
+	e.duration("DELETE_GRACE_PERIOD", &c.Deletion.GracePeriod)
+
+	e.duration("JOB_TOKEN_CLEANUP_INTERVAL", &c.Jobs.TokenCleanup)
+	e.duration("JOB_PURGE_INTERVAL", &c.Jobs.Purge)
+	e.duration("JOB_COUNTER_REPAIR_INTERVAL", &c.Jobs.CounterRepair)
+	e.duration("JOB_TRENDING_INTERVAL", &c.Jobs.Trending)
+	e.duration("JOB_DIGEST_INTERVAL", &c.Jobs.Digest)
+
+	return errors.Join(e.errs...)
+}
+
+// Validate reports every invalid setting at once so startup fails with a
+// complete list instead of one problem per restart
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.Server.ListenAddr == "" {
+		invalid("server.listen_addr must be set")
+	}
+	if c.Server.UploadDir == "" {
+		invalid("server.upload_dir must be set")
+	}
+	if c.Server.PublicURL == "" {
+		invalid("server.public_url must be set (PUBLIC_URL)")
+	}
+
+	switch c.Database.Driver {
+	case "postgres", "sqlite":
+	default:
+		invalid("database.driver must be postgres or sqlite, got %q", c.Database.Driver)
+	}
+	if c.Database.DSN == "" {
+		invalid("database.dsn must be set (DB_DSN)")
+	}
+	if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 {
+		invalid("database pool sizes must not be negative")
+	}
+	if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		invalid("database.max_idle_conns must not exceed max_open_conns")
+	}
+
+	if c.JWT.Secret == "" {
+		invalid("jwt.secret must be set (JWT_SECRET)")
+	}
+	if c.JWT.Issuer == "" {
+		invalid("jwt.issuer must be set")
+	}
+	if c.JWT.AccessTTL <= 0 || c.JWT.RefreshTTL <= 0 {
+		invalid("jwt.access_ttl and jwt.refresh_ttl must be positive")
+	}
+	if c.JWT.RefreshTTL < c.JWT.AccessTTL {
+		invalid("jwt.refresh_ttl must not be shorter than jwt.access_ttl")
+	}
+
+	if c.PasswordReset.TokenTTL <= 0 || c.PasswordReset.Window <= 0 {
+		invalid("password_reset.token_ttl and password_reset.window must be positive")
+	}
+	if c.PasswordReset.MaxRequests < 1 {
+		invalid("password_reset.max_requests must be at least 1")
+	}
+
+	if c.Verification.TokenTTL <= 0 || c.Verification.Window <= 0 {
+		invalid("verification.token_ttl and verification.window must be positive")
+	}
+	if c.Verification.MaxResends < 1 {
+		invalid("verification.max_resends must be at least 1")
+	}
+	switch c.Verification.UnverifiedPolicy {
+	case UnverifiedAllow, UnverifiedReadOnly, UnverifiedBlock:
+	default:
+		invalid("verification.unverified_policy must be allow, read_only or block, got %q", c.Verification.UnverifiedPolicy)
+	}
+
+	switch c.Mail.Driver {
+	case "log":
+	case "smtp":
+		if c.Mail.SMTPHost == "" {
+			invalid("mail.smtp_host must be set for the smtp driver (SMTP_HOST)")
+		}
+		if c.Mail.SMTPPort <= 0 {
+			invalid("mail.smtp_port must be positive")
+		}
+	default:
+		invalid("mail.driver must be smtp or log, got %q", c.Mail.Driver)
+	}
+	if c.Mail.From == "" {
+		invalid("mail.from must be set (MAIL_FROM)")
+	}
+
+	if c.Messages.Retention <= 0 {
+		invalid("messages.retention must be positive")
+	}
+	if c.Messages.CleanupInterval <= 0 {
+		invalid("messages.cleanup_interval must be positive")
+	}
+
+	if c.Timeline.FanoutThreshold < 1 {
+		invalid("timeline.fanout_threshold must be at least 1")
+	}
+	if c.Timeline.BackfillLimit < 0 {
+		invalid("timeline.backfill_limit must not be negative")
+	}
+
+	if c.Comments.MaxDepth < 0 {
+		invalid("comments.max_depth must not be negative")
+	}
+
+	switch c.Search.Engine {
+	case "auto", "memory":
+	case "postgres":
+		if c.Database.Driver != "postgres" {
+			invalid("search.engine postgres needs the postgres database driver")
+		}
+	default:
+		invalid("search.engine must be auto, postgres or memory, got %q", c.Search.Engine)
+	}
+
+	if c.Deletion.GracePeriod <= 0 {
+		invalid("deletion.grace_period must be positive")
+	}
+
+	if c.Jobs.TokenCleanup <= 0 {
+		invalid("jobs.token_cleanup must be positive")
+	}
+	if c.Jobs.Purge <= 0 {
+		invalid("jobs.purge must be positive")
+	}
+	if c.Jobs.CounterRepair <= 0 {
+		invalid("jobs.counter_repair must be positive")
+	}
+	if c.Jobs.Trending <= 0 {
+		invalid("jobs.trending must be positive")
+	}
+	if c.Jobs.Digest <= 0 {
+		invalid("jobs.digest must be positive")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// envReader copies set environment variables into config fields and collects
+// parse errors
+type envReader struct {
+	errs []error
+}
+
+func (e *envReader) str(key string, dst *string) {
+	if v, ok := os.LookupEnv(key); ok {
+		*dst = strings.TrimSpace(v)
+	}
+}
+
+func (e *envReader) int(key string, dst *int) {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: %q is not an integer", key, v))
+		return
+	}
+	*dst = n
+}
+
+func (e *envReader) duration(key string, dst *time.Duration) {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(v))
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: %q is not a duration", key, v))
+		return
+	}
+	*dst = d
+}
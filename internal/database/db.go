@@ -1,28 +1,102 @@
 package db
 
 import (
+	"database/sql/driver"
 	"fmt"
 	"log"
+	"strings"
 
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/config"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	sqlitedriver "github.com/glebarez/go-sqlite"
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-var DB *gorm.DB
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Open connects to the configured database. The sqlite driver is pure Go, so
+// a DSN like "file::memory:?cache=shared" or "microblog.db" runs the whole
+// service on a laptop without a database server.
+func Open(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	switch cfg.Driver {
+	case DriverPostgres:
+		dialector = postgres.Open(cfg.DSN)
+	case DriverSQLite:
+		dialector = sqlite.Open(cfg.DSN)
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", cfg.Driver)
+	}
 
-func Connect() {
-	dsn := "host=localhost user=amar password=mystrongpass dbname=microblog port=5432 sslmode=disable"
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, err := gorm.Open(dialector, &gorm.Config{})
 	if err != nil {
-		log.Fatal("Failed to connect to DB: ", err)
+		return nil, err
 	}
-	DB = db
 
-	// Enable UUID extension for PostgreSQL
-	DB.Exec("CREATE EXTENSION IF NOT EXISTS \"uuid-ossp\"")
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
-	// Auto-migrate the database schema
-	// Note: Models will be migrated in main.go to avoid import cycles
+	switch cfg.Driver {
+	case DriverPostgres:
+		// Enable UUID extension for PostgreSQL
+		db.Exec("CREATE EXTENSION IF NOT EXISTS \"uuid-ossp\"")
+		if err := db.Exec(postgresMuteText()).Error; err != nil {
+			return nil, err
+		}
+	case DriverSQLite:
+		// SQLite allows a single writer; serialize access through one connection
+		// and never recycle it, since an in-memory database dies with it
+		sqlDB.SetMaxOpenConns(1)
+		sqlDB.SetConnMaxLifetime(0)
+		db.Exec("PRAGMA foreign_keys = ON")
+	}
 
-	fmt.Println("Connected to microblog!")
+	log.Printf("Connected to microblog (%s)!", cfg.Driver)
+	return db, nil
+}
+
+// mute_text(text, kind) is models.MuteText in SQL, which the store's mute
+// filters match muted words against. SQLite calls the Go function itself.
+func init() {
+	sqlitedriver.MustRegisterDeterministicScalarFunction("mute_text", 2,
+		func(_ *sqlitedriver.FunctionContext, args []driver.Value) (driver.Value, error) {
+			text, _ := args[0].(string)
+			kind, _ := args[1].(string)
+			return models.MuteText(text, kind), nil
+		})
+}
+
+// postgresMuteText defines mute_text for Postgres, replacing every separator
+// with one regexp_replace
+func postgresMuteText() string {
+	class := func(kind string) string {
+		var b strings.Builder
+		b.WriteString("[")
+		for _, sep := range models.MuteSeparators(kind) {
+			if sep == "'" {
+				sep = "''"
+			} else if !strings.ContainsAny(sep, "\t\r\n") {
+				b.WriteString(`\`)
+			}
+			b.WriteString(sep)
+		}
+		b.WriteString("]")
+		return b.String()
+	}
+	return `CREATE OR REPLACE FUNCTION mute_text(t text, kind text) RETURNS text
+		LANGUAGE sql IMMUTABLE AS $$
+		SELECT ' ' || regexp_replace(lower(coalesce(t, '')),
+			CASE WHEN kind = '` + models.MuteHashtag + `' THEN '` + class(models.MuteHashtag) + `'
+			ELSE '` + class(models.MuteKeyword) + `' END, ' ', 'g') || ' '
+		$$`
 }
@@ -0,0 +1,123 @@
+// Package diff computes word-level differences between two texts
+package diff
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Op kinds
+const (
+	Equal  = "equal"
+	Insert = "insert"
+	Delete = "delete"
+)
+
+// Op is a run of text that is kept, added or removed
+type Op struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// maxCells caps the LCS table; larger inputs are reported as a full rewrite
+const maxCells = 4_000_000
+
+// Words diffs a and b token by token, where tokens are words and the
+// whitespace between them, so joining every Equal and Insert yields b.
+func Words(a, b string) []Op {
+	x, y := tokenize(a), tokenize(b)
+
+	// Trim the common prefix and suffix before building the table
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+
+	var ops []Op
+	push := func(kind, text string) {
+		if text == "" {
+			return
+		}
+		if n := len(ops); n > 0 && ops[n-1].Type == kind {
+			ops[n-1].Text += text
+			return
+		}
+		ops = append(ops, Op{Type: kind, Text: text})
+	}
+
+	push(Equal, strings.Join(x[:prefix], ""))
+	for _, op := range middle(x[prefix:len(x)-suffix], y[prefix:len(y)-suffix]) {
+		push(op.Type, op.Text)
+	}
+	push(Equal, strings.Join(x[len(x)-suffix:], ""))
+	return ops
+}
+
+func middle(x, y []string) []Op {
+	if len(x)*len(y) > maxCells {
+		return []Op{{Delete, strings.Join(x, "")}, {Insert, strings.Join(y, "")}}
+	}
+
+	// lcs[i][j] is the LCS length of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []Op
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			ops = append(ops, Op{Equal, x[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, Op{Delete, x[i]})
+			i++
+		default:
+			ops = append(ops, Op{Insert, y[j]})
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		ops = append(ops, Op{Delete, x[i]})
+	}
+	for ; j < len(y); j++ {
+		ops = append(ops, Op{Insert, y[j]})
+	}
+	return ops
+}
+
+// tokenize splits s into alternating runs of whitespace and non-whitespace
+func tokenize(s string) []string {
+	var tokens []string
+	start, space := 0, false
+	for i, r := range s {
+		if isSpace := unicode.IsSpace(r); i == 0 {
+			space = isSpace
+		} else if isSpace != space {
+			tokens = append(tokens, s[start:i])
+			start, space = i, isSpace
+		}
+	}
+	if start < len(s) {
+		tokens = append(tokens, s[start:])
+	}
+	return tokens
+}
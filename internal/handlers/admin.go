@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/policy"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+	"github.com/am4rknvl/local-micro-blogging-service.git/jobs"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// AdminListUsers lists accounts, filtered by ?q=, ?role= and ?suspended=
+func (h *Handler) AdminListUsers(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit := pageLimit(c.QueryInt("limit", 50), 200)
+
+	filter := store.UserFilter{
+		Search: c.Query("q"),
+		Role:   c.Query("role"),
+		Limit:  limit,
+		Offset: (page - 1) * limit,
+	}
+	if v := c.Query("suspended"); v != "" {
+		suspended := v == "true"
+		filter.Suspended = &suspended
+	}
+
+	users, err := h.store.Users.List(filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list users"})
+	}
+	listed := make([]models.AdminUser, len(users))
+	for i, u := range users {
+		listed[i] = models.NewAdminUser(u)
+	}
+
+	return c.JSON(fiber.Map{
+		"page":  page,
+		"limit": limit,
+		"users": listed,
+	})
+}
+
+// AdminSuspendUser blocks sign-in for an account and ends its sessions
+func (h *Handler) AdminSuspendUser(c *fiber.Ctx) error {
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.BodyParser(&input); err != nil && len(c.Body()) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	if len(input.Reason) > 255 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Reason is too long"})
+	}
+
+	return h.setSuspended(c, true, strings.TrimSpace(input.Reason))
+}
+
+// AdminUnsuspendUser lets a suspended account sign in again
+func (h *Handler) AdminUnsuspendUser(c *fiber.Ctx) error {
+	return h.setSuspended(c, false, "")
+}
+
+func (h *Handler) setSuspended(c *fiber.Ctx, suspend bool, reason string) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	user, err := h.store.Users.GetByID(userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	actor, err := h.actor(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unknown user"})
+	}
+	if !policy.CanSuspend(actor, user) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	fields := map[string]interface{}{"suspended_at": nil, "suspend_reason": ""}
+	if suspend {
+		fields["suspended_at"] = time.Now()
+		fields["suspend_reason"] = reason
+	}
+	if err := h.store.Users.Updates(userID, fields); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update user"})
+	}
+
+	if suspend {
+		if err := h.store.Sessions.RevokeAll(userID); err != nil {
+			log.Println("revoke sessions of suspended user failed:", err)
+		}
+		return c.JSON(fiber.Map{"message": "User suspended"})
+	}
+	return c.JSON(fiber.Map{"message": "User unsuspended"})
+}
+
+// AdminSetRole changes an account's role
+func (h *Handler) AdminSetRole(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	var input struct {
+		Role string `json:"role"`
+	}
+	if err := c.BodyParser(&input); err != nil || !policy.ValidRole(input.Role) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "role must be user, moderator or admin"})
+	}
+
+	user, err := h.store.Users.GetByID(userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	actor, err := h.actor(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unknown user"})
+	}
+	if !policy.CanChangeRole(actor, user) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	if err := h.store.Users.Updates(userID, map[string]interface{}{"role": input.Role}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update role"})
+	}
+	return c.JSON(fiber.Map{"message": "Role updated", "role": input.Role})
+}
+
+// AdminJobStatus reports when each background job last ran and how it went
+func (h *Handler) AdminJobStatus(c *fiber.Ctx) error {
+	return c.JSON(jobs.Statuses())
+}
+
+// AdminDeleteOldMessages runs the message cleanup job now
+func (h *Handler) AdminDeleteOldMessages(c *fiber.Ctx) error {
+	if err := jobs.DeleteOldMessages(h.store.Messages, h.cfg.Messages.Retention); err != nil {
+		return c.Status(500).SendString("Failed to delete old messages")
+	}
+	return c.SendString("Old unsaved messages deleted manually")
+}
@@ -1,19 +1,24 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
 	"time"
 
-	"github.com/am4rknvl/local-micro-blogging-service.git/internal/config"
-	db "github.com/am4rknvl/local-micro-blogging-service.git/internal/database"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/auth"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/mail"
 	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/policy"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func Signup(c *fiber.Ctx) error {
+func (h *Handler) Signup(c *fiber.Ctx) error {
 	type SignupInput struct {
 		Username string `json:"username"`
 		Email    string `json:"email"`
@@ -35,17 +40,23 @@ func Signup(c *fiber.Ctx) error {
 		Username:  input.Username,
 		Email:     input.Email,
 		Password:  string(hashed),
+		Role:      models.RoleUser,
 		CreatedAt: time.Now(),
 	}
 
-	if err := db.DB.Create(&user).Error; err != nil {
+	if err := h.store.Users.Create(&user); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Could not create user"})
 	}
 
-	return c.JSON(fiber.Map{"message": "Signup successful"})
+	// The account exists either way; the user can ask for a new link later
+	if err := h.sendVerificationEmail(&user); err != nil {
+		log.Println("verification email failed:", err)
+	}
+
+	return c.JSON(fiber.Map{"message": "Signup successful, check your email to verify your account"})
 }
 
-func Login(c *fiber.Ctx) error {
+func (h *Handler) Login(c *fiber.Ctx) error {
 	type LoginInput struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
@@ -56,8 +67,8 @@ func Login(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
 	}
 
-	var user models.User
-	if err := db.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
+	user, err := h.store.Users.GetByEmail(input.Email)
+	if err != nil {
 		return c.Status(401).JSON(fiber.Map{"error": "Invalid credentials"})
 	}
 
@@ -65,101 +76,131 @@ func Login(c *fiber.Ctx) error {
 		return c.Status(401).JSON(fiber.Map{"error": "Invalid credentials"})
 	}
 
-	// Create JWT token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.ID.String(),
-		"exp":     time.Now().Add(time.Hour * 72).Unix(), // 3 days expiration, reduce it by anychance...
-	})
+	if user.SuspendedAt != nil {
+		return c.Status(403).JSON(fiber.Map{"error": "Account suspended"})
+	}
 
-	tokenString, err := token.SignedString(config.JwtSecret)
+	// Issue an access token and start a refresh token chain
+	tokens, err := h.auth.Login(user.ID, clientInfo(c))
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Could not login"})
 	}
 
-	// Return token to client
-	return c.JSON(fiber.Map{"token": tokenString})
+	return c.JSON(tokens)
 }
 
-
-func Logout(c *fiber.Ctx) error {
-	// Clear token cookie or just tell client to delete token
-	return c.JSON(fiber.Map{"message": "Logged out successfully"})
-}
-
-
-func BlockUser(c *fiber.Ctx) error {
-	type BlockInput struct {
-		UserID string `json:"user_id"`
-		Block  bool   `json:"block"`
+// RefreshToken trades a refresh token for a new access/refresh pair
+func (h *Handler) RefreshToken(c *fiber.Ctx) error {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
 	}
-
-	var input BlockInput
-	if err := c.BodyParser(&input); err != nil {
+	if err := c.BodyParser(&input); err != nil || input.RefreshToken == "" {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
 	}
 
-	var user models.User
-	if err := db.DB.First(&user, "id = ?", input.UserID).Error; err != nil {
-		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+	tokens, err := h.auth.Refresh(input.RefreshToken, clientInfo(c))
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrExpiredToken) {
+			return c.Status(401).JSON(fiber.Map{"error": "Invalid refresh token"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Could not refresh token"})
 	}
 
+	return c.JSON(tokens)
+}
 
 
-	if err := db.DB.Save(&user).Error; err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Could not update user"})
+// Logout revokes the current session so its tokens stop working immediately
+func (h *Handler) Logout(c *fiber.Ctx) error {
+	claims := c.Locals("claims").(*auth.Claims)
+
+	if err := h.auth.Logout(claims); err != nil && !errors.Is(err, store.ErrNotFound) {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not logout"})
 	}
 
-	return c.JSON(fiber.Map{"message": "User block status updated"})
+	return c.JSON(fiber.Map{"message": "Logged out successfully"})
 }
 
-
-var resetTokens = make(map[string]string) // map[email]token
+func clientInfo(c *fiber.Ctx) auth.ClientInfo {
+	return auth.ClientInfo{UserAgent: c.Get(fiber.HeaderUserAgent), IP: c.IP()}
+}
 
 
-func RequestPasswordReset(c *fiber.Ctx) error {
+// RequestPasswordReset emails a single-use reset link. The response is the
+// same whether the email is unknown, rate limited or sent.
+func (h *Handler) RequestPasswordReset(c *fiber.Ctx) error {
 	type ResetRequest struct {
 		Email string `json:"email"`
 	}
 
 	var req ResetRequest
-	if err := c.BodyParser(&req); err != nil {
+	if err := c.BodyParser(&req); err != nil || req.Email == "" {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
 	}
 
-	var user models.User
-	if err := db.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
+	response := fiber.Map{"message": "If email exists, reset token sent"}
+
+	if !h.resetLimiter.Allow(strings.ToLower(strings.TrimSpace(req.Email))) {
+		return c.JSON(response)
+	}
+
+	user, err := h.store.Users.GetByEmail(req.Email)
+	if err != nil {
 		// don't reveal user existence
-		return c.JSON(fiber.Map{"message": "If email exists, reset token sent"})
+		return c.JSON(response)
 	}
 
-	token := uuid.New().String()
-	resetTokens[req.Email] = token
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not create reset token"})
+	}
 
-	
-	// For MVP: just return token in response
-	return c.JSON(fiber.Map{"reset_token": token})
+	reset := models.PasswordResetToken{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(h.cfg.PasswordReset.TokenTTL),
+		CreatedAt: time.Now(),
+	}
+	if err := h.store.PasswordReset.Create(&reset); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not create reset token"})
+	}
+
+	h.sendMail(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse this link to choose a new password:\n%s/reset-password?token=%s\n\n"+
+			"Or send this reset token to the app: %s\n\nIt expires in %s. If you didn't ask for this, ignore this email.\n",
+			user.Username, h.cfg.Server.PublicURL, token, token, h.cfg.PasswordReset.TokenTTL),
+	})
+
+	return c.JSON(response)
 }
 
 
-func ResetPassword(c *fiber.Ctx) error {
+// ResetPassword redeems a reset token, sets the new password and signs the
+// user out of every session
+func (h *Handler) ResetPassword(c *fiber.Ctx) error {
 	type ResetInput struct {
-		Email       string `json:"email"`
 		ResetToken  string `json:"reset_token"`
 		NewPassword string `json:"new_password"`
 	}
 
 	var input ResetInput
-	if err := c.BodyParser(&input); err != nil {
+	if err := c.BodyParser(&input); err != nil || input.ResetToken == "" || input.NewPassword == "" {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
 	}
 
-	storedToken, ok := resetTokens[input.Email]
-	if !ok || storedToken != input.ResetToken {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid reset token"})
+	reset, err := h.store.PasswordReset.Consume(auth.HashToken(input.ResetToken))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid reset token"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Could not reset password"})
 	}
 
-	var user models.User
-	if err := db.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
+	user, err := h.store.Users.GetByID(reset.UserID)
+	if err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
 	}
 
@@ -169,38 +210,53 @@ func ResetPassword(c *fiber.Ctx) error {
 	}
 
 	user.Password = string(hashed)
-	if err := db.DB.Save(&user).Error; err != nil {
+	if err := h.store.Users.Save(user); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Could not update password"})
 	}
 
-	// remove token so it can’t be reused
-	delete(resetTokens, input.Email)
+	// Whoever held the old password must not stay signed in
+	if err := h.store.Sessions.RevokeAll(user.ID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not revoke sessions"})
+	}
 
 	return c.JSON(fiber.Map{"message": "Password reset successful"})
 }
 
 
-func UploadAvatar(c *fiber.Ctx) error {
+func (h *Handler) UploadAvatar(c *fiber.Ctx) error {
 	userID := c.Params("id")
 
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	user, err := h.store.Users.GetByID(uid)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	actor, err := h.actor(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unknown user"})
+	}
+	if !policy.CanEditProfile(actor, user) {
+		return c.Status(403).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
 	file, err := c.FormFile("avatar")
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "No file uploaded"})
 	}
 
-	savePath := fmt.Sprintf("./uploads/%s_%s", userID, file.Filename)
+	savePath := filepath.Join(h.cfg.Server.UploadDir, fmt.Sprintf("%s_%s", userID, filepath.Base(file.Filename)))
 
 	if err := c.SaveFile(file, savePath); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Could not save file"})
 	}
 
-	var user models.User
-	if err := db.DB.First(&user, "id = ?", userID).Error; err != nil {
-		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
-	}
-
 	user.Avatar = savePath
-	if err := db.DB.Save(&user).Error; err != nil {
+	if err := h.store.Users.Save(user); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Could not update avatar"})
 	}
 
@@ -208,13 +264,14 @@ func UploadAvatar(c *fiber.Ctx) error {
 }
 
 
-func GetCurrentUser(c *fiber.Ctx) error {
-	userToken := c.Locals("user").(*jwt.Token)
-	claims := userToken.Claims.(jwt.MapClaims)
-	userID := claims["user_id"].(string)
+func (h *Handler) GetCurrentUser(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
 
-	var user models.User
-	if err := db.DB.First(&user, "id = ?", userID).Error; err != nil {
+	user, err := h.store.Users.GetByID(userID)
+	if err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
 	}
 
@@ -223,43 +280,45 @@ func GetCurrentUser(c *fiber.Ctx) error {
 	return c.JSON(user)
 }
 
-func UpdateUser(c *fiber.Ctx) error {
-	userID := c.Params("id")
+func (h *Handler) DeleteUser(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
 
-	var user models.User
-	if err := db.DB.First(&user, "id = ?", userID).Error; err != nil {
+	user, err := h.store.Users.GetByID(id)
+	if err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
 	}
 
-	var updates map[string]interface{}
-	if err := c.BodyParser(&updates); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
+	actor, err := h.actor(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unknown user"})
 	}
-
-	// Block password update this way for security
-	delete(updates, "password")
-
-	if err := db.DB.Model(&user).Updates(updates).Error; err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Could not update user"})
+	if !policy.CanDeleteAccount(actor, user) {
+		return c.Status(403).JSON(fiber.Map{"error": "Unauthorized"})
 	}
 
-	return c.JSON(user)
-}
-
-
-func DeleteUser(c *fiber.Ctx) error {
-	id := c.Params("id")
-
-	if err := db.DB.Delete(&models.User{}, "id = ?", id).Error; err != nil {
+	if err := h.store.Users.Delete(id, actor.ID); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Could not delete user"})
 	}
+	if err := h.store.Sessions.RevokeAll(id); err != nil {
+		log.Println("revoke sessions of deleted user failed:", err)
+	}
 
-	return c.JSON(fiber.Map{"message": "User deleted"})
+	restoreUntil := time.Now().Add(h.cfg.Deletion.GracePeriod)
+	return c.JSON(fiber.Map{
+		"message":       "User deleted; the account can be restored until it is purged",
+		"restore_until": restoreUntil,
+	})
 }
 
 
-func UpdatePassword(c *fiber.Ctx) error {
-	userID := c.Params("id")
+func (h *Handler) UpdatePassword(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
 
 	type Input struct {
 		OldPassword string `json:"old_password"`
@@ -271,11 +330,19 @@ func UpdatePassword(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
 	}
 
-	var user models.User
-	if err := db.DB.First(&user, "id = ?", userID).Error; err != nil {
+	user, err := h.store.Users.GetByID(userID)
+	if err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
 	}
 
+	actor, err := h.actor(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unknown user"})
+	}
+	if !policy.CanChangePassword(actor, user) {
+		return c.Status(403).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.OldPassword)); err != nil {
 		return c.Status(401).JSON(fiber.Map{"error": "Old password is incorrect"})
 	}
@@ -286,7 +353,7 @@ func UpdatePassword(c *fiber.Ctx) error {
 	}
 
 	user.Password = string(hashed)
-	if err := db.DB.Save(&user).Error; err != nil {
+	if err := h.store.Users.Save(user); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Could not update password"})
 	}
 
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// BlockUser blocks the user in the path for the caller. Follows between the
+// two are dropped, and neither side can interact with the other afterwards.
+func (h *Handler) BlockUser(c *fiber.Ctx) error {
+	blockerID, err := uuid.Parse(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	blockedID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	if blockerID == blockedID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot block yourself"})
+	}
+
+	if _, err := h.store.Users.GetByID(blockedID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to block user"})
+	}
+
+	if err := h.store.Blocks.Create(blockerID, blockedID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to block user"})
+	}
+
+	return c.JSON(fiber.Map{"message": "User blocked"})
+}
+
+// UnblockUser lifts a block the caller placed. Removed follows are not restored.
+func (h *Handler) UnblockUser(c *fiber.Ctx) error {
+	blockerID, err := uuid.Parse(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	blockedID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	if err := h.store.Blocks.Delete(blockerID, blockedID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to unblock user"})
+	}
+
+	return c.JSON(fiber.Map{"message": "User unblocked"})
+}
+
+// ListBlocks returns the users the caller has blocked
+func (h *Handler) ListBlocks(c *fiber.Ctx) error {
+	blockerID, err := uuid.Parse(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	users, err := h.store.Blocks.Blocked(blockerID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch blocked users"})
+	}
+
+	result := make([]fiber.Map, 0, len(users))
+	for _, u := range users {
+		result = append(result, fiber.Map{
+			"id":       u.ID,
+			"username": u.Username,
+			"avatar":   u.Avatar,
+		})
+	}
+	return c.JSON(result)
+}
+
+// viewerID is the authenticated caller, or uuid.Nil on public routes
+func viewerID(c *fiber.Ctx) uuid.UUID {
+	userID, _ := c.Locals("userID").(string)
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return uuid.Nil
+	}
+	return id
+}
+
+// blockedWith reports whether the caller and other have blocked each other in
+// either direction
+func (h *Handler) blockedWith(c *fiber.Ctx, other uuid.UUID) (bool, error) {
+	me := viewerID(c)
+	if me == uuid.Nil || me == other {
+		return false, nil
+	}
+	return h.store.Blocks.Between(me, other)
+}
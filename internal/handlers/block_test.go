@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestBlockEnforcement(t *testing.T) {
+	env := newTestEnv(t)
+	users := env.users(t, 2)
+	alice, bob := users[0].ID, users[1].ID
+	post := env.post(t, alice, "hello", "from alice")
+
+	if status, body := env.serve(t, "POST", "/blocks/:id", "/blocks/"+bob.String(), alice, "", env.h.BlockUser); status != fiber.StatusOK {
+		t.Fatalf("block: status %d: %s", status, body)
+	}
+
+	// The blocked user cannot reach the blocker anywhere
+	for _, tc := range []struct {
+		name       string
+		method     string
+		route      string
+		path       string
+		body       string
+		handler    fiber.Handler
+		wantStatus int
+	}{
+		{"follow", "POST", "/follow/:id", "/follow/" + alice.String(), "", env.h.FollowUser, fiber.StatusForbidden},
+		{"comment", "POST", "/posts/:id/comments", "/posts/" + post.ID.String() + "/comments", `{"content":"hi"}`, env.h.CreateComment, fiber.StatusForbidden},
+		{"vote", "POST", "/votes/:id", "/votes/" + post.ID.String(), `{"value":1}`, env.h.VotePost, fiber.StatusForbidden},
+		{"friend request", "POST", "/friend-request", "/friend-request", `{"receiver_id":"` + alice.String() + `"}`, env.h.SendFriendRequest, fiber.StatusForbidden},
+		{"direct message", "POST", "/conversations", "/conversations", `{"member_ids":["` + alice.String() + `"]}`, env.h.CreateConversation, fiber.StatusForbidden},
+		{"profile", "GET", "/profile/:id", "/profile/" + alice.String(), "", env.h.GetProfile, fiber.StatusNotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			status, body := env.serve(t, tc.method, tc.route, tc.path, bob, tc.body, tc.handler)
+			if status != tc.wantStatus {
+				t.Errorf("status %d, want %d: %s", status, tc.wantStatus, body)
+			}
+		})
+	}
+
+	// A block works both ways
+	if status, _ := env.serve(t, "POST", "/follow/:id", "/follow/"+bob.String(), alice, "", env.h.FollowUser); status != fiber.StatusForbidden {
+		t.Errorf("blocker follows blocked user: status %d, want %d", status, fiber.StatusForbidden)
+	}
+
+	if _, body := env.serve(t, "GET", "/posts", "/posts", bob, "", env.h.GetPosts); strings.Contains(body, post.ID.String()) {
+		t.Errorf("blocked user lists the blocker's post: %s", body)
+	}
+
+	if status, body := env.serve(t, "DELETE", "/blocks/:id", "/blocks/"+bob.String(), alice, "", env.h.UnblockUser); status != fiber.StatusOK {
+		t.Fatalf("unblock: status %d: %s", status, body)
+	}
+	if status, body := env.serve(t, "POST", "/follow/:id", "/follow/"+alice.String(), bob, "", env.h.FollowUser); status != fiber.StatusOK {
+		t.Errorf("follow after unblock: status %d: %s", status, body)
+	}
+	if _, body := env.serve(t, "GET", "/posts", "/posts", bob, "", env.h.GetPosts); !strings.Contains(body, post.ID.String()) {
+		t.Errorf("post still hidden after unblock: %s", body)
+	}
+}
@@ -3,18 +3,24 @@ package handlers
 import (
 	"time"
 
-	"github.com/google/uuid"
-	db "github.com/am4rknvl/local-micro-blogging-service.git/internal/database"
-	"github.com/gofiber/fiber/v2"
 	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/policy"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 )
 
-
 type EnrichedComment struct {
-	ID        uuid.UUID `json:"id"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
-	IsOP      bool      `json:"is_op"`
+	ID        uuid.UUID  `json:"id"`
+	ParentID  *uuid.UUID `json:"parent_id,omitempty"`
+	Depth     int        `json:"depth"`
+	Content   string     `json:"content"`
+	CreatedAt time.Time  `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	IsOP      bool       `json:"is_op"`
+	Score     int64      `json:"score"`
+	Upvotes   int64      `json:"upvotes"`
+	Downvotes int64      `json:"downvotes"`
+	Deleted   bool       `json:"deleted,omitempty"` // tombstone: content and user are blanked
 
 	// User Info (Embedded)
 	User struct {
@@ -24,8 +30,44 @@ type EnrichedComment struct {
 	} `json:"user"`
 }
 
-// CreateComment creates a comment on a post
-func CreateComment(c *fiber.Ctx) error {
+// onPost reports whether the comment belongs to the post in the :id param
+func onPost(c *fiber.Ctx, comment *models.Comment) bool {
+	pid, err := uuid.Parse(c.Params("id"))
+	return err == nil && comment.PostID == pid
+}
+
+// CreateComment creates a top-level comment on a post
+func (h *Handler) CreateComment(c *fiber.Ctx) error {
+	return h.createComment(c, nil)
+}
+
+// CreateReply answers a comment, up to the configured nesting depth
+func (h *Handler) CreateReply(c *fiber.Ctx) error {
+	cid, err := uuid.Parse(c.Params("commentId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid comment ID"})
+	}
+
+	parent, err := h.store.Comments.GetByID(cid)
+	if err != nil || !onPost(c, parent) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Comment not found"})
+	}
+	if parent.Depth >= h.cfg.Comments.MaxDepth {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Replies cannot nest any deeper"})
+	}
+
+	blocked, err := h.blockedWith(c, parent.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create comment"})
+	}
+	if blocked {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Cannot reply to this comment"})
+	}
+
+	return h.createComment(c, parent)
+}
+
+func (h *Handler) createComment(c *fiber.Ctx, parent *models.Comment) error {
 	userID := c.Locals("userID").(string)
 	postID := c.Params("id")
 
@@ -47,6 +89,19 @@ func CreateComment(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid post ID"})
 	}
 
+	post, err := h.store.Posts.GetByID(pid)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Post not found"})
+	}
+
+	blocked, err := h.blockedWith(c, post.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create comment"})
+	}
+	if blocked {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Cannot comment on this post"})
+	}
+
 	comment := models.Comment{
 		ID:        uuid.New(),
 		PostID:    pid,
@@ -55,73 +110,78 @@ func CreateComment(c *fiber.Ctx) error {
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
+	if parent != nil {
+		comment.ParentID = &parent.ID
+		comment.Depth = parent.Depth + 1
+	}
 
-	if err := db.DB.Create(&comment).Error; err != nil {
+	if err := h.store.Comments.Create(&comment); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create comment"})
 	}
 
-	return c.JSON(comment)
-}
-
-// GetComments gets all comments for a post
-func GetComments(c *fiber.Ctx) error {
-	postID := c.Params("id")
+	// A reply tells the comment's author; the post's author hears of it too
+	// unless that is the same person
+	notified := []uuid.UUID{post.UserID}
+	if parent != nil {
+		h.notify(parent.UserID, uid, models.NotifyComment, models.EntityComment, parent.ID.String())
+		notified = append(notified, parent.UserID)
+	}
+	if parent == nil || parent.UserID != post.UserID {
+		h.notify(post.UserID, uid, models.NotifyComment, models.EntityPost, post.ID.String())
+	}
+	h.notifyMentions(uid, models.EntityComment, comment.ID.String(), comment.Content, notified...)
 
-	pid, err := uuid.Parse(postID)
+	// Shown as GetComments shows it; a new comment has no votes yet
+	author, err := h.store.Users.GetByID(uid)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid post ID"})
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create comment"})
 	}
+	r := &threadRenderer{post: post, thread: &thread{}, users: map[uuid.UUID]*models.User{uid: author}}
+	return c.JSON(r.enrich(comment))
+}
 
-	// Get post to find OP
-	var post models.Post
-	if err := db.DB.First(&post, "id = ?", pid).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Post not found"})
+// GetComments gets the comments for a post, ordered by
+// ?sort=old|new|top|controversial (oldest first by default). Without ?mode=
+// it returns every comment, each followed by its replies. ?mode=tree nests replies and
+// ?mode=flat lists them in the same order with their depth; both page
+// top-level comments with ?limit= and ?cursor=, and render ?depth= levels
+// with up to ?replies= replies per comment.
+func (h *Handler) GetComments(c *fiber.Ctx) error {
+	post, t, err := h.loadThread(c)
+	if post == nil {
+		return err
+	}
+	if c.Query("mode") != "" {
+		return h.threadPage(c, post, t, uuid.Nil)
 	}
 
-	// Get all comments on that post
-	var comments []models.Comment
-	if err := db.DB.Where("post_id = ?", pid).Order("created_at asc").Find(&comments).Error; err != nil {
+	// Prepare enriched response; authors come in one query
+	r, err := h.newThreadRenderer(post, t)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch comments"})
 	}
-
-	// Prepare enriched response
 	var enriched []EnrichedComment
-	for _, cmt := range comments {
-		var user models.User
-		if err := db.DB.Select("id", "username", "avatar").First(&user, "id = ?", cmt.UserID).Error; err != nil {
-			continue // silently skip if user not found
+	var walk func(parent uuid.UUID)
+	walk = func(parent uuid.UUID) {
+		for _, cmt := range t.children[parent] {
+			enriched = append(enriched, r.enrich(cmt))
+			walk(cmt.ID)
 		}
-
-		enriched = append(enriched, EnrichedComment{
-			ID:        cmt.ID,
-			Content:   cmt.Content,
-			CreatedAt: cmt.CreatedAt,
-			IsOP:      cmt.UserID == post.UserID,
-			User: struct {
-				ID       uuid.UUID `json:"id"`
-				Username string    `json:"username"`
-				Avatar   string    `json:"avatar"`
-			}{
-				ID:       user.ID,
-				Username: user.Username,
-				Avatar:   user.Avatar,
-			},
-		})
 	}
+	walk(uuid.Nil)
 
 	return c.JSON(enriched)
 }
 
-// UpdateComment updates a comment (only by owner)
-func UpdateComment(c *fiber.Ctx) error {
-	userID := c.Locals("userID").(string)
+// UpdateComment updates a comment (only by its author)
+func (h *Handler) UpdateComment(c *fiber.Ctx) error {
 	commentID := c.Params("commentId")
 
 	var input struct {
 		Content string `json:"content"`
 	}
 
-	if err := c.BodyParser(&input); err != nil || input.Content == "" {
+	if err := parseStrict(c, &input); err != nil || input.Content == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
 	}
 
@@ -130,28 +190,30 @@ func UpdateComment(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid comment ID"})
 	}
 
-	var comment models.Comment
-	if err := db.DB.First(&comment, "id = ?", cid).Error; err != nil {
+	comment, err := h.store.Comments.GetByID(cid)
+	if err != nil || !onPost(c, comment) {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Comment not found"})
 	}
 
-	if comment.UserID.String() != userID {
+	actor, err := h.actor(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unknown user"})
+	}
+	if !policy.CanEditComment(actor, comment) {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Unauthorized"})
 	}
 
-	comment.Content = input.Content
-	comment.UpdatedAt = time.Now()
-
-	if err := db.DB.Save(&comment).Error; err != nil {
+	// Every effective edit is kept as a revision
+	comment, err = h.store.Comments.Edit(cid, actor.ID, input.Content)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update comment"})
 	}
 
 	return c.JSON(comment)
 }
 
-// DeleteComment deletes a comment (only by owner/Op)
-func DeleteComment(c *fiber.Ctx) error {
-	userID := c.Locals("userID").(string)
+// DeleteComment deletes a comment (by its author, the OP or a moderator)
+func (h *Handler) DeleteComment(c *fiber.Ctx) error {
 	commentID := c.Params("commentId")
 
 	cid, err := uuid.Parse(commentID)
@@ -159,16 +221,25 @@ func DeleteComment(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid comment ID"})
 	}
 
-	var comment models.Comment
-	if err := db.DB.First(&comment, "id = ?", cid).Error; err != nil {
+	comment, err := h.store.Comments.GetByID(cid)
+	if err != nil || !onPost(c, comment) {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Comment not found"})
 	}
 
-	if comment.UserID.String() != userID {
+	post, err := h.store.Posts.GetByID(comment.PostID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Post not found"})
+	}
+
+	actor, err := h.actor(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unknown user"})
+	}
+	if !policy.CanDeleteComment(actor, comment, post) {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Unauthorized"})
 	}
 
-	if err := db.DB.Delete(&comment).Error; err != nil {
+	if err := h.store.Comments.Delete(comment.ID, actor.ID); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete comment"})
 	}
 
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// maxConversationMembers bounds a conversation, its creator included
+const maxConversationMembers = 50
+
+// CreateConversation starts a conversation between the caller and
+// member_ids. One other user and no title or avatar makes a direct
+// conversation; asking again for the same pair returns the existing one
+// with 200. Anything else makes a group, owned by the caller.
+func (h *Handler) CreateConversation(c *fiber.Ctx) error {
+	userID := viewerID(c)
+
+	var input struct {
+		MemberIDs []uuid.UUID `json:"member_ids"`
+		Title     string      `json:"title"`
+		Avatar    string      `json:"avatar"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	input.Title = strings.TrimSpace(input.Title)
+	if msg := validateGroup(input.Title, input.Avatar); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	var others []uuid.UUID
+	seen := map[uuid.UUID]bool{userID: true}
+	for _, id := range input.MemberIDs {
+		if !seen[id] {
+			seen[id] = true
+			others = append(others, id)
+		}
+	}
+	if len(others) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "member_ids must name at least one other user"})
+	}
+	if len(others)+1 > maxConversationMembers {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("A conversation can have at most %d members", maxConversationMembers)})
+	}
+
+	users, err := h.store.Users.GetByIDs(others)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create conversation"})
+	}
+	if len(users) != len(others) {
+		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+	}
+	now := time.Now()
+	conv := &models.Conversation{
+		ID:             uuid.New(),
+		Type:           models.ConversationGroup,
+		Title:          input.Title,
+		Avatar:         input.Avatar,
+		CreatedBy:      userID,
+		LastActivityAt: now,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if len(others) == 1 && input.Title == "" && input.Avatar == "" {
+		// Blocks refuse direct conversations only; in a group they hide the
+		// blocked user's messages from the blocker
+		blocked, err := h.blockedWith(c, others[0])
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to create conversation"})
+		}
+		if blocked {
+			return c.Status(403).JSON(fiber.Map{"error": "Cannot start a conversation with this user"})
+		}
+
+		existing, err := h.store.Conversations.Direct(userID, others[0])
+		if err == nil {
+			return h.conversationResponse(c, fiber.StatusOK, existing.ID)
+		}
+		if !errors.Is(err, store.ErrNotFound) {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to create conversation"})
+		}
+		key := models.DirectKey(userID, others[0])
+		conv.Type = models.ConversationDirect
+		conv.DirectKey = &key
+	}
+
+	if err := h.store.Conversations.Create(conv, append([]uuid.UUID{userID}, others...)); err != nil {
+		log.Println("create conversation failed:", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create conversation"})
+	}
+	return h.conversationResponse(c, fiber.StatusCreated, conv.ID)
+}
+
+// GetConversations lists the caller's conversations by latest activity,
+// each with its members, last message and unread count. Pass next_cursor
+// back as ?cursor= for the following page.
+func (h *Handler) GetConversations(c *fiber.Ctx) error {
+	after, err := decodeCursor(c.Query("cursor"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid cursor"})
+	}
+	limit := pageLimit(c.QueryInt("limit", 20), 50)
+
+	items, err := h.store.Conversations.List(viewerID(c), after, limit+1)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch conversations"})
+	}
+	nextCursor := ""
+	if len(items) > limit {
+		items = items[:limit]
+		last := items[len(items)-1]
+		nextCursor = encodeCursor(store.Cursor{CreatedAt: last.LastActivityAt, ID: last.ID})
+	}
+
+	conversations := make([]fiber.Map, len(items))
+	for i, item := range items {
+		conversations[i] = conversationItem(item)
+	}
+	return c.JSON(fiber.Map{"conversations": conversations, "next_cursor": nextCursor})
+}
+
+// GetConversation shows one conversation as it appears in the caller's list
+func (h *Handler) GetConversation(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Conversation not found"})
+	}
+	return h.conversationResponse(c, fiber.StatusOK, id)
+}
+
+// conversationResponse answers with a conversation as it appears in the
+// caller's list
+func (h *Handler) conversationResponse(c *fiber.Ctx, status int, id uuid.UUID) error {
+	item, err := h.store.Conversations.Item(id, viewerID(c))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch conversation"})
+	}
+	return c.Status(status).JSON(conversationItem(*item))
+}
+
+func conversationItem(item store.ConversationItem) fiber.Map {
+	members := make([]fiber.Map, len(item.Members))
+	for i, u := range item.Members {
+		members[i] = fiber.Map{"id": u.ID, "username": u.Username, "avatar": u.Avatar, "role": u.GroupRole}
+	}
+	return fiber.Map{
+		"id":               item.ID,
+		"type":             item.Type,
+		"title":            item.Title,
+		"avatar":           item.Avatar,
+		"created_by":       item.CreatedBy,
+		"members":          members,
+		"last_message":     item.LastMessage,
+		"unread_count":     item.Unread,
+		"created_at":       item.CreatedAt,
+		"last_activity_at": item.LastActivityAt,
+	}
+}
+
+// RequireConversationMember lets only members of the conversation named by
+// the route parameter through. Anyone else gets 404, so conversation IDs
+// cannot be probed.
+func (h *Handler) RequireConversationMember(param string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := uuid.Parse(c.Params(param))
+		if err != nil {
+			return c.Status(404).JSON(fiber.Map{"error": "Conversation not found"})
+		}
+		member, err := h.store.Conversations.IsMember(id, viewerID(c))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to check conversation access"})
+		}
+		if !member {
+			return c.Status(404).JSON(fiber.Map{"error": "Conversation not found"})
+		}
+		return c.Next()
+	}
+}
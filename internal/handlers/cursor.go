@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+	"github.com/google/uuid"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// cursorPayload is what an opaque cursor decodes to. Clients must treat the
+// encoded string as a token and never build one themselves.
+type cursorPayload struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"i"`
+}
+
+func encodeCursor(cursor store.Cursor) string {
+	b, _ := json.Marshal(cursorPayload{CreatedAt: cursor.CreatedAt, ID: cursor.ID})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor returns nil for an empty string, meaning the first page
+func decodeCursor(s string) (*store.Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var payload cursorPayload
+	if err := json.Unmarshal(b, &payload); err != nil || payload.ID == uuid.Nil {
+		return nil, errInvalidCursor
+	}
+	return &store.Cursor{CreatedAt: payload.CreatedAt, ID: payload.ID}, nil
+}
+
+// pageLimit reads ?limit= clamped to [1, max]
+func pageLimit(limit, max int) int {
+	if limit < 1 {
+		return 1
+	}
+	if limit > max {
+		return max
+	}
+	return limit
+}
@@ -1,47 +1,30 @@
 package handlers
 
 import (
-	"strings"
-
-	db "github.com/am4rknvl/local-micro-blogging-service.git/internal/database"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/trending"
 	"github.com/gofiber/fiber/v2"
 )
 
-func SearchUsers(c *fiber.Ctx) error {
-	query := strings.ToLower(c.Query("q"))
-	query = "%" + query + "%"
-
-	rows, err := db.DB.Raw(`SELECT id, username, bio FROM users WHERE LOWER(username) LIKE ? LIMIT 20`, query).Rows()
-	if err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Search failed")
-	}
-	defer rows.Close()
-
-	var results []fiber.Map
-	for rows.Next() {
-		var id, username, bio string
-		rows.Scan(&id, &username, &bio)
-		results = append(results, fiber.Map{
-			"id":       id,
-			"username": username,
-			"bio":      bio,
-		})
+// TrendingPosts serves the ranking the trending job last computed for
+// ?window=1h|24h|7d
+func (h *Handler) TrendingPosts(c *fiber.Ctx) error {
+	window := c.Query("window", trending.DefaultWindow)
+	if _, ok := trending.Windows[window]; !ok {
+		return fiber.NewError(fiber.StatusBadRequest, "window must be one of 1h, 24h, 7d")
 	}
-	return c.JSON(results)
-}
+	limit := pageLimit(c.QueryInt("limit", 10), trending.MaxEntries)
 
-func TrendingPosts(c *fiber.Ctx) error {
-	rows, err := db.DB.Raw(`SELECT id, content FROM trending_posts LIMIT 10`).Rows()
+	items, err := h.store.Trending.Page(window, limit, viewerID(c))
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Trending query failed")
 	}
-	defer rows.Close()
 
-	var posts []fiber.Map
-	for rows.Next() {
-		var id, content string
-		rows.Scan(&id, &content)
-		posts = append(posts, fiber.Map{"id": id, "content": content})
+	posts := make([]fiber.Map, 0, len(items))
+	for _, item := range items {
+		post := feedItem(item.FeedItem)
+		post["rank"] = item.Rank
+		post["hot"] = item.Hot
+		posts = append(posts, post)
 	}
-	return c.JSON(posts)
+	return c.JSON(fiber.Map{"window": window, "posts": posts})
 }
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/config"
+	db "github.com/am4rknvl/local-micro-blogging-service.git/internal/database"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/search"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testEnv is a handler over a fresh in-memory SQLite store, searched by the
+// in-process index, as the service runs locally
+type testEnv struct {
+	db    *gorm.DB
+	store *store.Store
+	h     *Handler
+}
+
+var testDBs atomic.Int64
+
+func newTestEnv(tb testing.TB) *testEnv {
+	tb.Helper()
+	conn, err := db.Open(config.DatabaseConfig{
+		Driver:       db.DriverSQLite,
+		DSN:          fmt.Sprintf("file:test%d?mode=memory&cache=shared", testDBs.Add(1)),
+		MaxOpenConns: 1,
+		MaxIdleConns: 1, // an in-memory database lives as long as its connection
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	conn.Logger = logger.Discard // lookups that find nothing are expected
+	tb.Cleanup(func() {
+		if sqlDB, err := conn.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	s := store.New(conn)
+	if err := s.Migrate(); err != nil {
+		tb.Fatal(err)
+	}
+	cfg := config.Default()
+	searcher, err := search.New(cfg.Search, db.DriverSQLite, conn, s.Search)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return &testEnv{db: conn, store: s, h: New(s, cfg, nil, nil, searcher)}
+}
+
+// users stores n verified accounts
+func (env *testEnv) users(tb testing.TB, n int) []models.User {
+	tb.Helper()
+	users := make([]models.User, n)
+	for i := range users {
+		id := uuid.New()
+		users[i] = models.User{ID: id, Username: "u" + id.String()[:12], Email: id.String() + "@example.com", EmailVerified: true, Role: models.RoleUser}
+	}
+	if err := env.db.CreateInBatches(users, 200).Error; err != nil {
+		tb.Fatal(err)
+	}
+	return users
+}
+
+func (env *testEnv) post(tb testing.TB, author uuid.UUID, title, content string) models.Post {
+	tb.Helper()
+	post := models.Post{ID: uuid.New(), UserID: author, Title: title, Content: content}
+	if err := env.store.Posts.Create(&post); err != nil {
+		tb.Fatal(err)
+	}
+	return post
+}
+
+// serve runs one request as viewer through handler, mounted on route, and
+// returns the status and body
+func (env *testEnv) serve(tb testing.TB, method, route, path string, viewer uuid.UUID, body string, handler fiber.Handler) (int, string) {
+	tb.Helper()
+	app := fiber.New()
+	app.Add(method, route, func(c *fiber.Ctx) error {
+		c.Locals("userID", viewer.String())
+		return c.Next()
+	}, handler)
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return resp.StatusCode, string(data)
+}
@@ -1,16 +1,16 @@
 package handlers
 
 import (
+	"log"
 	"time"
 
 	"github.com/google/uuid"
-	db "github.com/am4rknvl/local-micro-blogging-service.git/internal/database"
 	"github.com/gofiber/fiber/v2"
 	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
 )
 
 // FollowUser lets the authenticated user follow another user
-func FollowUser(c *fiber.Ctx) error {
+func (h *Handler) FollowUser(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)   // current user
 	followeeID := c.Params("id")            // user to follow
 
@@ -18,29 +18,53 @@ func FollowUser(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot follow yourself"})
 	}
 
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	fid, err := uuid.Parse(followeeID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	blocked, err := h.blockedWith(c, fid)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to follow user"})
+	}
+	if blocked {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Cannot follow this user"})
+	}
+
 	// Check if already following
-	var existing models.Follow
-	err := db.DB.Where("follower_id = ? AND followee_id = ?", userID, followeeID).First(&existing).Error
-	if err == nil {
+	exists, err := h.store.Follows.Exists(uid, fid)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to follow user"})
+	}
+	if exists {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Already following"})
 	}
 
 	follow := models.Follow{
 		ID:         uuid.New(),
-		FollowerID: uuid.MustParse(userID),
-		FolloweeID: uuid.MustParse(followeeID),
+		FollowerID: uid,
+		FolloweeID: fid,
 		CreatedAt:  time.Now(),
 	}
 
-	if err := db.DB.Create(&follow).Error; err != nil {
+	if err := h.store.Follows.Create(&follow); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to follow user"})
 	}
 
+	if err := h.store.Timelines.Backfill(uid, fid, h.cfg.Timeline.BackfillLimit); err != nil {
+		log.Println("timeline backfill failed:", err)
+	}
+	h.notify(fid, uid, models.NotifyFollow, "", "")
+
 	return c.JSON(fiber.Map{"message": "Successfully followed user"})
 }
 
 // UnfollowUser lets the authenticated user unfollow another user
-func UnfollowUser(c *fiber.Ctx) error {
+func (h *Handler) UnfollowUser(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)   // current user
 	followeeID := c.Params("id")            // user to unfollow
 
@@ -48,25 +72,34 @@ func UnfollowUser(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot unfollow yourself"})
 	}
 
-	err := db.DB.Where("follower_id = ? AND followee_id = ?", userID, followeeID).Delete(&models.Follow{}).Error
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	fid, err := uuid.Parse(followeeID)
 	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	if err := h.store.Follows.Delete(uid, fid); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to unfollow user"})
 	}
 
+	if err := h.store.Timelines.RemoveAuthor(uid, fid); err != nil {
+		log.Println("timeline cleanup failed:", err)
+	}
+
 	return c.JSON(fiber.Map{"message": "Successfully unfollowed user"})
 }
 
 // GetFollowers returns a list of users who follow the given user
-func GetFollowers(c *fiber.Ctx) error {
-	userID := c.Params("id")
-
-	var followers []models.User
-	err := db.DB.Raw(`
-		SELECT u.* FROM users u
-		JOIN follows f ON f.follower_id = u.id
-		WHERE f.followee_id = ?
-	`, userID).Scan(&followers).Error
+func (h *Handler) GetFollowers(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
 
+	followers, err := h.store.Follows.Followers(userID, viewerID(c))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get followers"})
 	}
@@ -75,16 +108,13 @@ func GetFollowers(c *fiber.Ctx) error {
 }
 
 // GetFollowing returns a list of users the given user is following
-func GetFollowing(c *fiber.Ctx) error {
-	userID := c.Params("id")
-
-	var following []models.User
-	err := db.DB.Raw(`
-		SELECT u.* FROM users u
-		JOIN follows f ON f.followee_id = u.id
-		WHERE f.follower_id = ?
-	`, userID).Scan(&following).Error
+func (h *Handler) GetFollowing(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
 
+	following, err := h.store.Follows.Following(userID, viewerID(c))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get following"})
 	}
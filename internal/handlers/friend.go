@@ -1,14 +1,18 @@
 package handlers
 
 import (
+	"errors"
 	"log"
+	"strconv"
 
-	db "github.com/am4rknvl/local-micro-blogging-service.git/internal/database"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 )
 
-func SendFriendRequest(c *fiber.Ctx) error {
-	senderID := c.Get("X-User-ID") // adjust if you use middleware Locals("userID")
+func (h *Handler) SendFriendRequest(c *fiber.Ctx) error {
+	senderID := c.Locals("userID").(string)
 
 	var payload struct {
 		ReceiverID string `json:"receiver_id"`
@@ -18,15 +22,29 @@ func SendFriendRequest(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
 	}
 
-	err := db.DB.Exec(`INSERT INTO friend_requests (sender_id, receiver_id) VALUES (?, ?)`, senderID, payload.ReceiverID).Error
+	receiverID, err := uuid.Parse(payload.ReceiverID)
+	if err != nil || payload.ReceiverID == senderID {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid receiver")
+	}
+
+	blocked, err := h.blockedWith(c, receiverID)
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Could not send request")
 	}
+	if blocked {
+		return fiber.NewError(fiber.StatusForbidden, "Cannot send a friend request to this user")
+	}
+
+	request, err := h.store.Friends.CreateRequest(senderID, payload.ReceiverID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Could not send request")
+	}
+	h.notify(receiverID, viewerID(c), models.NotifyFriendRequest, models.EntityFriendRequest, strconv.Itoa(request.ID))
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Friend request sent"})
 }
 
-func RespondToFriendRequest(c *fiber.Ctx) error {
+func (h *Handler) RespondToFriendRequest(c *fiber.Ctx) error {
 	var payload struct {
 		RequestID int    `json:"request_id"`
 		Action    string `json:"action"` // accept or reject
@@ -36,68 +54,60 @@ func RespondToFriendRequest(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
 	}
 
-	var friendRequest struct {
-		SenderID   string `gorm:"column:sender_id"`
-		ReceiverID string `gorm:"column:receiver_id"`
-	}
-
-	err := db.DB.Table("friend_requests").Where("id = ?", payload.RequestID).First(&friendRequest).Error
-	if err != nil {
+	friendRequest, err := h.store.Friends.GetRequest(payload.RequestID)
+	if err != nil || friendRequest.ReceiverID != c.Locals("userID").(string) {
 		return fiber.NewError(fiber.StatusNotFound, "Request not found")
 	}
-
-	senderID := friendRequest.SenderID
-	receiverID := friendRequest.ReceiverID
+	if friendRequest.Status != "pending" {
+		return fiber.NewError(fiber.StatusConflict, "Request already answered")
+	}
 
 	if payload.Action == "accept" {
-		_ = db.DB.Exec(`UPDATE friend_requests SET status='accepted' WHERE id=?`, payload.RequestID)
-		_ = db.DB.Exec(`INSERT INTO friends (user1_id, user2_id) VALUES (?, ?)`, senderID, receiverID)
-
-		// Auto-follow both directions
-		_ = db.DB.Exec(`
-			INSERT INTO follows (id, follower_id, followee_id, created_at)
-			SELECT gen_random_uuid(), ?, ?, NOW()
-			WHERE NOT EXISTS (
-				SELECT 1 FROM follows WHERE follower_id=? AND followee_id=?
-			)
-		`, senderID, receiverID, senderID, receiverID)
-
-		_ = db.DB.Exec(`
-			INSERT INTO follows (id, follower_id, followee_id, created_at)
-			SELECT gen_random_uuid(), ?, ?, NOW()
-			WHERE NOT EXISTS (
-				SELECT 1 FROM follows WHERE follower_id=? AND followee_id=?
-			)
-		`, receiverID, senderID, receiverID, senderID)
+		senderID, err := uuid.Parse(friendRequest.SenderID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid sender")
+		}
+		blocked, err := h.blockedWith(c, senderID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Could not accept request")
+		}
+		if blocked {
+			return fiber.NewError(fiber.StatusForbidden, "Cannot accept a request from this user")
+		}
+
+		// Marks accepted, records the friendship and auto-follows both directions
+		if err := h.store.Friends.Accept(friendRequest); err != nil {
+			if errors.Is(err, store.ErrNotPending) {
+				return fiber.NewError(fiber.StatusConflict, "Request already answered")
+			}
+			log.Println("accept friend request failed:", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "Could not accept request")
+		}
+		receiverID := viewerID(c)
+		for _, pair := range [][2]uuid.UUID{{senderID, receiverID}, {receiverID, senderID}} {
+			if err := h.store.Timelines.Backfill(pair[0], pair[1], h.cfg.Timeline.BackfillLimit); err != nil {
+				log.Println("timeline backfill failed:", err)
+			}
+		}
+		h.notify(senderID, receiverID, models.NotifyFriendAccept, "", "")
 
 		return c.JSON(fiber.Map{"message": "Friend request accepted"})
 	}
 
 	// Rejected path, just update status
-	_ = db.DB.Exec(`UPDATE friend_requests SET status='rejected' WHERE id=?`, payload.RequestID)
+	if err := h.store.Friends.Reject(payload.RequestID); err != nil {
+		if errors.Is(err, store.ErrNotPending) {
+			return fiber.NewError(fiber.StatusConflict, "Request already answered")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "Could not reject request")
+	}
 	return c.JSON(fiber.Map{"message": "Friend request rejected"})
 }
 
-func GetFriendRequests(c *fiber.Ctx) error {
+func (h *Handler) GetFriendRequests(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 
-	type FriendRequestInfo struct {
-		ID          int    `json:"id"`
-		SenderID    string `json:"sender_id"`
-		Username    string `json:"username"`
-		Avatar      string `json:"avatar"`
-		RequestedAt string `json:"created_at"`
-	}
-
-	var requests []FriendRequestInfo
-
-	err := db.DB.Raw(`
-		SELECT fr.id, u.id as sender_id, u.username, u.avatar, fr.created_at
-		FROM friend_requests fr
-		JOIN users u ON u.id = fr.sender_id
-		WHERE fr.receiver_id = ? AND fr.status = 'pending'
-	`, userID).Scan(&requests).Error
-
+	requests, err := h.store.Friends.Pending(userID)
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load friend requests")
 	}
@@ -105,54 +115,43 @@ func GetFriendRequests(c *fiber.Ctx) error {
 	return c.JSON(requests)
 }
 
-func GetFriendTree(c *fiber.Ctx) error {
+func (h *Handler) GetFriendTree(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 
-	query := `
-		SELECT u.id, u.username, u.avatar
-		FROM follows f1
-		JOIN follows f2 ON f1.follower_id = f2.following_id AND f1.following_id = f2.follower_id
-		JOIN users u ON u.id = f1.following_id
-		WHERE f1.follower_id = ?
-	`
+	friends, err := h.store.Friends.Mutuals(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "DB error"})
+	}
 
-	rows, err := db.DB.Raw(query, userID).Rows()
+	// Everyone's mutuals in one query rather than one per friend
+	friendIDs := make([]uuid.UUID, len(friends))
+	for i, friend := range friends {
+		friendIDs[i] = friend.ID
+	}
+	mutualsOf, err := h.store.Friends.MutualsOf(friendIDs)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "DB error"})
 	}
-	defer rows.Close()
 
 	friendTree := []fiber.Map{}
 
-	for rows.Next() {
-		var friendID, friendUsername, friendAvatar string
-		if err := rows.Scan(&friendID, &friendUsername, &friendAvatar); err != nil {
-			continue
-		}
-
-		mutualRows, err := db.DB.Raw(query, friendID).Rows()
-		if err != nil {
-			log.Println("mutuals query error:", err)
-			continue
-		}
-
+	for _, friend := range friends {
 		var mutuals []fiber.Map
-		for mutualRows.Next() {
-			var mid, mname, mavatar string
-			if err := mutualRows.Scan(&mid, &mname, &mavatar); err == nil && mid != userID {
-				mutuals = append(mutuals, fiber.Map{
-					"id":       mid,
-					"username": mname,
-					"avatar":   mavatar,
-				})
+		for _, m := range mutualsOf[friend.ID] {
+			if m.ID.String() == userID {
+				continue
 			}
+			mutuals = append(mutuals, fiber.Map{
+				"id":       m.ID,
+				"username": m.Username,
+				"avatar":   m.Avatar,
+			})
 		}
-		mutualRows.Close()
 
 		friendTree = append(friendTree, fiber.Map{
-			"id":       friendID,
-			"username": friendUsername,
-			"avatar":   friendAvatar,
+			"id":       friend.ID,
+			"username": friend.Username,
+			"avatar":   friend.Avatar,
 			"mutuals":  mutuals,
 		})
 	}
@@ -163,33 +162,21 @@ func GetFriendTree(c *fiber.Ctx) error {
 	})
 }
 
-func GetFriends(c *fiber.Ctx) error {
+func (h *Handler) GetFriends(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 
-	query := `
-		SELECT u.id, u.username, u.avatar
-		FROM follows f1
-		JOIN follows f2 ON f1.follower_id = f2.following_id AND f1.following_id = f2.follower_id
-		JOIN users u ON u.id = f1.following_id
-		WHERE f1.follower_id = ?
-	`
-
-	rows, err := db.DB.Raw(query, userID).Rows()
+	friends, err := h.store.Friends.Mutuals(userID)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "DB error"})
 	}
-	defer rows.Close()
 
-	var friends []fiber.Map
-	for rows.Next() {
-		var id, username, avatar string
-		if err := rows.Scan(&id, &username, &avatar); err == nil {
-			friends = append(friends, fiber.Map{
-				"id":       id,
-				"username": username,
-				"avatar":   avatar,
-			})
-		}
+	var result []fiber.Map
+	for _, friend := range friends {
+		result = append(result, fiber.Map{
+			"id":       friend.ID,
+			"username": friend.Username,
+			"avatar":   friend.Avatar,
+		})
 	}
-	return c.JSON(fiber.Map{"friends": friends})
+	return c.JSON(fiber.Map{"friends": result})
 }
@@ -0,0 +1,546 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/auth"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/policy"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/ws"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// How long an invite link works unless the group says otherwise, and at most
+const (
+	defaultInviteHours = 7 * 24
+	maxInviteHours     = 30 * 24
+)
+
+// UpdateGroup changes the sent fields of a group's title and avatar. An
+// empty string clears one. Owner and admins only.
+func (h *Handler) UpdateGroup(c *fiber.Ctx) error {
+	conv, member, err := h.groupMember(c)
+	if conv == nil {
+		return err
+	}
+	if !policy.CanManageGroup(member) {
+		return c.Status(403).JSON(fiber.Map{"error": "Only the owner and admins can change the group"})
+	}
+
+	var input struct {
+		Title  *string `json:"title"`
+		Avatar *string `json:"avatar"`
+	}
+	if err := parseStrict(c, &input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	title, avatar := conv.Title, conv.Avatar
+	if input.Title != nil {
+		title = strings.TrimSpace(*input.Title)
+	}
+	if input.Avatar != nil {
+		avatar = strings.TrimSpace(*input.Avatar)
+	}
+	if msg := validateGroup(title, avatar); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	var changes []string
+	switch {
+	case title == conv.Title:
+	case title == "":
+		changes = append(changes, "removed the group name")
+	default:
+		changes = append(changes, "renamed the group to "+title)
+	}
+	switch {
+	case avatar == conv.Avatar:
+	case avatar == "":
+		changes = append(changes, "removed the group photo")
+	default:
+		changes = append(changes, "changed the group photo")
+	}
+	if len(changes) == 0 {
+		return h.conversationResponse(c, fiber.StatusOK, conv.ID)
+	}
+
+	conv.Title, conv.Avatar = title, avatar
+	if err := h.store.Conversations.Update(conv); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update conversation"})
+	}
+	names := h.usernames(member.UserID)
+	for _, change := range changes {
+		h.systemMessage(conv.ID, member.UserID, name(names, member.UserID)+" "+change)
+	}
+	return h.conversationResponse(c, fiber.StatusOK, conv.ID)
+}
+
+// AddGroupMembers adds user_ids to a group as plain members. Users already
+// in it are skipped. Owner and admins only.
+func (h *Handler) AddGroupMembers(c *fiber.Ctx) error {
+	conv, member, err := h.groupMember(c)
+	if conv == nil {
+		return err
+	}
+	if !policy.CanManageGroup(member) {
+		return c.Status(403).JSON(fiber.Map{"error": "Only the owner and admins can add members"})
+	}
+
+	var input struct {
+		UserIDs []uuid.UUID `json:"user_ids"`
+	}
+	if err := parseStrict(c, &input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	if len(input.UserIDs) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "user_ids must name at least one user"})
+	}
+
+	current, err := h.store.Conversations.MemberIDs(conv.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to add members"})
+	}
+	seen := make(map[uuid.UUID]bool, len(current))
+	for _, id := range current {
+		seen[id] = true
+	}
+	var fresh []uuid.UUID
+	for _, id := range input.UserIDs {
+		if !seen[id] {
+			seen[id] = true
+			fresh = append(fresh, id)
+		}
+	}
+	if len(fresh) == 0 {
+		return h.conversationResponse(c, fiber.StatusOK, conv.ID)
+	}
+	if len(current)+len(fresh) > maxConversationMembers {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("A conversation can have at most %d members", maxConversationMembers)})
+	}
+
+	users, err := h.store.Users.GetByIDs(fresh)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to add members"})
+	}
+	if len(users) != len(fresh) {
+		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	added, err := h.store.Conversations.AddMembers(conv.ID, fresh, time.Now())
+	if err != nil {
+		log.Println("add conversation members failed:", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to add members"})
+	}
+	if len(added) > 0 {
+		names := h.usernames(append([]uuid.UUID{member.UserID}, added...)...)
+		addedNames := make([]string, len(added))
+		for i, id := range added {
+			addedNames[i] = name(names, id)
+		}
+		h.systemMessage(conv.ID, member.UserID, name(names, member.UserID)+" added "+joinNames(addedNames))
+		for _, id := range added {
+			h.pushConversation(conv.ID, id)
+		}
+	}
+	return h.conversationResponse(c, fiber.StatusOK, conv.ID)
+}
+
+// RemoveGroupMember takes a member out of a group. The owner may remove
+// anyone and admins plain members; removing yourself is leaving.
+func (h *Handler) RemoveGroupMember(c *fiber.Ctx) error {
+	conv, member, err := h.groupMember(c)
+	if conv == nil {
+		return err
+	}
+	target, err := h.targetMember(c, conv)
+	if target == nil {
+		return err
+	}
+	if target.UserID == member.UserID {
+		return h.leaveGroup(c, conv, member)
+	}
+	if !policy.CanRemoveMember(member, target) {
+		return c.Status(403).JSON(fiber.Map{"error": "You cannot remove this member"})
+	}
+
+	if _, err := h.store.Conversations.RemoveMember(conv.ID, target.UserID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": "Member not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to remove member"})
+	}
+	names := h.usernames(member.UserID, target.UserID)
+	h.systemMessage(conv.ID, member.UserID, name(names, member.UserID)+" removed "+name(names, target.UserID))
+	dropMember(conv.ID, target.UserID)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// LeaveGroup takes the caller out of a group. An owner who leaves hands the
+// group to the longest-standing admin, or else member; the last one to
+// leave deletes it.
+func (h *Handler) LeaveGroup(c *fiber.Ctx) error {
+	conv, member, err := h.groupMember(c)
+	if conv == nil {
+		return err
+	}
+	return h.leaveGroup(c, conv, member)
+}
+
+func (h *Handler) leaveGroup(c *fiber.Ctx, conv *models.Conversation, member *models.ConversationMember) error {
+	newOwner, err := h.store.Conversations.RemoveMember(conv.ID, member.UserID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": "Conversation not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to leave conversation"})
+	}
+
+	if _, err := h.store.Conversations.Get(conv.ID); err == nil {
+		ids := []uuid.UUID{member.UserID}
+		if newOwner != nil {
+			ids = append(ids, newOwner.UserID)
+		}
+		names := h.usernames(ids...)
+		h.systemMessage(conv.ID, member.UserID, name(names, member.UserID)+" left")
+		if newOwner != nil {
+			h.systemMessage(conv.ID, newOwner.UserID, name(names, newOwner.UserID)+" is now the owner")
+		}
+	}
+	dropMember(conv.ID, member.UserID)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// SetGroupRole makes a member an admin or a plain member, or hands them the
+// group, which leaves the previous owner an admin. Owner only.
+func (h *Handler) SetGroupRole(c *fiber.Ctx) error {
+	conv, member, err := h.groupMember(c)
+	if conv == nil {
+		return err
+	}
+
+	var input struct {
+		Role string `json:"role"`
+	}
+	if err := parseStrict(c, &input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	if !policy.ValidGroupRole(input.Role) {
+		return c.Status(400).JSON(fiber.Map{"error": "role must be owner, admin or member"})
+	}
+
+	target, err := h.targetMember(c, conv)
+	if target == nil {
+		return err
+	}
+	if !policy.CanChangeGroupRole(member, target) {
+		return c.Status(403).JSON(fiber.Map{"error": "Only the owner can change roles"})
+	}
+	if target.Role == input.Role {
+		return h.conversationResponse(c, fiber.StatusOK, conv.ID)
+	}
+
+	var change string
+	switch input.Role {
+	case models.GroupOwner:
+		err = h.store.Conversations.TransferOwnership(conv.ID, member.UserID, target.UserID)
+		change = "made %s the owner"
+	case models.GroupAdmin:
+		err = h.store.Conversations.SetRole(conv.ID, target.UserID, input.Role)
+		change = "made %s an admin"
+	default:
+		err = h.store.Conversations.SetRole(conv.ID, target.UserID, input.Role)
+		change = "removed %s as an admin"
+	}
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": "Member not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to change role"})
+	}
+	names := h.usernames(member.UserID, target.UserID)
+	h.systemMessage(conv.ID, member.UserID, name(names, member.UserID)+" "+fmt.Sprintf(change, name(names, target.UserID)))
+	return h.conversationResponse(c, fiber.StatusOK, conv.ID)
+}
+
+// CreateGroupInvite makes a link anyone can join the group with until it
+// expires, after expires_in_hours (a week by default, 30 days at most), or
+// is revoked. The code is only shown here. Owner and admins only.
+func (h *Handler) CreateGroupInvite(c *fiber.Ctx) error {
+	conv, member, err := h.groupMember(c)
+	if conv == nil {
+		return err
+	}
+	if !policy.CanManageGroup(member) {
+		return c.Status(403).JSON(fiber.Map{"error": "Only the owner and admins can invite"})
+	}
+
+	var input struct {
+		ExpiresInHours *int `json:"expires_in_hours"`
+	}
+	if len(c.Body()) > 0 {
+		if err := parseStrict(c, &input); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
+		}
+	}
+	hours := defaultInviteHours
+	if input.ExpiresInHours != nil {
+		hours = *input.ExpiresInHours
+	}
+	if hours < 1 || hours > maxInviteHours {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("expires_in_hours must be between 1 and %d", maxInviteHours)})
+	}
+
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not create invite"})
+	}
+	now := time.Now()
+	invite := models.ConversationInvite{
+		ID:             uuid.New(),
+		ConversationID: conv.ID,
+		TokenHash:      hash,
+		CreatedBy:      member.UserID,
+		ExpiresAt:      now.Add(time.Duration(hours) * time.Hour),
+		CreatedAt:      now,
+	}
+	if err := h.store.Conversations.CreateInvite(&invite); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not create invite"})
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"id":         invite.ID,
+		"code":       token,
+		"url":        fmt.Sprintf("%s/conversations/join/%s", h.cfg.Server.PublicURL, token),
+		"created_by": invite.CreatedBy,
+		"expires_at": invite.ExpiresAt,
+		"created_at": invite.CreatedAt,
+	})
+}
+
+// GetGroupInvites lists the group's invites that still work, without their
+// codes. Owner and admins only.
+func (h *Handler) GetGroupInvites(c *fiber.Ctx) error {
+	conv, member, err := h.groupMember(c)
+	if conv == nil {
+		return err
+	}
+	if !policy.CanManageGroup(member) {
+		return c.Status(403).JSON(fiber.Map{"error": "Only the owner and admins can see invites"})
+	}
+
+	invites, err := h.store.Conversations.Invites(conv.ID, time.Now())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch invites"})
+	}
+	return c.JSON(fiber.Map{"invites": invites})
+}
+
+// RevokeGroupInvite stops an invite link from working. Owner and admins
+// only.
+func (h *Handler) RevokeGroupInvite(c *fiber.Ctx) error {
+	conv, member, err := h.groupMember(c)
+	if conv == nil {
+		return err
+	}
+	if !policy.CanManageGroup(member) {
+		return c.Status(403).JSON(fiber.Map{"error": "Only the owner and admins can revoke invites"})
+	}
+
+	inviteID, err := uuid.Parse(c.Params("inviteId"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Invite not found"})
+	}
+	if err := h.store.Conversations.RevokeInvite(conv.ID, inviteID, time.Now()); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": "Invite not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to revoke invite"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// JoinGroup adds the caller to the group an invite code belongs to. Joining
+// a group you are already in just returns it; expired and revoked codes
+// answer 410.
+func (h *Handler) JoinGroup(c *fiber.Ctx) error {
+	userID := viewerID(c)
+
+	invite, err := h.store.Conversations.Invite(auth.HashToken(c.Params("code")))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": "Invite not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to join conversation"})
+	}
+	if invite.RevokedAt != nil || !time.Now().Before(invite.ExpiresAt) {
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{"error": "This invite has expired"})
+	}
+	conv, err := h.store.Conversations.Get(invite.ConversationID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": "Invite not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to join conversation"})
+	}
+
+	members, err := h.store.Conversations.MemberIDs(conv.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to join conversation"})
+	}
+	for _, id := range members {
+		if id == userID {
+			return h.conversationResponse(c, fiber.StatusOK, conv.ID)
+		}
+	}
+	if len(members) >= maxConversationMembers {
+		return c.Status(409).JSON(fiber.Map{"error": "This group is full"})
+	}
+
+	added, err := h.store.Conversations.AddMembers(conv.ID, []uuid.UUID{userID}, time.Now())
+	if err != nil {
+		log.Println("join conversation failed:", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to join conversation"})
+	}
+	if len(added) > 0 {
+		names := h.usernames(userID)
+		h.systemMessage(conv.ID, userID, name(names, userID)+" joined with an invite link")
+	}
+	return h.conversationResponse(c, fiber.StatusOK, conv.ID)
+}
+
+// groupMember loads the group named by the route's :id and the caller's
+// membership of it. On failure it has already written the response and
+// returns a nil conversation.
+func (h *Handler) groupMember(c *fiber.Ctx) (*models.Conversation, *models.ConversationMember, error) {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, nil, c.Status(404).JSON(fiber.Map{"error": "Conversation not found"})
+	}
+	conv, err := h.store.Conversations.Get(id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, nil, c.Status(404).JSON(fiber.Map{"error": "Conversation not found"})
+		}
+		return nil, nil, c.Status(500).JSON(fiber.Map{"error": "Failed to fetch conversation"})
+	}
+	member, err := h.store.Conversations.Member(id, viewerID(c))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, nil, c.Status(404).JSON(fiber.Map{"error": "Conversation not found"})
+		}
+		return nil, nil, c.Status(500).JSON(fiber.Map{"error": "Failed to fetch conversation"})
+	}
+	if conv.Type != models.ConversationGroup {
+		return nil, nil, c.Status(400).JSON(fiber.Map{"error": "Only group conversations can be managed"})
+	}
+	return conv, member, nil
+}
+
+// targetMember loads the member named by the route's :userId. On failure
+// it has already written the response and returns nil.
+func (h *Handler) targetMember(c *fiber.Ctx, conv *models.Conversation) (*models.ConversationMember, error) {
+	id, err := uuid.Parse(c.Params("userId"))
+	if err != nil {
+		return nil, c.Status(404).JSON(fiber.Map{"error": "Member not found"})
+	}
+	member, err := h.store.Conversations.Member(conv.ID, id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, c.Status(404).JSON(fiber.Map{"error": "Member not found"})
+		}
+		return nil, c.Status(500).JSON(fiber.Map{"error": "Failed to fetch member"})
+	}
+	return member, nil
+}
+
+// validateGroup checks a group's title and avatar and says what is wrong
+// with them, if anything
+func validateGroup(title, avatar string) string {
+	if len(title) > 100 {
+		return "title must be at most 100 characters"
+	}
+	if avatar == "" {
+		return ""
+	}
+	u, err := url.Parse(avatar)
+	if err != nil || len(avatar) > 255 || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "avatar must be an http or https URL of at most 255 characters"
+	}
+	return ""
+}
+
+// systemMessage records a change to a group in its message stream, sent by
+// the member who made it, and broadcasts it to the open chats
+func (h *Handler) systemMessage(conversationID, actor uuid.UUID, text string) {
+	msg := &models.Message{
+		ConversationID: conversationID.String(),
+		SenderID:       actor.String(),
+		Content:        text,
+		Type:           models.MessageSystem,
+	}
+	if err := h.store.Messages.Create(msg); err != nil {
+		log.Println("system message failed:", err)
+		return
+	}
+	h.broadcastMessage(msg)
+}
+
+// dropMember closes a former member's chats of the conversation and tells
+// their other connections they are out of it
+func dropMember(conversationID, userID uuid.UUID) {
+	// Unlike events a kick is never dropped; the queue only fills if the
+	// manager stalls
+	ws.ManagerInstance.Kick <- ws.MemberPayload{ConversationID: conversationID.String(), UserID: userID.String()}
+	push(userID, fiber.Map{"type": eventConversationLeft, "conversation_id": conversationID})
+}
+
+// pushConversation tells a new member about the conversation they are in
+func (h *Handler) pushConversation(conversationID, userID uuid.UUID) {
+	if !ws.ManagerInstance.Online(userID.String()) {
+		return
+	}
+	item, err := h.store.Conversations.Item(conversationID, userID)
+	if err != nil {
+		log.Println("push conversation failed:", err)
+		return
+	}
+	push(userID, fiber.Map{"type": eventConversation, "conversation": conversationItem(*item)})
+}
+
+// usernames looks up the names system messages refer to users by. A failed
+// lookup is logged and leaves them out.
+func (h *Handler) usernames(ids ...uuid.UUID) map[uuid.UUID]string {
+	names := make(map[uuid.UUID]string, len(ids))
+	users, err := h.store.Users.GetByIDs(ids)
+	if err != nil {
+		log.Println("username lookup failed:", err)
+		return names
+	}
+	for _, u := range users {
+		names[u.ID] = u.Username
+	}
+	return names
+}
+
+// name is the user's name for a system message; deleted accounts have none
+func name(names map[uuid.UUID]string, id uuid.UUID) string {
+	if n, ok := names[id]; ok {
+		return n
+	}
+	return "someone"
+}
+
+// joinNames lists names as in "a, b and c"
+func joinNames(names []string) string {
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"log"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/auth"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/config"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/mail"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/ratelimit"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/search"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+)
+
+// Handler serves the HTTP API on top of the injected storage layer
+type Handler struct {
+	store  *store.Store
+	cfg    *config.Config
+	auth   *auth.Service
+	mailer mail.Mailer
+	// searcher ranks hits; the rows behind them come from store.Search
+	searcher search.Searcher
+
+	resetLimiter  *ratelimit.Limiter
+	verifyLimiter *ratelimit.Limiter
+}
+
+func New(s *store.Store, cfg *config.Config, authService *auth.Service, mailer mail.Mailer, searcher search.Searcher) *Handler {
+	return &Handler{
+		store:         s,
+		cfg:           cfg,
+		auth:          authService,
+		mailer:        mailer,
+		searcher:      searcher,
+		resetLimiter:  ratelimit.New(cfg.PasswordReset.MaxRequests, cfg.PasswordReset.Window),
+		verifyLimiter: ratelimit.New(cfg.Verification.MaxResends, cfg.Verification.Window),
+	}
+}
+
+// sendMail delivers in the background so response times do not reveal
+// whether an email was actually sent
+func (h *Handler) sendMail(msg mail.Message) {
+	go func() {
+		if err := h.mailer.Send(msg); err != nil {
+			log.Println("mail delivery failed:", err)
+		}
+	}()
+}
@@ -1,60 +1,217 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"log"
 	"time"
-	"database/sql"
 
-	db "github.com/am4rknvl/local-micro-blogging-service.git/internal/database"
 	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/ws"
 	"github.com/gofiber/fiber/v2"
-	"strconv"
+	"github.com/google/uuid"
 )
 
-func SendMessage(c *fiber.Ctx) error {
+func (h *Handler) SendMessage(c *fiber.Ctx) error {
 	senderID := c.Locals("userID").(string)
 	convoID := c.Params("id")
 
-	var msg models.Message
-	if err := c.BodyParser(&msg); err != nil {
+	var input struct {
+		Content string `json:"content"`
+	}
+	if err := parseStrict(c, &input); err != nil || input.Content == "" {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
 	}
 
-	msg.SenderID = senderID
-	msg.ConversationID = convoID
-	msg.CreatedAt = time.Now()
+	blocked, err := h.blockedInConversation(senderID, convoID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to send message"})
+	}
+	if blocked {
+		return c.Status(403).JSON(fiber.Map{"error": "Cannot message this conversation"})
+	}
 
-	
-	if err := db.DB.Create(&msg).Error; err != nil {
+	msg := models.Message{
+		ID:             uuid.New(),
+		SenderID:       senderID,
+		ConversationID: convoID,
+		Content:        input.Content,
+		Type:           models.MessageText,
+		CreatedAt:      time.Now(),
+	}
+
+	if err := h.store.Messages.Create(&msg); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to send message"})
 	}
+	h.broadcastMessage(&msg)
+	h.notifyConversation(senderID, convoID)
 
 	return c.Status(201).JSON(msg)
 }
 
-func GetMessages(c *fiber.Ctx) error {
+// GetMessages lists a conversation's messages and marks it read for the
+// caller. Membership is checked by RequireConversationMember.
+func (h *Handler) GetMessages(c *fiber.Ctx) error {
 	convoID := c.Params("id")
 
-	var messages []models.Message
-	if err := db.DB.Where("conversation_id = ?", convoID).Order("created_at ASC").Find(&messages).Error; err != nil {
+	messages, err := h.store.Messages.ListByConversation(convoID)
+	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch messages"})
 	}
+	messages, err = h.withoutBlockedSenders(viewerID(c), messages)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch messages"})
+	}
+
+	if id, err := uuid.Parse(convoID); err == nil {
+		if err := h.store.Conversations.MarkRead(id, viewerID(c), time.Now()); err != nil {
+			log.Println("mark conversation read failed:", err)
+		}
+	}
 
 	return c.JSON(messages)
 }
 
+// SaveMessage keeps a message from the unsaved message cleanup; any member
+// of its conversation may save it
+func (h *Handler) SaveMessage(c *fiber.Ctx) error {
+	messageID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid message ID"})
+	}
 
-func SaveMessage(db *sql.DB) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		messageID, err := strconv.ParseInt(c.Params("id"), 10, 64)
-		if err != nil {
-			return c.Status(400).JSON(fiber.Map{"error": "Invalid message ID"})
+	msg, err := h.store.Messages.GetByID(messageID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": "Message not found"})
 		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save message"})
+	}
+	member, err := h.isConversationMember(msg.ConversationID, viewerID(c))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save message"})
+	}
+	if !member {
+		return c.Status(404).JSON(fiber.Map{"error": "Message not found"})
+	}
+
+	if err := h.store.Messages.MarkSaved(messageID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": "Message not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save message"})
+	}
 
-		_, err = db.Exec("UPDATE messages SET is_saved = TRUE WHERE id = $1", messageID)
+	return c.SendStatus(fiber.StatusNoContent) // 204 No Content
+}
+
+// broadcastMessage sends a stored message to the conversation's open chat
+// connections, except those of members who blocked its sender
+func (h *Handler) broadcastMessage(msg *models.Message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Println("encode message failed:", err)
+		return
+	}
+	payload := ws.MessagePayload{ConversationID: msg.ConversationID, Data: data}
+	if sender, err := uuid.Parse(msg.SenderID); err == nil && msg.Type != models.MessageSystem {
+		blockers, err := h.store.Blocks.Blockers(sender)
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "Failed to save message"})
+			log.Println("blockers lookup failed:", err)
 		}
+		for _, id := range blockers {
+			payload.Except = append(payload.Except, id.String())
+		}
+	}
+	ws.ManagerInstance.Broadcast <- payload
+}
 
-		return c.SendStatus(fiber.StatusNoContent) // 204 No Content
+// withoutBlockedSenders drops the messages viewer should not see because
+// they blocked the sender. System messages stay, as they record changes to
+// the group.
+func (h *Handler) withoutBlockedSenders(viewer uuid.UUID, messages []models.Message) ([]models.Message, error) {
+	blocked, err := h.store.Blocks.Blocked(viewer)
+	if err != nil || len(blocked) == 0 {
+		return messages, err
+	}
+	hidden := make(map[string]bool, len(blocked))
+	for _, u := range blocked {
+		hidden[u.ID.String()] = true
+	}
+
+	visible := messages[:0]
+	for _, msg := range messages {
+		if msg.Type == models.MessageSystem || !hidden[msg.SenderID] {
+			visible = append(visible, msg)
+		}
+	}
+	return visible, nil
+}
+
+// isConversationMember checks membership for a conversation ID in the
+// string form messages carry
+func (h *Handler) isConversationMember(convoID string, userID uuid.UUID) (bool, error) {
+	id, err := uuid.Parse(convoID)
+	if err != nil {
+		return false, nil
+	}
+	return h.store.Conversations.IsMember(id, userID)
+}
+
+// blockedInConversation reports whether senderID is in a block relation with
+// the other member of a direct conversation. Groups are never refused; a
+// block there only hides the blocked user's messages from the blocker.
+func (h *Handler) blockedInConversation(senderID, convoID string) (bool, error) {
+	sender, err := uuid.Parse(senderID)
+	if err != nil {
+		return false, err
+	}
+	id, err := uuid.Parse(convoID)
+	if err != nil {
+		return false, err
+	}
+	conv, err := h.store.Conversations.Get(id)
+	if err != nil {
+		return false, err
+	}
+	if conv.Type != models.ConversationDirect {
+		return false, nil
+	}
+
+	members, err := h.store.Conversations.MemberIDs(id)
+	if err != nil {
+		return false, err
+	}
+	for _, other := range members {
+		if other == sender {
+			continue
+		}
+		blocked, err := h.store.Blocks.Between(sender, other)
+		if err != nil || blocked {
+			return blocked, err
+		}
+	}
+	return false, nil
+}
+
+// notifyConversation tells the other members of the conversation that
+// senderID sent a message
+func (h *Handler) notifyConversation(senderID, convoID string) {
+	sender, err := uuid.Parse(senderID)
+	if err != nil {
+		return
+	}
+	id, err := uuid.Parse(convoID)
+	if err != nil {
+		return
+	}
+	members, err := h.store.Conversations.MemberIDs(id)
+	if err != nil {
+		log.Println("conversation members lookup failed:", err)
+		return
+	}
+	for _, member := range members {
+		h.notify(member, sender, models.NotifyMessage, models.EntityConversation, convoID)
 	}
 }
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const maxMuteWordLength = 100
+
+// CreateMute mutes an account, keyword or hashtag for the caller, optionally
+// until expires_at. Muting the same thing again updates the expiry.
+func (h *Handler) CreateMute(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	var input struct {
+		Kind      string     `json:"kind"`   // account, keyword or hashtag
+		Target    string     `json:"target"` // user ID, word or tag
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "expires_at must be in the future"})
+	}
+
+	mute := models.Mute{
+		UserID:    userID,
+		Kind:      input.Kind,
+		ExpiresAt: input.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+
+	switch input.Kind {
+	case models.MuteAccount:
+		targetID, err := uuid.Parse(input.Target)
+		if err != nil || targetID == userID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+		}
+		if _, err := h.store.Users.GetByID(targetID); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to mute"})
+		}
+		mute.TargetID = &targetID
+	case models.MuteKeyword, models.MuteHashtag:
+		word := models.NormalizeMuteWord(input.Target, input.Kind)
+		if word == "" || len(word) > maxMuteWordLength {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid mute target"})
+		}
+		mute.Word = word
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "kind must be account, keyword or hashtag"})
+	}
+
+	if err := h.store.Mutes.Create(&mute); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to mute"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(mute)
+}
+
+// ListMutes returns the caller's active mutes
+func (h *Handler) ListMutes(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	mutes, err := h.store.Mutes.Active(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch mutes"})
+	}
+	return c.JSON(mutes)
+}
+
+// DeleteMute removes one of the caller's mutes
+func (h *Handler) DeleteMute(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	muteID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid mute ID"})
+	}
+
+	if err := h.store.Mutes.Delete(userID, muteID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Mute not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to unmute"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Unmuted"})
+}
+
+// muteFilter applies a user's mutes to results that are not filtered in the
+// store, such as trending posts and notifications
+type muteFilter struct {
+	accounts map[uuid.UUID]bool
+	words    []models.Mute
+}
+
+// loadMutes returns the caller's filter; anonymous callers get an empty one
+func (h *Handler) loadMutes(c *fiber.Ctx) (*muteFilter, error) {
+	filter := &muteFilter{accounts: map[uuid.UUID]bool{}}
+
+	me := viewerID(c)
+	if me == uuid.Nil {
+		return filter, nil
+	}
+
+	mutes, err := h.store.Mutes.Active(me)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range mutes {
+		if m.TargetID != nil {
+			filter.accounts[*m.TargetID] = true
+		} else {
+			filter.words = append(filter.words, m)
+		}
+	}
+	return filter, nil
+}
+
+// hides reports whether content by authorID with the given texts is muted.
+// Words and hashtags match as whole words, like the store filter.
+func (f *muteFilter) hides(authorID uuid.UUID, texts ...string) bool {
+	if f.accounts[authorID] {
+		return true
+	}
+	for _, text := range texts {
+		for i := range f.words {
+			if f.words[i].Matches(text) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/mail"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultNotificationLimit = 20
+	maxNotificationLimit     = 100
+	// notificationActors is how many actors a notification names
+	notificationActors = 3
+	// maxMentions bounds the users one post or comment can notify
+	maxMentions = 10
+)
+
+// mentionPattern finds @username where the @ does not follow a word
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@])@([\p{L}\p{N}_]+)`)
+
+// notify records that actor did something to recipient's content. Acting on
+// your own content, or on that of someone in a block relation with you, is
+// not news. The recipient's preferences decide where it goes. Failures are
+// logged; the action itself already succeeded.
+func (h *Handler) notify(recipient, actor uuid.UUID, kind, entityType, entityID string) {
+	if recipient == actor || recipient == uuid.Nil {
+		return
+	}
+	blocked, err := h.store.Blocks.Between(recipient, actor)
+	if err != nil {
+		log.Println("notification block check failed:", err)
+		return
+	}
+	if blocked {
+		return
+	}
+	pref, err := h.store.Notifications.Preference(recipient, kind)
+	if err != nil {
+		log.Println("notification preference lookup failed:", err)
+		return
+	}
+	if pref.Off() {
+		return
+	}
+
+	n := &models.Notification{
+		UserID:     recipient,
+		ActorID:    actor,
+		Type:       kind,
+		EntityType: entityType,
+		EntityID:   entityID,
+	}
+	if err := h.store.Notifications.Notify(n); err != nil {
+		log.Println("notification failed:", err)
+		return
+	}
+
+	if pref.Push != models.DeliveryInstant && pref.Email != models.DeliveryInstant {
+		return
+	}
+	// Quiet hours hold instant delivery; held emails join the next digest
+	settings, err := h.store.Notifications.Settings(recipient)
+	if err != nil {
+		log.Println("notification settings lookup failed:", err)
+		return
+	}
+	if settings.Quiet(time.Now()) {
+		return
+	}
+	if pref.Push == models.DeliveryInstant {
+		h.pushNotification(n)
+	}
+	if pref.Email == models.DeliveryInstant {
+		h.emailNotification(n)
+	}
+}
+
+// emailNotification emails one notification to a verified address
+func (h *Handler) emailNotification(n *models.Notification) {
+	user, err := h.store.Users.GetByID(n.UserID)
+	if err != nil || !user.EmailVerified {
+		return
+	}
+	actors, err := h.store.Notifications.Actors(n.UserID, []uuid.UUID{n.ID}, notificationActors)
+	if err != nil {
+		log.Println("notification email failed:", err)
+		return
+	}
+	a := actors[n.ID]
+	if a.Count == 0 {
+		return
+	}
+	if err := h.store.Notifications.MarkEmailed([]uuid.UUID{n.ID}, time.Now()); err != nil {
+		log.Println("notification email failed:", err)
+		return
+	}
+
+	summary := n.Summary(actorNames(a), a.Count)
+	h.sendMail(mail.Message{
+		To:      user.Email,
+		Subject: summary,
+		Body: fmt.Sprintf("Hi %s,\n\n%s.\n\nSee it at %s/notifications\n\n"+
+			"Choose which notifications are emailed to you at %s/notifications/preferences\n",
+			user.Username, summary, h.cfg.Server.PublicURL, h.cfg.Server.PublicURL),
+	})
+}
+
+// notifyMentions notifies the users @mentioned in text, except those in
+// skip, who were already told about the entity some other way
+func (h *Handler) notifyMentions(actor uuid.UUID, entityType, entityID, text string, skip ...uuid.UUID) {
+	var names []string
+	seen := map[string]bool{}
+	for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		if !seen[m[1]] && len(names) < maxMentions {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	users, err := h.store.Users.GetByUsernames(names)
+	if err != nil {
+		log.Println("mention lookup failed:", err)
+		return
+	}
+	for _, u := range users {
+		if !slices.Contains(skip, u.ID) {
+			h.notify(u.ID, actor, models.NotifyMention, entityType, entityID)
+		}
+	}
+}
+
+// GetNotifications lists the caller's notifications by latest activity.
+// ?unread=true leaves out read ones; pass next_cursor back as ?cursor= for
+// the following page.
+func (h *Handler) GetNotifications(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	after, err := decodeCursor(c.Query("cursor"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid cursor"})
+	}
+	limit := pageLimit(c.QueryInt("limit", defaultNotificationLimit), maxNotificationLimit)
+
+	notifications, err := h.store.Notifications.Page(userID, after, limit+1, c.QueryBool("unread"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch notifications"})
+	}
+	nextCursor := ""
+	if len(notifications) > limit {
+		notifications = notifications[:limit]
+		last := notifications[len(notifications)-1]
+		nextCursor = encodeCursor(store.Cursor{CreatedAt: last.UpdatedAt, ID: last.ID})
+	}
+
+	ids := make([]uuid.UUID, len(notifications))
+	for i, n := range notifications {
+		ids[i] = n.ID
+	}
+	actors, err := h.store.Notifications.Actors(userID, ids, notificationActors)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch notifications"})
+	}
+	unread, err := h.store.Notifications.UnreadCount(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch notifications"})
+	}
+
+	items := make([]fiber.Map, 0, len(notifications))
+	for _, n := range notifications {
+		a := actors[n.ID]
+		if a.Count == 0 {
+			continue // actors hidden since the page was read
+		}
+		items = append(items, notificationItem(n, a))
+	}
+
+	return c.JSON(fiber.Map{
+		"notifications": items,
+		"unread_count":  unread,
+		"next_cursor":   nextCursor,
+	})
+}
+
+func notificationItem(n models.Notification, a store.NotificationActors) fiber.Map {
+	actors := make([]fiber.Map, len(a.Recent))
+	for i, u := range a.Recent {
+		actors[i] = fiber.Map{"id": u.ID, "username": u.Username, "avatar": u.Avatar}
+	}
+	return fiber.Map{
+		"id":          n.ID,
+		"type":        n.Type,
+		"entity_type": n.EntityType,
+		"entity_id":   n.EntityID,
+		"is_read":     n.IsRead,
+		"actors":      actors,
+		"actor_count": a.Count,
+		"text":        n.Summary(actorNames(a), a.Count),
+		"created_at":  n.CreatedAt,
+		"updated_at":  n.UpdatedAt,
+	}
+}
+
+// actorNames lists the usernames of a notification's recent actors
+func actorNames(a store.NotificationActors) []string {
+	names := make([]string, len(a.Recent))
+	for i, u := range a.Recent {
+		names[i] = u.Username
+	}
+	return names
+}
+
+// MarkNotificationRead marks one of the caller's notifications read
+func (h *Handler) MarkNotificationRead(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid notification ID"})
+	}
+
+	if err := h.store.Notifications.MarkRead(userID, id); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Notification not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to mark notification read"})
+	}
+	h.pushUnreadCount(userID)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// MarkAllNotificationsRead marks every unread notification of the caller read
+func (h *Handler) MarkAllNotificationsRead(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	marked, err := h.store.Notifications.MarkAllRead(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to mark notifications read"})
+	}
+	h.pushUnreadCount(userID)
+	return c.JSON(fiber.Map{"marked": marked})
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// channelInput changes the delivery of one notification type; channels
+// left out keep their setting
+type channelInput struct {
+	InApp *string `json:"in_app"`
+	Email *string `json:"email"`
+	Push  *string `json:"push"`
+}
+
+type quietHoursInput struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// preferencesInput is the body of PATCH /notifications/preferences. Quiet
+// hours with an empty start and end turn them off.
+type preferencesInput struct {
+	Preferences map[string]channelInput `json:"preferences"`
+	Timezone    *string                 `json:"timezone"`
+	QuietHours  *quietHoursInput        `json:"quiet_hours"`
+}
+
+// GetNotificationPreferences shows how each notification type reaches the
+// caller, their timezone and quiet hours
+func (h *Handler) GetNotificationPreferences(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	return h.preferencesResponse(c, userID)
+}
+
+// UpdateNotificationPreferences changes the sent fields only. In the app
+// and push take off or instant; email also takes daily, for the digest.
+func (h *Handler) UpdateNotificationPreferences(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	var input preferencesInput
+	if err := parseStrict(c, &input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	for kind := range input.Preferences {
+		if !slices.Contains(models.NotificationTypes, kind) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("Unknown notification type %q", kind)})
+		}
+	}
+
+	current, err := h.store.Notifications.Preferences(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update preferences"})
+	}
+	var changed []models.NotificationPreference
+	for _, p := range current {
+		in, ok := input.Preferences[p.Type]
+		if !ok {
+			continue
+		}
+		for _, ch := range []struct {
+			name    string
+			value   *string
+			field   *string
+			allowed []string
+		}{
+			{"in_app", in.InApp, &p.InApp, []string{models.DeliveryOff, models.DeliveryInstant}},
+			{"email", in.Email, &p.Email, []string{models.DeliveryOff, models.DeliveryInstant, models.DeliveryDaily}},
+			{"push", in.Push, &p.Push, []string{models.DeliveryOff, models.DeliveryInstant}},
+		} {
+			if ch.value == nil {
+				continue
+			}
+			if !slices.Contains(ch.allowed, *ch.value) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": fmt.Sprintf("%s must be one of %v", ch.name, ch.allowed),
+				})
+			}
+			*ch.field = *ch.value
+		}
+		changed = append(changed, p)
+	}
+
+	settings, err := h.store.Notifications.Settings(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update preferences"})
+	}
+	if input.Timezone != nil {
+		if _, err := time.LoadLocation(*input.Timezone); err != nil || *input.Timezone == "" || *input.Timezone == "Local" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "timezone must be an IANA name such as Europe/Berlin"})
+		}
+		settings.Timezone = *input.Timezone
+	}
+	if q := input.QuietHours; q != nil {
+		start, end, ok := parseQuietHours(q.Start, q.End)
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "quiet_hours needs both start and end as HH:MM, or neither"})
+		}
+		settings.QuietStart, settings.QuietEnd = start, end
+	}
+
+	if err := h.store.Notifications.SavePreferences(changed); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update preferences"})
+	}
+	if input.Timezone != nil || input.QuietHours != nil {
+		if err := h.store.Notifications.SaveSettings(&settings); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update preferences"})
+		}
+	}
+	return h.preferencesResponse(c, userID)
+}
+
+func (h *Handler) preferencesResponse(c *fiber.Ctx, userID uuid.UUID) error {
+	prefs, err := h.store.Notifications.Preferences(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch preferences"})
+	}
+	settings, err := h.store.Notifications.Settings(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch preferences"})
+	}
+
+	byType := make(fiber.Map, len(prefs))
+	for _, p := range prefs {
+		byType[p.Type] = p
+	}
+	var quiet interface{}
+	if settings.QuietStart != "" {
+		quiet = fiber.Map{"start": settings.QuietStart, "end": settings.QuietEnd}
+	}
+	return c.JSON(fiber.Map{
+		"preferences": byType,
+		"timezone":    settings.Timezone,
+		"quiet_hours": quiet,
+	})
+}
+
+// parseQuietHours reads HH:MM times into the zero-padded form quiet hours
+// are compared in. Both empty means no quiet hours.
+func parseQuietHours(start, end string) (string, string, bool) {
+	if start == "" && end == "" {
+		return "", "", true
+	}
+	s, err := time.Parse("15:04", start)
+	if err != nil {
+		return "", "", false
+	}
+	e, err := time.Parse("15:04", end)
+	if err != nil || s.Equal(e) {
+		return "", "", false
+	}
+	return s.Format("15:04"), e.Format("15:04"), true
+}
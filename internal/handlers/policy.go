@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/policy"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// actor loads the caller with their current role, so role changes apply
+// without waiting for a new token
+func (h *Handler) actor(c *fiber.Ctx) (policy.Actor, error) {
+	id, err := uuid.Parse(c.Locals("userID").(string))
+	if err != nil {
+		return policy.Actor{}, err
+	}
+	user, err := h.store.Users.GetByID(id)
+	if err != nil {
+		return policy.Actor{}, err
+	}
+	return policy.Actor{ID: user.ID, Role: user.Role}, nil
+}
+
+// parseStrict decodes a JSON body and rejects fields the target does not
+// declare, so update endpoints only ever touch whitelisted columns
+func parseStrict(c *fiber.Ctx, dst interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(c.Body()))
+	dec.DisallowUnknownFields()
+	return dec.Decode(dst)
+}
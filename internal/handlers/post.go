@@ -1,51 +1,81 @@
 package handlers
 
 import (
-	"fmt"
+	"log"
+	"strings"
 	"time"
 
-	db "github.com/am4rknvl/local-micro-blogging-service.git/internal/database"
 	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/policy"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 )
 
-// Create a new post
-func CreatePost(c *fiber.Ctx) error {
-	type Input struct {
-		Title   string `json:"title"`
-		Content string `json:"content"`
+// maxPostsLimit caps ?limit= on the post listing
+const maxPostsLimit = 100
+
+// postInput is the only shape clients may write to a post. Pointers tell a
+// PATCH which fields were sent.
+type postInput struct {
+	Title   *string `json:"title"`
+	Content *string `json:"content"`
+}
+
+// validate checks sent fields; full requires both, as on create and PUT
+func (in postInput) validate(full bool) string {
+	if full && (in.Title == nil || in.Content == nil) {
+		return "title and content are required"
+	}
+	if in.Title != nil && (strings.TrimSpace(*in.Title) == "" || len(*in.Title) > 255) {
+		return "title must be 1-255 characters"
+	}
+	return ""
+}
+
+// Create a new post authored by the caller
+func (h *Handler) CreatePost(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
 	}
 
-	var input Input
-	if err := c.BodyParser(&input); err != nil {
+	var input postInput
+	if err := parseStrict(c, &input); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
 	}
-
-	// Simulate user ID from JWT (replace this with c.Locals in real app)
-	userID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+	if msg := input.validate(true); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
 
 	post := models.Post{
 		ID:        uuid.New(),
 		UserID:    userID,
-		Title:     input.Title,
-		Content:   input.Content,
+		Title:     *input.Title,
+		Content:   *input.Content,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
 
-	if err := db.DB.Create(&post).Error; err != nil {
+	if err := h.store.Posts.Create(&post); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to create post"})
 	}
 
+	// The post is stored; a failed fan-out only delays it in follower timelines
+	if err := h.store.Timelines.FanOut(&post, h.cfg.Timeline.FanoutThreshold); err != nil {
+		log.Println("timeline fan-out failed:", err)
+	}
+	h.pushTimeline(&post)
+	h.notifyMentions(userID, models.EntityPost, post.ID.String(), post.Title+"\n"+post.Content)
+
 	return c.Status(201).JSON(post)
 }
 
-func GetPosts(c *fiber.Ctx) error {
+func (h *Handler) GetPosts(c *fiber.Ctx) error {
 	// Query params
 	page := c.QueryInt("page", 1)
-	limit := c.QueryInt("limit", 10)
-	search := c.Query("search", "")
+	limit := pageLimit(c.QueryInt("limit", 10), maxPostsLimit)
+	query := c.Query("search", "")
 
 	if page < 1 {
 		page = 1
@@ -54,14 +84,17 @@ func GetPosts(c *fiber.Ctx) error {
 	offset := (page - 1) * limit
 
 	var posts []models.Post
-	query := db.DB.Model(&models.Post{})
-
-	if search != "" {
-		// Basic LIKE search on title and content
-		query = query.Where("title ILIKE ? OR content ILIKE ?", "%"+search+"%", "%"+search+"%")
+	var err error
+	if query != "" {
+		posts, err = h.searchPosts(query, limit, offset, viewerID(c))
+	} else {
+		posts, err = h.store.Posts.List(store.PostFilter{
+			Limit:    limit,
+			Offset:   offset,
+			ViewerID: viewerID(c),
+		})
 	}
-
-	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&posts).Error; err != nil {
+	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch posts"})
 	}
 
@@ -73,59 +106,96 @@ func GetPosts(c *fiber.Ctx) error {
 }
 
 // Get post by ID
-func GetPost(c *fiber.Ctx) error {
-	id := c.Params("id")
-	var post models.Post
-	if err := db.DB.First(&post, "id = ?", id).Error; err != nil {
-		return c.Status(404).JSON(fiber.Map{"error": "Post not found"})
+func (h *Handler) GetPost(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid post ID"})
 	}
-	return c.JSON(post)
-}
-
-func UpdatePost(c *fiber.Ctx) error {
-	postID := c.Params("id")
-	userID := c.Locals("userID").(string)
 
-	var post models.Post
-	if err := db.DB.First(&post, postID).Error; err != nil {
+	post, err := h.store.Posts.GetByID(id)
+	if err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "Post not found"})
 	}
 
-	if fmt.Sprintf("%v", post.UserID) != userID {
-		return c.Status(403).JSON(fiber.Map{"error": "Unauthorized"})
+	if blocked, err := h.blockedWith(c, post.UserID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch post"})
+	} else if blocked {
+		return c.Status(404).JSON(fiber.Map{"error": "Post not found"})
 	}
-
-	// ... update logic
 	return c.JSON(post)
 }
 
+// UpdatePost replaces a post's title and content (PUT)
+func (h *Handler) UpdatePost(c *fiber.Ctx) error {
+	return h.updatePost(c, true)
+}
+
 // Partial update (PATCH)
-func PatchPost(c *fiber.Ctx) error {
-	id := c.Params("id")
-	var post models.Post
+func (h *Handler) PatchPost(c *fiber.Ctx) error {
+	return h.updatePost(c, false)
+}
+
+func (h *Handler) updatePost(c *fiber.Ctx, full bool) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid post ID"})
+	}
 
-	if err := db.DB.First(&post, "id = ?", id).Error; err != nil {
+	post, err := h.store.Posts.GetByID(id)
+	if err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "Post not found"})
 	}
 
-	var updates map[string]interface{}
-	if err := c.BodyParser(&updates); err != nil {
+	actor, err := h.actor(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unknown user"})
+	}
+	if !policy.CanEditPost(actor, post) {
+		return c.Status(403).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	var input postInput
+	if err := parseStrict(c, &input); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
 	}
+	if msg := input.validate(full); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
 
-	updates["updated_at"] = time.Now()
-	if err := db.DB.Model(&post).Updates(updates).Error; err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to patch post"})
+	// Every effective edit is kept as a revision
+	post, err = h.store.Posts.Edit(id, actor.ID, input.Title, input.Content)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update post"})
 	}
 
 	return c.JSON(post)
 }
 
-// Delete post
-func DeletePost(c *fiber.Ctx) error {
-	id := c.Params("id")
-	if err := db.DB.Delete(&models.Post{}, "id = ?", id).Error; err != nil {
+// Delete post, by its author or a moderator
+func (h *Handler) DeletePost(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid post ID"})
+	}
+
+	post, err := h.store.Posts.GetByID(id)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Post not found"})
+	}
+
+	actor, err := h.actor(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unknown user"})
+	}
+	if !policy.CanDeletePost(actor, post) {
+		return c.Status(403).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	if err := h.store.Posts.Delete(id, actor.ID); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete post"})
 	}
+	if err := h.store.Timelines.RemovePost(id); err != nil {
+		log.Println("timeline cleanup failed:", err)
+	}
 	return c.JSON(fiber.Map{"message": "Post deleted"})
 }
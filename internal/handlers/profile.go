@@ -1,18 +1,33 @@
 package handlers
 
 import (
+	"strings"
 	"time"
 
-	db "github.com/am4rknvl/local-micro-blogging-service.git/internal/database"
-	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/policy"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 )
 
-func GetProfile(c *fiber.Ctx) error {
+func (h *Handler) GetProfile(c *fiber.Ctx) error {
 	paramID := c.Params("id")
 
-	var user models.User
-	if err := db.DB.First(&user, "id = ?", paramID).Error; err != nil {
+	uid, err := uuid.Parse(paramID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	user, err := h.store.Users.GetByID(uid)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	// Blocked users look like they don't exist
+	blocked, err := h.blockedWith(c, uid)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch profile"})
+	}
+	if blocked {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
 	}
 
@@ -29,15 +44,8 @@ func GetProfile(c *fiber.Ctx) error {
 }
 
 
-func UpdateProfile(c *fiber.Ctx) error {
-	userID := c.Locals("userID").(string)
-	paramID := c.Params("id")
-
-	// Only allow users to update their own profile
-	if userID != paramID {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Unauthorized"})
-	}
-
+// UpdateProfile changes whitelisted profile fields, for the owner or an admin
+func (h *Handler) UpdateProfile(c *fiber.Ctx) error {
 	type ProfileUpdateInput struct {
 		Username  *string `json:"username,omitempty"`
 		Bio       *string `json:"bio,omitempty"`
@@ -47,15 +55,31 @@ func UpdateProfile(c *fiber.Ctx) error {
 	}
 
 	var input ProfileUpdateInput
-	if err := c.BodyParser(&input); err != nil {
+	if err := parseStrict(c, &input); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
 	}
+	if input.Username != nil && strings.TrimSpace(*input.Username) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Username must not be empty"})
+	}
+
+	uid, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
 
-	var user models.User
-	if err := db.DB.First(&user, "id = ?", userID).Error; err != nil {
+	user, err := h.store.Users.GetByID(uid)
+	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
 	}
 
+	actor, err := h.actor(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unknown user"})
+	}
+	if !policy.CanEditProfile(actor, user) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
 	if input.Username != nil {
 		user.Username = *input.Username
 	}
@@ -74,7 +98,7 @@ func UpdateProfile(c *fiber.Ctx) error {
 
 	user.UpdatedAt = time.Now()
 
-	if err := db.DB.Save(&user).Error; err != nil {
+	if err := h.store.Users.Save(user); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update profile"})
 	}
 
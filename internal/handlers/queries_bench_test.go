@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// These benchmarks serve the comment and friend tree read paths from a
+// SQLite store and count the statements each request runs. The count is
+// reported as queries/op and must not grow with the size of the thread or
+// friend list.
+
+// benchEnv is a test environment whose statements are counted
+type benchEnv struct {
+	*testEnv
+	queries atomic.Int64
+}
+
+func newBenchEnv(b *testing.B) *benchEnv {
+	b.Helper()
+	env := &benchEnv{testEnv: newTestEnv(b)}
+	count := func(*gorm.DB) { env.queries.Add(1) }
+	cb := env.db.Callback()
+	for _, err := range []error{
+		cb.Query().After("gorm:query").Register("bench:count", count),
+		cb.Row().After("gorm:row").Register("bench:count", count),
+		cb.Raw().After("gorm:raw").Register("bench:count", count),
+		cb.Create().After("gorm:create").Register("bench:count", count),
+		cb.Update().After("gorm:update").Register("bench:count", count),
+		cb.Delete().After("gorm:delete").Register("bench:count", count),
+	} {
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	return env
+}
+
+// count runs one GET as viewer and returns how many statements it took
+func (env *benchEnv) count(b *testing.B, route, path string, viewer uuid.UUID, handler fiber.Handler) int64 {
+	b.Helper()
+	env.queries.Store(0)
+	if status, body := env.serve(b, "GET", route, path, viewer, "", handler); status != fiber.StatusOK {
+		b.Fatalf("GET %s: status %d: %s", path, status, body)
+	}
+	return env.queries.Load()
+}
+
+// seedThread stores a post with fanout top-level comments, each the root
+// of a reply chain depth comments deep, every comment by its own author
+func (env *benchEnv) seedThread(b *testing.B, fanout, depth int) (post models.Post, viewer uuid.UUID) {
+	b.Helper()
+	users := env.users(b, 1+fanout*depth)
+	post = models.Post{ID: uuid.New(), UserID: users[0].ID, Title: "bench", Content: "bench"}
+	if err := env.db.Create(&post).Error; err != nil {
+		b.Fatal(err)
+	}
+
+	now := time.Now()
+	comments := make([]models.Comment, 0, fanout*depth)
+	for i := 0; i < fanout; i++ {
+		var parent *uuid.UUID
+		for d := 0; d < depth; d++ {
+			id := uuid.New()
+			comments = append(comments, models.Comment{
+				ID: id, PostID: post.ID, ParentID: parent, Depth: d,
+				UserID:    users[1+len(comments)].ID,
+				Content:   "bench",
+				CreatedAt: now.Add(time.Duration(len(comments)) * time.Millisecond),
+			})
+			parent = &id
+		}
+	}
+	if err := env.db.CreateInBatches(comments, 200).Error; err != nil {
+		b.Fatal(err)
+	}
+	return post, users[0].ID
+}
+
+// seedFriends makes the viewer friends with n users, each also friends
+// with the next, so every friend has mutuals to list
+func (env *benchEnv) seedFriends(b *testing.B, n int) uuid.UUID {
+	b.Helper()
+	users := env.users(b, n+1)
+	viewer, friends := users[0], users[1:]
+
+	var follows []models.Follow
+	mutual := func(a, c uuid.UUID) {
+		follows = append(follows,
+			models.Follow{ID: uuid.New(), FollowerID: a, FolloweeID: c},
+			models.Follow{ID: uuid.New(), FollowerID: c, FolloweeID: a})
+	}
+	for i, f := range friends {
+		mutual(viewer.ID, f.ID)
+		if n > 2 {
+			mutual(f.ID, friends[(i+1)%n].ID)
+		}
+	}
+	if err := env.db.CreateInBatches(follows, 200).Error; err != nil {
+		b.Fatal(err)
+	}
+	return viewer.ID
+}
+
+// benchQueries runs request against stores seeded at each size, reports
+// its statements per request and fails if they vary with the size
+func benchQueries(b *testing.B, sizes []int, request func(b *testing.B, env *benchEnv, size int) func() int64) {
+	var baseline int64 = -1
+	for _, size := range sizes {
+		env := newBenchEnv(b)
+		run := request(b, env, size)
+		queries := run()
+		if baseline < 0 {
+			baseline = queries
+		} else if queries != baseline {
+			b.Fatalf("size %d ran %d queries, size %d ran %d", sizes[0], baseline, size, queries)
+		}
+
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				run()
+			}
+			b.ReportMetric(float64(queries), "queries/op")
+		})
+	}
+}
+
+func BenchmarkGetCommentsFanout(b *testing.B) {
+	benchQueries(b, []int{1, 10, 100, 500}, func(b *testing.B, env *benchEnv, fanout int) func() int64 {
+		post, viewer := env.seedThread(b, fanout, 1)
+		path := "/posts/" + post.ID.String() + "/comments"
+		return func() int64 { return env.count(b, "/posts/:id/comments", path, viewer, env.h.GetComments) }
+	})
+}
+
+func BenchmarkGetCommentsDepth(b *testing.B) {
+	benchQueries(b, []int{1, 10, 100, 500}, func(b *testing.B, env *benchEnv, depth int) func() int64 {
+		post, viewer := env.seedThread(b, 1, depth)
+		path := "/posts/" + post.ID.String() + "/comments"
+		return func() int64 { return env.count(b, "/posts/:id/comments", path, viewer, env.h.GetComments) }
+	})
+}
+
+// BenchmarkGetCommentsTree covers the paged tree mode, which renders a few
+// levels of replies per request
+func BenchmarkGetCommentsTree(b *testing.B) {
+	benchQueries(b, []int{1, 10, 100, 500}, func(b *testing.B, env *benchEnv, fanout int) func() int64 {
+		post, viewer := env.seedThread(b, fanout, 5)
+		path := "/posts/" + post.ID.String() + "/comments?mode=tree&limit=100&depth=5"
+		return func() int64 { return env.count(b, "/posts/:id/comments", path, viewer, env.h.GetComments) }
+	})
+}
+
+func BenchmarkGetFriendTree(b *testing.B) {
+	benchQueries(b, []int{1, 10, 100, 500}, func(b *testing.B, env *benchEnv, friends int) func() int64 {
+		viewer := env.seedFriends(b, friends)
+		return func() int64 { return env.count(b, "/friend-tree", "/friend-tree", viewer, env.h.GetFriendTree) }
+	})
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/policy"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// restoreCutoff is the oldest deletion that can still be undone
+func (h *Handler) restoreCutoff() time.Time {
+	return time.Now().Add(-h.cfg.Deletion.GracePeriod)
+}
+
+// RestorePost brings back a deleted post within the grace period
+func (h *Handler) RestorePost(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid post ID"})
+	}
+
+	post, err := h.store.Posts.GetDeleted(id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Deleted post not found"})
+	}
+
+	actor, err := h.actor(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unknown user"})
+	}
+	if !policy.CanRestorePost(actor, post) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	if err := h.store.Posts.Restore(id, h.restoreCutoff()); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return c.Status(fiber.StatusGone).JSON(fiber.Map{"error": "Restore period has ended"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to restore post"})
+	}
+
+	// Deleting removed the post from timelines; push it back
+	if err := h.store.Timelines.FanOut(post, h.cfg.Timeline.FanoutThreshold); err != nil {
+		log.Println("timeline fan-out failed:", err)
+	}
+	return c.JSON(fiber.Map{"message": "Post restored"})
+}
+
+// RestoreComment brings back a deleted comment within the grace period
+func (h *Handler) RestoreComment(c *fiber.Ctx) error {
+	cid, err := uuid.Parse(c.Params("commentId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid comment ID"})
+	}
+
+	comment, err := h.store.Comments.GetDeleted(cid)
+	if err != nil || !onPost(c, comment) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Deleted comment not found"})
+	}
+	if _, err := h.store.Posts.GetByID(comment.PostID); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Post not found"})
+	}
+
+	actor, err := h.actor(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unknown user"})
+	}
+	if !policy.CanRestoreComment(actor, comment) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	if err := h.store.Comments.Restore(cid, h.restoreCutoff()); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return c.Status(fiber.StatusGone).JSON(fiber.Map{"error": "Restore period has ended"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to restore comment"})
+	}
+	return c.JSON(fiber.Map{"message": "Comment restored"})
+}
+
+// RestoreAccount lets the owner of a deleted account undo the deletion with
+// their credentials, since they can no longer sign in
+func (h *Handler) RestoreAccount(c *fiber.Ctx) error {
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	user, err := h.store.Users.GetDeletedByEmail(input.Email)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid credentials"})
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid credentials"})
+	}
+	if !policy.CanRestoreAccount(user) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Account was removed by an administrator"})
+	}
+
+	if err := h.store.Users.Restore(user.ID, h.restoreCutoff()); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return c.Status(fiber.StatusGone).JSON(fiber.Map{"error": "Restore period has ended"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not restore account"})
+	}
+	return c.JSON(fiber.Map{"message": "Account restored; you can log in again"})
+}
+
+// AdminRestoreUser restores any deleted account within the grace period
+func (h *Handler) AdminRestoreUser(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	if err := h.store.Users.Restore(userID, h.restoreCutoff()); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "No restorable account with this ID"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not restore account"})
+	}
+	return c.JSON(fiber.Map{"message": "Account restored"})
+}
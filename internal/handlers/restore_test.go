@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func TestPostSoftDeleteAndRestore(t *testing.T) {
+	env := newTestEnv(t)
+	users := env.users(t, 2)
+	alice, bob := users[0].ID, users[1].ID
+	post := env.post(t, alice, "hello", "from alice")
+	path := "/posts/" + post.ID.String()
+
+	getPost := func() int {
+		status, _ := env.serve(t, "GET", "/posts/:id", path, alice, "", env.h.GetPost)
+		return status
+	}
+	restore := func(viewer uuid.UUID) int {
+		status, _ := env.serve(t, "POST", "/posts/:id/restore", path+"/restore", viewer, "", env.h.RestorePost)
+		return status
+	}
+
+	if status, body := env.serve(t, "DELETE", "/posts/:id", path, alice, "", env.h.DeletePost); status != fiber.StatusOK {
+		t.Fatalf("delete: status %d: %s", status, body)
+	}
+	if status := getPost(); status != fiber.StatusNotFound {
+		t.Errorf("deleted post: status %d, want %d", status, fiber.StatusNotFound)
+	}
+
+	if status := restore(bob); status != fiber.StatusForbidden {
+		t.Errorf("restore by another user: status %d, want %d", status, fiber.StatusForbidden)
+	}
+	if status := restore(alice); status != fiber.StatusOK {
+		t.Fatalf("restore: status %d", status)
+	}
+	if status := getPost(); status != fiber.StatusOK {
+		t.Errorf("restored post: status %d, want %d", status, fiber.StatusOK)
+	}
+	if status := restore(alice); status != fiber.StatusNotFound {
+		t.Errorf("restore of a live post: status %d, want %d", status, fiber.StatusNotFound)
+	}
+
+	// Past the grace period the post stays deleted until it is purged
+	if status, _ := env.serve(t, "DELETE", "/posts/:id", path, alice, "", env.h.DeletePost); status != fiber.StatusOK {
+		t.Fatalf("second delete: status %d", status)
+	}
+	expired := time.Now().Add(-env.h.cfg.Deletion.GracePeriod - time.Hour)
+	if err := env.db.Unscoped().Model(&models.Post{}).Where("id = ?", post.ID).Update("deleted_at", expired).Error; err != nil {
+		t.Fatal(err)
+	}
+	if status := restore(alice); status != fiber.StatusGone {
+		t.Errorf("restore after the grace period: status %d, want %d", status, fiber.StatusGone)
+	}
+	if status := getPost(); status != fiber.StatusNotFound {
+		t.Errorf("expired post: status %d, want %d", status, fiber.StatusNotFound)
+	}
+}
+
+func TestCommentSoftDeleteAndRestore(t *testing.T) {
+	env := newTestEnv(t)
+	users := env.users(t, 2)
+	alice, bob := users[0].ID, users[1].ID
+	post := env.post(t, alice, "hello", "from alice")
+	other := env.post(t, alice, "another", "post")
+	comment := models.Comment{ID: uuid.New(), PostID: post.ID, UserID: bob, Content: "hi"}
+	if err := env.store.Comments.Create(&comment); err != nil {
+		t.Fatal(err)
+	}
+	path := "/posts/" + post.ID.String() + "/comments/" + comment.ID.String()
+
+	if status, body := env.serve(t, "DELETE", "/posts/:id/comments/:commentId", path, bob, "", env.h.DeleteComment); status != fiber.StatusOK {
+		t.Fatalf("delete: status %d: %s", status, body)
+	}
+	if _, err := env.store.Comments.GetByID(comment.ID); err == nil {
+		t.Error("deleted comment is still live")
+	}
+
+	// The comment is restored only through the post it was made on
+	wrongPost := "/posts/" + other.ID.String() + "/comments/" + comment.ID.String() + "/restore"
+	if status, _ := env.serve(t, "POST", "/posts/:id/comments/:commentId/restore", wrongPost, bob, "", env.h.RestoreComment); status != fiber.StatusNotFound {
+		t.Errorf("restore under another post: status %d, want %d", status, fiber.StatusNotFound)
+	}
+	// The post's author may delete a comment, but only its deleter restores it
+	if status, _ := env.serve(t, "POST", "/posts/:id/comments/:commentId/restore", path+"/restore", alice, "", env.h.RestoreComment); status != fiber.StatusForbidden {
+		t.Errorf("restore by the post's author: status %d, want %d", status, fiber.StatusForbidden)
+	}
+	if status, body := env.serve(t, "POST", "/posts/:id/comments/:commentId/restore", path+"/restore", bob, "", env.h.RestoreComment); status != fiber.StatusOK {
+		t.Fatalf("restore: status %d: %s", status, body)
+	}
+	if _, err := env.store.Comments.GetByID(comment.ID); err != nil {
+		t.Errorf("restored comment: %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/diff"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// GetPostRevisions lists every version of a post, oldest first. A post that
+// was never edited has a single revision: itself.
+func (h *Handler) GetPostRevisions(c *fiber.Ctx) error {
+	post, revisions, err := h.postRevisions(c)
+	if err != nil {
+		return err
+	}
+	if post == nil {
+		return nil
+	}
+	return c.JSON(fiber.Map{
+		"post_id":   post.ID,
+		"edited_at": post.EditedAt,
+		"revisions": revisions,
+	})
+}
+
+// GetPostRevisionDiff compares two revisions word by word. ?from= and ?to=
+// default to the previous and the latest revision.
+func (h *Handler) GetPostRevisionDiff(c *fiber.Ctx) error {
+	post, revisions, err := h.postRevisions(c)
+	if err != nil {
+		return err
+	}
+	if post == nil {
+		return nil
+	}
+
+	latest := len(revisions)
+	to := c.QueryInt("to", latest)
+	from := c.QueryInt("from", to-1)
+	if from < 1 {
+		from = 1
+	}
+	if to < 1 || to > latest || from > latest {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Revision out of range"})
+	}
+
+	a, b := revisions[from-1], revisions[to-1]
+	return c.JSON(fiber.Map{
+		"post_id": post.ID,
+		"from":    from,
+		"to":      to,
+		"title":   diff.Words(a.Title, b.Title),
+		"content": diff.Words(a.Content, b.Content),
+	})
+}
+
+// postRevisions loads a visible post and its revisions. On failure it has
+// already written the response and returns a nil post.
+func (h *Handler) postRevisions(c *fiber.Ctx) (*models.Post, []models.PostRevision, error) {
+	pid, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid post ID"})
+	}
+
+	post, err := h.store.Posts.GetByID(pid)
+	if err != nil {
+		return nil, nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Post not found"})
+	}
+	if blocked, err := h.blockedWith(c, post.UserID); err != nil {
+		return nil, nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch revisions"})
+	} else if blocked {
+		return nil, nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Post not found"})
+	}
+
+	revisions, err := h.store.Posts.Revisions(pid)
+	if err != nil {
+		return nil, nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch revisions"})
+	}
+	if len(revisions) == 0 {
+		revisions = []models.PostRevision{{
+			PostID: post.ID, Number: 1, EditorID: post.UserID,
+			Title: post.Title, Content: post.Content, CreatedAt: post.CreatedAt,
+		}}
+	}
+	return post, revisions, nil
+}
+
+// GetCommentRevisions lists every version of a comment, oldest first
+func (h *Handler) GetCommentRevisions(c *fiber.Ctx) error {
+	cid, err := uuid.Parse(c.Params("commentId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid comment ID"})
+	}
+
+	comment, err := h.store.Comments.GetByID(cid)
+	if err != nil || !onPost(c, comment) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Comment not found"})
+	}
+	if blocked, err := h.blockedWith(c, comment.UserID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch revisions"})
+	} else if blocked {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Comment not found"})
+	}
+
+	revisions, err := h.store.Comments.Revisions(cid)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch revisions"})
+	}
+	if len(revisions) == 0 {
+		revisions = []models.CommentRevision{{
+			CommentID: comment.ID, Number: 1, EditorID: comment.UserID,
+			Content: comment.Content, CreatedAt: comment.CreatedAt,
+		}}
+	}
+
+	return c.JSON(fiber.Map{
+		"comment_id": comment.ID,
+		"edited_at":  comment.EditedAt,
+		"revisions":  revisions,
+	})
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/search"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Search serves /search?type=posts|users|comments&q=, best match first.
+// Posts and comments can be narrowed by author (username or ID), from and
+// to (dates or RFC 3339 times) and tag. Without type it answers the older
+// username lookup.
+func (h *Handler) Search(c *fiber.Ctx) error {
+	kind := search.Kind(c.Query("type"))
+	switch kind {
+	case "":
+		return h.searchUsernames(c)
+	case search.Posts, search.Comments, search.Users:
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "type must be posts, users or comments")
+	}
+
+	page := max(c.QueryInt("page", 1), 1)
+	limit := pageLimit(c.QueryInt("limit", 20), 50)
+	req := search.Request{
+		Kind:   kind,
+		Text:   c.Query("q"),
+		Limit:  limit + 1, // one more tells whether there is a next page
+		Offset: (page - 1) * limit,
+	}
+	empty := func() error {
+		return c.JSON(fiber.Map{"type": kind, "q": req.Text, "page": page, "limit": limit, "has_more": false, "results": []fiber.Map{}})
+	}
+
+	filtered := c.Query("author") != "" || c.Query("from") != "" || c.Query("to") != "" || c.Query("tag") != ""
+	if kind == search.Users && filtered {
+		return fiber.NewError(fiber.StatusBadRequest, "author, from, to and tag only apply to posts and comments")
+	}
+
+	if v := c.Query("author"); v != "" {
+		if id, err := uuid.Parse(v); err == nil {
+			req.AuthorID = id
+		} else {
+			author, err := h.store.Users.GetByUsername(v)
+			if errors.Is(err, store.ErrNotFound) {
+				return empty()
+			}
+			if err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "Search failed")
+			}
+			req.AuthorID = author.ID
+		}
+	}
+	var err error
+	if v := c.Query("from"); v != "" {
+		if req.From, err = parseSearchTime(v, false); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "from must be a date or an RFC 3339 time")
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if req.To, err = parseSearchTime(v, true); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "to must be a date or an RFC 3339 time")
+		}
+	}
+	if v := c.Query("tag"); v != "" {
+		tag, ok := search.NormalizeTag(v)
+		if !ok {
+			return fiber.NewError(fiber.StatusBadRequest, "tag must be a single hashtag")
+		}
+		req.Tag = tag
+	}
+
+	if search.Parse(req.Text).Empty() && req.Tag == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "q must contain a word to search for")
+	}
+
+	hits, err := h.searcher.Search(req)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Search failed")
+	}
+	hasMore := len(hits) > limit
+	if hasMore {
+		hits = hits[:limit]
+	}
+
+	results, err := h.searchResults(kind, hits, viewerID(c))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Search failed")
+	}
+	return c.JSON(fiber.Map{"type": kind, "q": req.Text, "page": page, "limit": limit, "has_more": hasMore, "results": results})
+}
+
+// searchResults loads the rows behind hits in hit order. Hits the viewer
+// may not see, or that were deleted since they were indexed, are dropped,
+// so a page can come back short.
+func (h *Handler) searchResults(kind search.Kind, hits []search.Hit, viewer uuid.UUID) ([]fiber.Map, error) {
+	ids := hitIDs(hits)
+	rows := make(map[uuid.UUID]fiber.Map, len(hits))
+	switch kind {
+	case search.Posts:
+		items, err := h.store.Search.Posts(ids, viewer)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			rows[item.ID] = feedItem(item)
+		}
+	case search.Comments:
+		items, err := h.store.Search.Comments(ids, viewer)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			rows[item.ID] = fiber.Map{
+				"id":         item.ID,
+				"parent_id":  item.ParentID,
+				"content":    item.Content,
+				"created_at": item.CreatedAt,
+				"edited_at":  item.EditedAt,
+				"author": fiber.Map{
+					"id":       item.UserID,
+					"username": item.Username,
+					"avatar":   item.Avatar,
+				},
+				"post": fiber.Map{"id": item.PostID, "title": item.PostTitle},
+			}
+		}
+	case search.Users:
+		users, err := h.store.Search.Users(ids, viewer)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range users {
+			rows[u.ID] = fiber.Map{
+				"id":             u.ID,
+				"username":       u.Username,
+				"avatar":         u.Avatar,
+				"bio":            u.Bio,
+				"follower_count": u.FollowerCount,
+			}
+		}
+	}
+
+	results := make([]fiber.Map, 0, len(hits))
+	for _, hit := range hits {
+		row, ok := rows[hit.ID]
+		if !ok {
+			continue
+		}
+		row["highlights"] = hit.Highlights
+		row["relevance"] = hit.Score
+		results = append(results, row)
+	}
+	return results, nil
+}
+
+// searchUsernames is /search?q= without a type, which predates ranked search
+// and keeps its response shape
+func (h *Handler) searchUsernames(c *fiber.Ctx) error {
+	hits, err := h.searcher.Search(search.Request{Kind: search.Users, Text: c.Query("q"), Limit: 20})
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Search failed")
+	}
+	users, err := h.store.Search.Users(hitIDs(hits), viewerID(c))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Search failed")
+	}
+
+	byID := make(map[uuid.UUID]models.User, len(users))
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+	var results []fiber.Map
+	for _, hit := range hits {
+		if u, ok := byID[hit.ID]; ok {
+			results = append(results, fiber.Map{
+				"id":       u.ID,
+				"username": u.Username,
+				"bio":      u.Bio,
+			})
+		}
+	}
+	return c.JSON(results)
+}
+
+// searchPosts serves GET /posts?search=, best match first
+func (h *Handler) searchPosts(text string, limit, offset int, viewer uuid.UUID) ([]models.Post, error) {
+	hits, err := h.searcher.Search(search.Request{Kind: search.Posts, Text: text, Limit: limit, Offset: offset})
+	if err != nil {
+		return nil, err
+	}
+	items, err := h.store.Search.Posts(hitIDs(hits), viewer)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uuid.UUID]models.Post, len(items))
+	for _, item := range items {
+		byID[item.ID] = item.Post
+	}
+	posts := make([]models.Post, 0, len(hits))
+	for _, hit := range hits {
+		if post, ok := byID[hit.ID]; ok {
+			posts = append(posts, post)
+		}
+	}
+	return posts, nil
+}
+
+func hitIDs(hits []search.Hit) []uuid.UUID {
+	ids := make([]uuid.UUID, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+	}
+	return ids
+}
+
+// parseSearchTime reads an RFC 3339 time or a date. A date taken as an
+// upper bound includes that whole day.
+func parseSearchTime(v string, upper bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
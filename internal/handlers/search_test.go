@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Out-of-range paging is clamped rather than passed on to the searcher
+func TestSearchPaging(t *testing.T) {
+	env := newTestEnv(t)
+	author := env.users(t, 1)[0].ID
+	for range 3 {
+		env.post(t, author, "hello", "paging")
+	}
+
+	for _, tc := range []struct {
+		query               string
+		wantPage, wantLimit int
+		wantPosts           int
+	}{
+		{"", 1, 10, 3},
+		{"&limit=-1", 1, 1, 1},
+		{"&limit=0", 1, 1, 1},
+		{"&limit=1000", 1, maxPostsLimit, 3},
+		{"&page=-3", 1, 10, 3},
+		{"&page=0&limit=2", 1, 2, 2},
+		{"&page=2&limit=2", 2, 2, 1},
+		{"&page=5&limit=2", 5, 2, 0},
+	} {
+		t.Run("posts"+tc.query, func(t *testing.T) {
+			status, body := env.serve(t, "GET", "/posts", "/posts?search=hello"+tc.query, author, "", env.h.GetPosts)
+			if status != fiber.StatusOK {
+				t.Fatalf("status %d: %s", status, body)
+			}
+			var got struct {
+				Page  int               `json:"page"`
+				Limit int               `json:"limit"`
+				Posts []json.RawMessage `json:"posts"`
+			}
+			if err := json.Unmarshal([]byte(body), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Page != tc.wantPage || got.Limit != tc.wantLimit || len(got.Posts) != tc.wantPosts {
+				t.Errorf("page %d, limit %d, %d posts; want page %d, limit %d, %d posts",
+					got.Page, got.Limit, len(got.Posts), tc.wantPage, tc.wantLimit, tc.wantPosts)
+			}
+		})
+	}
+
+	for _, tc := range []struct {
+		query       string
+		wantResults int
+		wantHasMore bool
+	}{
+		{"&limit=-1", 1, true},
+		{"&limit=0&page=-1", 1, true},
+		{"&limit=2&page=2", 1, false},
+		{"&limit=100", 3, false},
+	} {
+		t.Run("search"+tc.query, func(t *testing.T) {
+			status, body := env.serve(t, "GET", "/search", "/search?type=posts&q=hello"+tc.query, author, "", env.h.Search)
+			if status != fiber.StatusOK {
+				t.Fatalf("status %d: %s", status, body)
+			}
+			var got struct {
+				HasMore bool              `json:"has_more"`
+				Results []json.RawMessage `json:"results"`
+			}
+			if err := json.Unmarshal([]byte(body), &got); err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Results) != tc.wantResults || got.HasMore != tc.wantHasMore {
+				t.Errorf("%d results, has_more %v; want %d, %v", len(got.Results), got.HasMore, tc.wantResults, tc.wantHasMore)
+			}
+		})
+	}
+}
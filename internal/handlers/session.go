@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/auth"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// ListSessions returns the caller's active sessions, flagging the current one
+func (h *Handler) ListSessions(c *fiber.Ctx) error {
+	claims := c.Locals("claims").(*auth.Claims)
+
+	userID, err := claims.UserID()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	sessions, err := h.store.Sessions.ListActive(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch sessions"})
+	}
+
+	result := make([]fiber.Map, 0, len(sessions))
+	for _, s := range sessions {
+		result = append(result, fiber.Map{
+			"id":           s.ID,
+			"device":       s.UserAgent,
+			"ip":           s.IP,
+			"last_seen_at": s.LastSeenAt,
+			"created_at":   s.CreatedAt,
+			"expires_at":   s.ExpiresAt,
+			"current":      s.ID.String() == claims.SessionID,
+		})
+	}
+
+	return c.JSON(result)
+}
+
+// RevokeSession signs out one of the caller's sessions
+func (h *Handler) RevokeSession(c *fiber.Ctx) error {
+	claims := c.Locals("claims").(*auth.Claims)
+
+	userID, err := claims.UserID()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	sessionID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid session ID"})
+	}
+
+	if err := h.store.Sessions.Revoke(userID, sessionID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Session not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke session"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Session revoked"})
+}
+
+// RevokeAllSessions signs the caller out everywhere, including this device
+func (h *Handler) RevokeAllSessions(c *fiber.Ctx) error {
+	claims := c.Locals("claims").(*auth.Claims)
+
+	userID, err := claims.UserID()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	if err := h.store.Sessions.RevokeAll(userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke sessions"})
+	}
+
+	return c.JSON(fiber.Map{"message": "All sessions revoked"})
+}
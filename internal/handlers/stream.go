@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/ws"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"github.com/google/uuid"
+)
+
+// streamKeepAlive is how often an idle real-time connection is pinged, so
+// proxies keep it open and dead clients are noticed
+const streamKeepAlive = 30 * time.Second
+
+// Real-time event types. Each event is a JSON object whose "type" is one of
+// these, sent alike over WebSocket and SSE.
+const (
+	eventNotification = "notification" // with the notification and unread_count
+	eventTimeline     = "timeline"     // with a new post for the timeline
+	eventUnreadCount  = "unread_count" // on connect and after marking read
+	// With the conversation, when the user is added to a group
+	eventConversation = "conversation"
+	// With the conversation_id, when the user leaves or is removed from a group
+	eventConversationLeft = "conversation_left"
+)
+
+// NotificationSocket is the caller's real-time channel over WebSocket. It
+// only sends; anything the client writes is ignored.
+func (h *Handler) NotificationSocket() fiber.Handler {
+	return websocket.New(func(c *websocket.Conn) {
+		userID := c.Locals("userID").(string)
+
+		sub := ws.NewSubscriber(userID)
+		ws.ManagerInstance.Subscribe <- sub
+		defer func() {
+			ws.ManagerInstance.Unsubscribe <- sub
+			c.Close()
+		}()
+
+		// Reading is how a closed connection is noticed
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			for {
+				if _, _, err := c.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		if data, err := h.unreadCountEvent(userID); err == nil {
+			if err := c.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		}
+
+		ticker := time.NewTicker(streamKeepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case data, ok := <-sub.Send:
+				if !ok {
+					return
+				}
+				if err := c.WriteMessage(websocket.TextMessage, data); err != nil {
+					log.Println("WS write error:", err)
+					return
+				}
+			case <-ticker.C:
+				if err := c.WriteMessage(websocket.PingMessage, nil); err != nil {
+					return
+				}
+			case <-closed:
+				return
+			}
+		}
+	})
+}
+
+// NotificationStream is the caller's real-time channel as Server-Sent
+// Events, for clients that cannot use WebSockets. Events are unnamed, so
+// EventSource.onmessage receives them all.
+func (h *Handler) NotificationStream(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	initial, err := h.unreadCountEvent(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not open stream"})
+	}
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		sub := ws.NewSubscriber(userID)
+		ws.ManagerInstance.Subscribe <- sub
+		defer func() { ws.ManagerInstance.Unsubscribe <- sub }()
+
+		fmt.Fprintf(w, "data: %s\n\n", initial)
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		ticker := time.NewTicker(streamKeepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case data, ok := <-sub.Send:
+				if !ok {
+					return
+				}
+				fmt.Fprintf(w, "data: %s\n\n", data)
+			case <-ticker.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			}
+			// A client that went away shows up as a failed flush
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// push sends an event to every open connection of the user. Callers check
+// Online first when the event is costly to build.
+func push(userID uuid.UUID, event fiber.Map) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Println("encode event failed:", err)
+		return
+	}
+	// Events are best effort; a request never waits on a busy manager
+	select {
+	case ws.ManagerInstance.Push <- ws.UserPayload{UserID: userID.String(), Data: data}:
+	default:
+		log.Println("dropping event for user", userID)
+	}
+}
+
+func (h *Handler) unreadCountEvent(userID string) ([]byte, error) {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, err
+	}
+	unread, err := h.store.Notifications.UnreadCount(id)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(fiber.Map{"type": eventUnreadCount, "unread_count": unread})
+}
+
+// pushNotification sends a stored notification as the recipient sees it
+func (h *Handler) pushNotification(n *models.Notification) {
+	if !ws.ManagerInstance.Online(n.UserID.String()) {
+		return
+	}
+	actors, err := h.store.Notifications.Actors(n.UserID, []uuid.UUID{n.ID}, notificationActors)
+	if err != nil {
+		log.Println("push notification failed:", err)
+		return
+	}
+	a := actors[n.ID]
+	if a.Count == 0 {
+		return // every actor is hidden from the recipient
+	}
+	unread, err := h.store.Notifications.UnreadCount(n.UserID)
+	if err != nil {
+		log.Println("push notification failed:", err)
+		return
+	}
+	push(n.UserID, fiber.Map{
+		"type":         eventNotification,
+		"notification": notificationItem(*n, a),
+		"unread_count": unread,
+	})
+}
+
+// pushUnreadCount keeps the user's other connections in step after they
+// read notifications
+func (h *Handler) pushUnreadCount(userID uuid.UUID) {
+	if !ws.ManagerInstance.Online(userID.String()) {
+		return
+	}
+	unread, err := h.store.Notifications.UnreadCount(userID)
+	if err != nil {
+		log.Println("push unread count failed:", err)
+		return
+	}
+	push(userID, fiber.Map{"type": eventUnreadCount, "unread_count": unread})
+}
+
+// pushTimeline sends a new post to the connected users whose timeline
+// shows it
+func (h *Handler) pushTimeline(post *models.Post) {
+	var online []uuid.UUID
+	for _, userID := range ws.ManagerInstance.OnlineUsers() {
+		if id, err := uuid.Parse(userID); err == nil {
+			online = append(online, id)
+		}
+	}
+	if len(online) == 0 {
+		return
+	}
+
+	audience, err := h.store.Timelines.Audience(post, online)
+	if err != nil {
+		log.Println("push timeline failed:", err)
+		return
+	}
+	if len(audience) == 0 {
+		return
+	}
+	author, err := h.store.Users.GetByID(post.UserID)
+	if err != nil {
+		log.Println("push timeline failed:", err)
+		return
+	}
+
+	item := feedItem(store.FeedItem{Post: *post, Username: author.Username, Avatar: author.Avatar})
+	for _, id := range audience {
+		push(id, fiber.Map{"type": eventTimeline, "post": item})
+	}
+}
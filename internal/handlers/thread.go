@@ -0,0 +1,359 @@
+package handlers
+
+import (
+	"bytes"
+	"math"
+	"sort"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultThreadLimit = 20 // comments per page at the level being listed
+	maxThreadLimit     = 100
+	defaultReplyLimit  = 3 // replies shown under each comment before "load more"
+	maxReplyLimit      = 50
+	defaultThreadDepth = 3 // levels rendered per request
+)
+
+// Orders for ?sort=, applied among the replies to each comment as well
+const (
+	sortOld           = "old"
+	sortNew           = "new"
+	sortTop           = "top"
+	sortControversial = "controversial"
+)
+
+func validSort(order string) bool {
+	switch order {
+	case sortOld, sortNew, sortTop, sortControversial:
+		return true
+	}
+	return false
+}
+
+// CommentNode is a comment with the first page of its replies. When
+// more_replies is set the rest is fetched from
+// /posts/:id/comments/:commentId/replies, passing replies_cursor if present.
+type CommentNode struct {
+	EnrichedComment
+	ReplyCount    int           `json:"reply_count"`
+	Replies       []CommentNode `json:"replies,omitempty"`
+	MoreReplies   bool          `json:"more_replies"`
+	RepliesCursor string        `json:"replies_cursor,omitempty"`
+}
+
+// thread indexes the visible comments of a post by parent, each list in the
+// requested order. Top-level comments are filed under uuid.Nil.
+type thread struct {
+	children map[uuid.UUID][]models.Comment
+	visible  map[uuid.UUID]bool
+	tallies  map[uuid.UUID]store.VoteTally
+	order    string
+}
+
+// newThread keeps comments reachable from the top level, so replies under a
+// hidden comment are hidden too, and drops deleted comments left without
+// replies; the deleted ones that remain become tombstones
+func newThread(comments []models.Comment, tallies map[uuid.UUID]store.VoteTally, order string) *thread {
+	t := &thread{
+		children: make(map[uuid.UUID][]models.Comment),
+		visible:  make(map[uuid.UUID]bool),
+		tallies:  tallies,
+		order:    order,
+	}
+	sort.SliceStable(comments, func(i, j int) bool {
+		return t.less(comments[i], comments[j])
+	})
+
+	all := make(map[uuid.UUID][]models.Comment)
+	for _, cmt := range comments {
+		parent := uuid.Nil
+		if cmt.ParentID != nil {
+			parent = *cmt.ParentID
+		}
+		all[parent] = append(all[parent], cmt)
+	}
+	t.prune(all, uuid.Nil)
+	return t
+}
+
+// prune files the live children of parent and reports whether any exist
+func (t *thread) prune(all map[uuid.UUID][]models.Comment, parent uuid.UUID) bool {
+	for _, cmt := range all[parent] {
+		hasReplies := t.prune(all, cmt.ID)
+		if cmt.DeletedAt.Valid && !hasReplies {
+			continue
+		}
+		t.visible[cmt.ID] = true
+		t.children[parent] = append(t.children[parent], cmt)
+	}
+	return len(t.children[parent]) > 0
+}
+
+// page returns up to limit children of parent after the cursor, and the
+// cursor of the next page if there is one. The cursor names the last comment
+// seen, so a page starts right after it even when that comment is gone.
+func (t *thread) page(parent uuid.UUID, after *store.Cursor, limit int) ([]models.Comment, *store.Cursor) {
+	siblings := t.children[parent]
+	start := 0
+	if after != nil {
+		last := models.Comment{CreatedAt: after.CreatedAt, ID: after.ID}
+		start = sort.Search(len(siblings), func(i int) bool {
+			return t.less(last, siblings[i])
+		})
+	}
+	end := min(start+limit, len(siblings))
+	page := siblings[start:end]
+	if end == len(siblings) {
+		return page, nil
+	}
+	last := page[len(page)-1]
+	return page, &store.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
+}
+
+// less orders comments by the thread's sort, then oldest first
+func (t *thread) less(a, b models.Comment) bool {
+	switch t.order {
+	case sortNew:
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+	case sortTop:
+		if sa, sb := t.tallies[a.ID].Score(), t.tallies[b.ID].Score(); sa != sb {
+			return sa > sb
+		}
+	case sortControversial:
+		if ca, cb := controversy(t.tallies[a.ID]), controversy(t.tallies[b.ID]); ca != cb {
+			return ca > cb
+		}
+	}
+	return threadLess(a, b)
+}
+
+// controversy is high for comments with many votes split evenly between up
+// and down, as in Reddit's controversial sort
+func controversy(tally store.VoteTally) float64 {
+	if tally.Up <= 0 || tally.Down <= 0 {
+		return 0
+	}
+	magnitude := float64(tally.Up + tally.Down)
+	balance := float64(tally.Down) / float64(tally.Up)
+	if tally.Up < tally.Down {
+		balance = float64(tally.Up) / float64(tally.Down)
+	}
+	return math.Pow(magnitude, balance)
+}
+
+// threadLess orders comments oldest first, by ID on equal times
+func threadLess(a, b models.Comment) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return bytes.Compare(a.ID[:], b.ID[:]) < 0
+}
+
+// threadRenderer turns pages of a thread into CommentNodes
+type threadRenderer struct {
+	post    *models.Post
+	thread  *thread
+	users   map[uuid.UUID]*models.User // authors; deleted accounts are absent
+	depth   int                        // levels to render, counting the listed comments
+	replies int                        // replies per comment
+}
+
+// newThreadRenderer loads the authors of every visible comment in one query
+func (h *Handler) newThreadRenderer(post *models.Post, t *thread) (*threadRenderer, error) {
+	seen := make(map[uuid.UUID]bool)
+	var ids []uuid.UUID
+	for _, siblings := range t.children {
+		for _, cmt := range siblings {
+			if !seen[cmt.UserID] {
+				seen[cmt.UserID] = true
+				ids = append(ids, cmt.UserID)
+			}
+		}
+	}
+
+	users, err := h.store.Users.GetByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	r := &threadRenderer{post: post, thread: t, users: make(map[uuid.UUID]*models.User, len(users))}
+	for i := range users {
+		r.users[users[i].ID] = &users[i]
+	}
+	return r, nil
+}
+
+func (r *threadRenderer) nodes(comments []models.Comment, level int) []CommentNode {
+	nodes := make([]CommentNode, 0, len(comments))
+	for _, cmt := range comments {
+		node := CommentNode{
+			EnrichedComment: r.enrich(cmt),
+			ReplyCount:      len(r.thread.children[cmt.ID]),
+		}
+
+		if level+1 < r.depth {
+			page, next := r.thread.page(cmt.ID, nil, r.replies)
+			node.Replies = r.nodes(page, level+1)
+			if next != nil {
+				node.MoreReplies = true
+				node.RepliesCursor = encodeCursor(*next)
+			}
+		} else {
+			node.MoreReplies = node.ReplyCount > 0
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+func (r *threadRenderer) enrich(cmt models.Comment) EnrichedComment {
+	if cmt.DeletedAt.Valid {
+		return tombstone(cmt)
+	}
+
+	user, ok := r.users[cmt.UserID]
+	if !ok {
+		// The author deleted their account
+		return tombstone(cmt)
+	}
+
+	tally := r.thread.tallies[cmt.ID]
+	enriched := EnrichedComment{
+		ID:        cmt.ID,
+		ParentID:  cmt.ParentID,
+		Depth:     cmt.Depth,
+		Content:   cmt.Content,
+		CreatedAt: cmt.CreatedAt,
+		EditedAt:  cmt.EditedAt,
+		IsOP:      cmt.UserID == r.post.UserID,
+		Score:     tally.Score(),
+		Upvotes:   tally.Up,
+		Downvotes: tally.Down,
+	}
+	enriched.User.ID = user.ID
+	enriched.User.Username = user.Username
+	enriched.User.Avatar = user.Avatar
+	return enriched
+}
+
+// tombstone keeps a deleted comment's place in the thread without its content
+func tombstone(cmt models.Comment) EnrichedComment {
+	return EnrichedComment{
+		ID:        cmt.ID,
+		ParentID:  cmt.ParentID,
+		Depth:     cmt.Depth,
+		Content:   "comment deleted",
+		CreatedAt: cmt.CreatedAt,
+		Deleted:   true,
+	}
+}
+
+// flatten lists a tree depth first, each node followed by its replies
+func flatten(nodes []CommentNode, out []CommentNode) []CommentNode {
+	for _, node := range nodes {
+		replies := node.Replies
+		node.Replies = nil
+		out = append(out, node)
+		out = flatten(replies, out)
+	}
+	return out
+}
+
+// loadThread reads a post the caller may see and its comment thread, sorted
+// by ?sort=. On failure it has already written the response and returns a
+// nil post.
+func (h *Handler) loadThread(c *fiber.Ctx) (*models.Post, *thread, error) {
+	pid, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid post ID"})
+	}
+	order := c.Query("sort", sortOld)
+	if !validSort(order) {
+		return nil, nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "sort must be top, new, old or controversial"})
+	}
+
+	// Get post to find OP
+	post, err := h.store.Posts.GetByID(pid)
+	if err != nil {
+		return nil, nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Post not found"})
+	}
+
+	// Posts by blocked users are hidden, so are their threads
+	blocked, err := h.blockedWith(c, post.UserID)
+	if err != nil {
+		return nil, nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch comments"})
+	}
+	if blocked {
+		return nil, nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Post not found"})
+	}
+
+	// Get all comments on that post, minus blocked commenters
+	comments, err := h.store.Comments.ListByPost(pid, viewerID(c))
+	if err != nil {
+		return nil, nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch comments"})
+	}
+	tallies, err := h.store.CommentVotes.TalliesByPost(pid)
+	if err != nil {
+		return nil, nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch comments"})
+	}
+	return post, newThread(comments, tallies, order), nil
+}
+
+// threadPage answers GetComments and GetReplies in tree or flat mode,
+// listing the children of parent (uuid.Nil for top-level comments)
+func (h *Handler) threadPage(c *fiber.Ctx, post *models.Post, t *thread, parent uuid.UUID) error {
+	mode := c.Query("mode", "tree")
+	if mode != "tree" && mode != "flat" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "mode must be tree or flat"})
+	}
+	after, err := decodeCursor(c.Query("cursor"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid cursor"})
+	}
+
+	r, err := h.newThreadRenderer(post, t)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch comments"})
+	}
+	r.depth = pageLimit(c.QueryInt("depth", defaultThreadDepth), h.cfg.Comments.MaxDepth+1)
+	r.replies = pageLimit(c.QueryInt("replies", defaultReplyLimit), maxReplyLimit)
+
+	page, next := t.page(parent, after, pageLimit(c.QueryInt("limit", defaultThreadLimit), maxThreadLimit))
+	nodes := r.nodes(page, 0)
+	if mode == "flat" {
+		nodes = flatten(nodes, make([]CommentNode, 0, len(nodes)))
+	}
+
+	nextCursor := ""
+	if next != nil {
+		nextCursor = encodeCursor(*next)
+	}
+	return c.JSON(fiber.Map{
+		"comments":    nodes,
+		"next_cursor": nextCursor,
+	})
+}
+
+// GetReplies pages through the replies to a comment, as a tree or a flat
+// list with depth; it takes the same parameters as GetComments
+func (h *Handler) GetReplies(c *fiber.Ctx) error {
+	post, t, err := h.loadThread(c)
+	if post == nil {
+		return err
+	}
+
+	cid, err := uuid.Parse(c.Params("commentId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid comment ID"})
+	}
+	if !t.visible[cid] {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Comment not found"})
+	}
+	return h.threadPage(c, post, t, cid)
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultTimelineLimit = 20
+	maxTimelineLimit     = 100
+)
+
+// GetTimeline returns posts from accounts the caller follows plus their own,
+// newest first, read from the materialized timeline. Pass next_cursor back as
+// ?cursor= to get the following page.
+func (h *Handler) GetTimeline(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	after, err := decodeCursor(c.Query("cursor"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid cursor"})
+	}
+	limit := pageLimit(c.QueryInt("limit", defaultTimelineLimit), maxTimelineLimit)
+
+	// Fetch one extra row to know whether another page exists
+	items, err := h.store.Timelines.Page(userID, after, limit+1)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch timeline"})
+	}
+
+	return c.JSON(feedPage(items, limit))
+}
+
+// feedPage renders a page of feed items and the cursor for the next one
+func feedPage(items []store.FeedItem, limit int) fiber.Map {
+	nextCursor := ""
+	if len(items) > limit {
+		items = items[:limit]
+		last := items[len(items)-1]
+		nextCursor = encodeCursor(store.Cursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	posts := make([]fiber.Map, 0, len(items))
+	for _, item := range items {
+		posts = append(posts, feedItem(item))
+	}
+
+	return fiber.Map{"posts": posts, "next_cursor": nextCursor}
+}
+
+// feedItem renders a single post with its author as feeds show it
+func feedItem(item store.FeedItem) fiber.Map {
+	return fiber.Map{
+		"id":         item.ID,
+		"title":      item.Title,
+		"content":    item.Content,
+		"created_at": item.CreatedAt,
+		"updated_at": item.UpdatedAt,
+		"edited_at":  item.EditedAt,
+		"author": fiber.Map{
+			"id":       item.UserID,
+			"username": item.Username,
+			"avatar":   item.Avatar,
+		},
+		"score":         item.Score,
+		"comment_count": item.CommentCount,
+	}
+}
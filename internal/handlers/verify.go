@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/auth"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/mail"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// VerifyEmail redeems a verification token. The token comes from the query
+// string when the emailed link is opened, or from a JSON body.
+func (h *Handler) VerifyEmail(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		var input struct {
+			Token string `json:"token"`
+		}
+		if err := c.BodyParser(&input); err == nil {
+			token = input.Token
+		}
+	}
+	if token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Missing token"})
+	}
+
+	if _, err := h.store.Verifications.Consume(auth.HashToken(token)); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid or expired verification token"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not verify email"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Email verified"})
+}
+
+// ResendVerification sends the authenticated user a fresh verification link
+func (h *Handler) ResendVerification(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	user, err := h.store.Users.GetByID(userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if user.EmailVerified {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Email already verified"})
+	}
+
+	if !h.verifyLimiter.Allow(user.ID.String()) {
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "Too many verification emails, try again later"})
+	}
+
+	if err := h.sendVerificationEmail(user); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not send verification email"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Verification email sent"})
+}
+
+func (h *Handler) sendVerificationEmail(user *models.User) error {
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	verification := models.EmailVerificationToken{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(h.cfg.Verification.TokenTTL),
+		CreatedAt: time.Now(),
+	}
+	if err := h.store.Verifications.Create(&verification); err != nil {
+		return err
+	}
+
+	h.sendMail(mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm this is your email address by opening:\n%s/verify-email?token=%s\n\n"+
+			"The link expires in %s.\n",
+			user.Username, h.cfg.Server.PublicURL, token, h.cfg.Verification.TokenTTL),
+	})
+	return nil
+}
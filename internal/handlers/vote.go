@@ -3,10 +3,9 @@ package handlers
 import (
 	"time"
 
-	"github.com/google/uuid"
-	db "github.com/am4rknvl/local-micro-blogging-service.git/internal/database"
-	"github.com/gofiber/fiber/v2"
 	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 )
 
 // VoteInput holds the vote value from client
@@ -15,7 +14,7 @@ type VoteInput struct {
 }
 
 // VotePost lets a user cast or change their vote on a post
-func VotePost(c *fiber.Ctx) error {
+func (h *Handler) VotePost(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 	postID := c.Params("id")
 
@@ -37,15 +36,27 @@ func VotePost(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid post ID"})
 	}
 
-	var vote models.Vote
-	err = db.DB.Where("user_id = ? AND post_id = ?", uid, pid).First(&vote).Error
+	post, err := h.store.Posts.GetByID(pid)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Post not found"})
+	}
+
+	blocked, err := h.blockedWith(c, post.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to cast vote"})
+	}
+	if blocked {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Cannot vote on this post"})
+	}
+
+	vote, err := h.store.Votes.Get(uid, pid)
 
 	if err != nil {
 		// No existing vote, create one if value != 0
 		if input.Value == 0 {
 			return c.JSON(fiber.Map{"message": "No vote to remove"})
 		}
-		vote = models.Vote{
+		vote = &models.Vote{
 			ID:        uuid.New(),
 			UserID:    uid,
 			PostID:    pid,
@@ -53,48 +64,134 @@ func VotePost(c *fiber.Ctx) error {
 			CreatedAt: time.Now(),
 			UpdatedAt: time.Now(),
 		}
-		if err := db.DB.Create(&vote).Error; err != nil {
+		if err := h.store.Votes.Create(vote); err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create vote"})
 		}
+		if vote.Value == 1 {
+			h.notify(post.UserID, uid, models.NotifyVote, models.EntityPost, pid.String())
+		}
 		return c.JSON(fiber.Map{"message": "Vote cast"})
 	}
 
 	// Existing vote found
 	if input.Value == 0 {
 		// Remove vote
-		if err := db.DB.Delete(&vote).Error; err != nil {
+		if err := h.store.Votes.Delete(vote); err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to remove vote"})
 		}
 		return c.JSON(fiber.Map{"message": "Vote removed"})
 	}
 
 	// Update vote value
+	upvoted := vote.Value != 1 && input.Value == 1
 	vote.Value = input.Value
 	vote.UpdatedAt = time.Now()
-	if err := db.DB.Save(&vote).Error; err != nil {
+	if err := h.store.Votes.Save(vote); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update vote"})
 	}
+	if upvoted {
+		h.notify(post.UserID, uid, models.NotifyVote, models.EntityPost, pid.String())
+	}
 
 	return c.JSON(fiber.Map{"message": "Vote updated"})
 }
 
-
-func GetVoteScore(c *fiber.Ctx) error {
+func (h *Handler) GetVoteScore(c *fiber.Ctx) error {
 	postID := c.Params("id")
 	pid, err := uuid.Parse(postID)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid post ID"})
 	}
 
-	var score int64
-	err = db.DB.Model(&models.Vote{}).
-		Select("COALESCE(SUM(value), 0)").
-		Where("post_id = ?", pid).
-		Scan(&score).Error
+	// Counters are kept on the post, so this is a single row read
+	post, err := h.store.Posts.GetByID(pid)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Post not found"})
+	}
 
+	return c.JSON(fiber.Map{
+		"score":     post.Score,
+		"upvotes":   post.Upvotes,
+		"downvotes": post.Downvotes,
+	})
+}
+
+// VoteComment lets a user cast, change or remove (value 0) their vote on a
+// comment
+func (h *Handler) VoteComment(c *fiber.Ctx) error {
+	var input VoteInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	if input.Value != 1 && input.Value != -1 && input.Value != 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid vote value"})
+	}
+
+	uid, err := uuid.Parse(c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	cid, err := uuid.Parse(c.Params("commentId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid comment ID"})
+	}
+
+	comment, err := h.store.Comments.GetByID(cid)
+	if err != nil || !onPost(c, comment) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Comment not found"})
+	}
+	post, err := h.store.Posts.GetByID(comment.PostID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get vote score"})
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Post not found"})
 	}
 
-	return c.JSON(fiber.Map{"score": score})
+	for _, other := range []uuid.UUID{post.UserID, comment.UserID} {
+		blocked, err := h.blockedWith(c, other)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to cast vote"})
+		}
+		if blocked {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Cannot vote on this comment"})
+		}
+	}
+
+	vote, err := h.store.CommentVotes.Get(uid, cid)
+	if err != nil {
+		if input.Value == 0 {
+			return c.JSON(fiber.Map{"message": "No vote to remove"})
+		}
+		vote = &models.CommentVote{
+			ID:        uuid.New(),
+			UserID:    uid,
+			CommentID: cid,
+			Value:     input.Value,
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		}
+		if err := h.store.CommentVotes.Create(vote); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create vote"})
+		}
+		if vote.Value == 1 {
+			h.notify(comment.UserID, uid, models.NotifyVote, models.EntityComment, cid.String())
+		}
+		return c.JSON(fiber.Map{"message": "Vote cast"})
+	}
+
+	if input.Value == 0 {
+		if err := h.store.CommentVotes.Delete(vote); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to remove vote"})
+		}
+		return c.JSON(fiber.Map{"message": "Vote removed"})
+	}
+
+	upvoted := vote.Value != 1 && input.Value == 1
+	vote.Value = input.Value
+	vote.UpdatedAt = time.Now()
+	if err := h.store.CommentVotes.Save(vote); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update vote"})
+	}
+	if upvoted {
+		h.notify(comment.UserID, uid, models.NotifyVote, models.EntityComment, cid.String())
+	}
+	return c.JSON(fiber.Map{"message": "Vote updated"})
 }
@@ -3,12 +3,13 @@ package handlers
 import (
 	"encoding/json"
 	"log"
+	"time"
 
-	db "github.com/am4rknvl/local-micro-blogging-service.git/internal/database"
 	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
 	"github.com/am4rknvl/local-micro-blogging-service.git/internal/ws"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
+	"github.com/google/uuid"
 )
 
 type IncomingMessage struct {
@@ -16,21 +17,66 @@ type IncomingMessage struct {
 	Content        string `json:"content"`
 }
 
-func WebSocketHandler() fiber.Handler {
+func (h *Handler) WebSocketHandler() fiber.Handler {
 	return websocket.New(func(c *websocket.Conn) {
 		userID := c.Locals("userID").(string) // from JWT middleware
 		convoID := c.Params("conversationID") // passed in URL
-
-		client := &ws.Client{
-			Conn:           c,
-			UserID:         userID,
-			ConversationID: convoID,
+		uid, err := uuid.Parse(userID)
+		if err != nil {
+			c.Close()
+			return
 		}
 
+		client := ws.NewClient(userID, convoID)
 		ws.ManagerInstance.Register <- client
+
+		// Errors for this client only; the writer sends them between
+		// broadcasts
+		replies := make(chan []byte, 8)
+		reply := func(v fiber.Map) {
+			data, _ := json.Marshal(v)
+			select {
+			case replies <- data:
+			default:
+			}
+		}
+
+		// The only goroutine writing to the connection. It closes it once
+		// the manager closes Send, which ends the read loop below.
+		written := make(chan struct{})
+		go func() {
+			defer close(written)
+			defer c.Close()
+			for {
+				select {
+				case data, ok := <-client.Send:
+					if !ok {
+						for len(replies) > 0 {
+							c.WriteMessage(websocket.TextMessage, <-replies)
+						}
+						// The connection is only really closed once this
+						// handler returns, so tell the peer and stop reading
+						c.WriteControl(websocket.CloseMessage,
+							websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+							time.Now().Add(time.Second))
+						c.SetReadDeadline(time.Now())
+						return
+					}
+					if err := c.WriteMessage(websocket.TextMessage, data); err != nil {
+						log.Println("WS write error:", err)
+						return
+					}
+				case data := <-replies:
+					if err := c.WriteMessage(websocket.TextMessage, data); err != nil {
+						log.Println("WS write error:", err)
+						return
+					}
+				}
+			}
+		}()
 		defer func() {
 			ws.ManagerInstance.Unregister <- client
-			c.Close()
+			<-written
 		}()
 
 		for {
@@ -41,7 +87,28 @@ func WebSocketHandler() fiber.Handler {
 			}
 
 			var incoming IncomingMessage
-			if err := json.Unmarshal(data, &incoming); err != nil {
+			if err := json.Unmarshal(data, &incoming); err != nil || incoming.Content == "" {
+				continue
+			}
+
+			// Membership was checked on connect; this catches removal since
+			member, err := h.isConversationMember(convoID, uid)
+			if err != nil {
+				log.Println("membership check failed:", err)
+				continue
+			}
+			if !member {
+				reply(fiber.Map{"error": "Conversation not found"})
+				break
+			}
+
+			blocked, err := h.blockedInConversation(userID, convoID)
+			if err != nil {
+				log.Println("block check failed:", err)
+				continue
+			}
+			if blocked {
+				reply(fiber.Map{"error": "Cannot message this conversation"})
 				continue
 			}
 
@@ -50,21 +117,18 @@ func WebSocketHandler() fiber.Handler {
 				SenderID:       userID,
 				ConversationID: convoID,
 				Content:        incoming.Content,
+				Type:           models.MessageText,
 				IsSaved:        false,
 			}
-			// Save to DB using GORM
-			if err := db.DB.Create(msg).Error; err != nil {
+			// Save to DB through the message store
+			if err := h.store.Messages.Create(msg); err != nil {
 				log.Println("DB save failed:", err)
 				continue
 			}
-			saved := msg
+			h.notifyConversation(userID, convoID)
 
 			// Broadcast back to all in this convo
-			outgoing, _ := json.Marshal(saved)
-			ws.ManagerInstance.Broadcast <- ws.MessagePayload{
-				ConversationID: convoID,
-				Data:           outgoing,
-			}
+			h.broadcastMessage(msg)
 		}
 	})
 }
@@ -0,0 +1,44 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LogMailer is for local development: it logs every message and, when dir
+// is set, also writes it there as an .eml file
+type LogMailer struct {
+	from string
+	dir  string
+}
+
+func NewLogMailer(from, dir string) *LogMailer {
+	return &LogMailer{from: from, dir: dir}
+}
+
+func (m *LogMailer) Send(msg Message) error {
+	log.Printf("📧 mail to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+
+	if m.dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s_%s.eml", time.Now().Format("20060102T150405.000000000"), sanitize(msg.To))
+	return os.WriteFile(filepath.Join(m.dir, name), format(m.from, msg), 0o644)
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,30 @@
+package mail
+
+import (
+	"fmt"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/config"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers transactional email such as password resets
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// New returns the mailer selected by cfg.Driver
+func New(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		return NewSMTPMailer(cfg), nil
+	case "log":
+		return NewLogMailer(cfg.From, cfg.OutboxDir), nil
+	default:
+		return nil, fmt.Errorf("unsupported mail driver %q", cfg.Driver)
+	}
+}
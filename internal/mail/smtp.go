@@ -0,0 +1,57 @@
+package mail
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/config"
+)
+
+// SMTPMailer sends through an SMTP relay, upgrading to TLS when offered
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func NewSMTPMailer(cfg config.MailConfig) *SMTPMailer {
+	m := &SMTPMailer{
+		addr: net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort)),
+		from: cfg.From,
+	}
+	if cfg.SMTPUsername != "" {
+		m.auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+	return m
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	// The envelope sender must be a bare address, the header keeps the name
+	envelopeFrom := m.from
+	if addr, err := mail.ParseAddress(m.from); err == nil {
+		envelopeFrom = addr.Address
+	}
+
+	if err := smtp.SendMail(m.addr, m.auth, envelopeFrom, []string{msg.To}, format(m.from, msg)); err != nil {
+		return fmt.Errorf("smtp send to %s: %w", msg.To, err)
+	}
+	return nil
+}
+
+// format renders msg as a plain text RFC 5322 message
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
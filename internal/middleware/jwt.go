@@ -2,64 +2,61 @@ package middleware
 
 import (
 	"errors"
-	"os"
 	"strings"
 
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/auth"
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/gofiber/websocket/v2"
 )
 
-var SecretKey = []byte(os.Getenv("JWT_SECRET"))
+// RequireAuth verifies the access token and its session through the auth
+// service and stores the user ID in c.Locals("userID") and the claims in
+// c.Locals("claims")
+func RequireAuth(authService *auth.Service) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tokenStr := bearerToken(c)
+		if tokenStr == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing token"})
+		}
 
-func RequireAuth(c *fiber.Ctx) error {
-	authHeader := c.Get("Authorization")
-	if authHeader == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing token"})
-	}
+		claims, err := authService.Authenticate(tokenStr, c.IP())
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrExpiredToken) {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not verify token"})
+		}
 
-	tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-		return SecretKey, nil
-	})
+		c.Locals("userID", claims.Subject)
+		c.Locals("claims", claims)
 
-	if err != nil || !token.Valid {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+		return c.Next()
 	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok || !token.Valid {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid claims"})
-	}
-
-	userID := claims["sub"]
-	c.Locals("userID", userID)
-
-	return c.Next()
 }
 
-func ParseUserIDFromJWT(tokenString string) (string, error) {
-	// Remove "Bearer " if present
-	tokenString = strings.TrimPrefix(tokenString, "Bearer ")
-
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Check signing method if needed
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
+// OptionalAuth identifies the caller like RequireAuth when a valid token is
+// sent, and lets anonymous requests through on public routes
+func OptionalAuth(authService *auth.Service) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if tokenStr := bearerToken(c); tokenStr != "" {
+			if claims, err := authService.Authenticate(tokenStr, c.IP()); err == nil {
+				c.Locals("userID", claims.Subject)
+				c.Locals("claims", claims)
+			}
 		}
-		return SecretKey, nil
-	})
-
-	if err != nil {
-		return "", err
+		return c.Next()
 	}
+}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		userID, ok := claims["user_id"].(string)
-		if !ok {
-			return "", errors.New("user_id not found in token")
-		}
-		return userID, nil
+// bearerToken reads the Authorization header. Browsers cannot set headers on
+// a WebSocket upgrade or an EventSource, so those requests may pass
+// ?access_token= instead.
+func bearerToken(c *fiber.Ctx) string {
+	if authHeader := c.Get("Authorization"); authHeader != "" {
+		return strings.TrimPrefix(authHeader, "Bearer ")
 	}
-
-	return "", errors.New("invalid token")
+	if websocket.IsWebSocketUpgrade(c) || strings.Contains(c.Get("Accept"), "text/event-stream") {
+		return c.Query("access_token")
+	}
+	return ""
 }
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/policy"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// RequireRole lets through users holding role or a higher one. The role is
+// read from the database on every request, so demotions apply at once. It
+// must run after RequireAuth.
+func RequireRole(users store.UserStore, role string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, err := uuid.Parse(c.Locals("userID").(string))
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+		}
+		user, err := users.GetByID(userID)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User not found"})
+		}
+
+		if !policy.HasRole(user.Role, role) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Insufficient role"})
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/config"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"github.com/google/uuid"
+)
+
+// RequireVerifiedEmail enforces the policy for accounts that have not
+// verified their email yet. It must run after RequireAuth.
+func RequireVerifiedEmail(policy string, users store.UserStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if policy == config.UnverifiedAllow {
+			return c.Next()
+		}
+		if policy == config.UnverifiedReadOnly && isReadOnly(c) {
+			return c.Next()
+		}
+
+		userID, err := uuid.Parse(c.Locals("userID").(string))
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+		}
+		user, err := users.GetByID(userID)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User not found"})
+		}
+
+		if !user.EmailVerified {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Email not verified"})
+		}
+		return c.Next()
+	}
+}
+
+// isReadOnly reports whether the request cannot change anything. WebSocket
+// upgrades are GETs but carry chat messages, so they do not count.
+func isReadOnly(c *fiber.Ctx) bool {
+	switch c.Method() {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		return !websocket.IsWebSocketUpgrade(c)
+	}
+	return false
+}
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Block struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	BlockerID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_block_pair" json:"blocker_id"` // user who blocks
+	BlockedID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_block_pair;index" json:"blocked_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -4,21 +4,25 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type Comment struct {
-	ID        uuid.UUID `gorm:"type:uuid;primaryKey"`
-	PostID    uuid.UUID `gorm:"type:uuid;not null;index"`
-	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
-	Content   string    `gorm:"type:text;not null"`
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID        uuid.UUID      `gorm:"type:uuid;primaryKey" json:"id"`
+	PostID    uuid.UUID      `gorm:"type:uuid;not null;index" json:"post_id"`
+	ParentID  *uuid.UUID     `gorm:"type:uuid;index" json:"parent_id,omitempty"` // nil for top-level comments
+	Depth     int            `gorm:"not null;default:0" json:"depth"`            // 0 for top-level comments
+	UserID    uuid.UUID      `gorm:"type:uuid;not null;index" json:"user_id"`
+	Content   string         `gorm:"type:text;not null" json:"content"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	EditedAt  *time.Time     `json:"edited_at,omitempty"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"` // shown as a tombstone until purged
+	DeletedBy *uuid.UUID     `gorm:"type:uuid" json:"-"`
 
 	User struct {
 		ID       uuid.UUID `json:"id"`
 		Username string    `json:"username"`
 		Avatar   string    `json:"avatar"`
-	} `json:"user"`
+	} `json:"user" gorm:"-"`
 }
-
-
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Conversation types
+const (
+	ConversationDirect = "direct" // between exactly two users, at most one per pair
+	ConversationGroup  = "group"
+)
+
+// Conversation is a chat that only its members can read or write. Messages
+// refer to it by its ID in string form.
+type Conversation struct {
+	ID             uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	Type           string    `gorm:"size:16;not null" json:"type"`
+	Title          string    `gorm:"size:100" json:"title,omitempty"`
+	Avatar         string    `gorm:"size:255" json:"avatar,omitempty"` // groups only
+	DirectKey      *string   `gorm:"size:80;uniqueIndex" json:"-"`     // both member IDs in order; nil for groups
+	CreatedBy      uuid.UUID `gorm:"type:uuid" json:"created_by"`
+	LastActivityAt time.Time `gorm:"index" json:"last_activity_at"` // creation or latest message
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// DirectKey identifies the direct conversation between two users, whichever
+// of them starts it
+func DirectKey(a, b uuid.UUID) string {
+	if a.String() > b.String() {
+		a, b = b, a
+	}
+	return a.String() + ":" + b.String()
+}
+
+// Member roles in a group, from least to most privileged. A group has one
+// owner; members of direct conversations are all plain members.
+const (
+	GroupMember = "member"
+	GroupAdmin  = "admin"
+	GroupOwner  = "owner"
+)
+
+// ConversationMember lets a user into a conversation and tracks how far
+// they have read
+type ConversationMember struct {
+	ConversationID uuid.UUID  `gorm:"type:uuid;primaryKey" json:"conversation_id"`
+	UserID         uuid.UUID  `gorm:"type:uuid;primaryKey;index" json:"user_id"`
+	Role           string     `gorm:"size:16;not null;default:member" json:"role"`
+	LastReadAt     *time.Time `json:"last_read_at,omitempty"`
+	JoinedAt       time.Time  `json:"joined_at"`
+}
+
+// ConversationInvite is a link that lets anyone holding it join a group
+// until it expires or is revoked. Like other tokens it is stored hashed.
+type ConversationInvite struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	ConversationID uuid.UUID  `gorm:"type:uuid;not null;index" json:"conversation_id"`
+	TokenHash      string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	CreatedBy      uuid.UUID  `gorm:"type:uuid;not null" json:"created_by"`
+	ExpiresAt      time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
@@ -6,9 +6,16 @@ import (
 	"github.com/google/uuid"
 )
 
+// Message types. System messages record changes to a group, such as a
+// member being added, with the member who made the change as sender.
+const (
+	MessageText   = "text"
+	MessageSystem = "system"
+)
+
 type Message struct {
-	ID             uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	ConversationID string    `json:"conversation_id" gorm:"not null"`
+	ID             uuid.UUID `json:"id" gorm:"type:uuid;primary_key"`
+	ConversationID string    `json:"conversation_id" gorm:"not null;index"` // a Conversation ID
 	SenderID       string    `json:"sender_id" gorm:"not null"`
 	Content        string    `json:"content" gorm:"not null"`
 	Type           string    `json:"type" gorm:"default:'text'"`
@@ -0,0 +1,50 @@
+package models
+
+import "strings"
+
+// Mutes match whole words. A word ends at whitespace or one of these
+// characters, and for keywords at '#' too, so muting "go" hides "go!" and
+// "#go" but not "good", while muting "#go" hides "#go" but not "#golang".
+// The store applies the same rules in SQL.
+const muteSeparators = ".,!?;:()[]{}<>\"'/\\|*~`+=&^%$@-"
+
+// MuteSeparators lists what ends a word for mutes of kind
+func MuteSeparators(kind string) []string {
+	seps := []string{"\t", "\r", "\n"}
+	for _, r := range muteSeparators {
+		seps = append(seps, string(r))
+	}
+	if kind != MuteHashtag {
+		seps = append(seps, "#")
+	}
+	return seps
+}
+
+// MuteText is text as mutes of kind see it: lowercased, separators turned
+// into spaces and a space added at each end
+func MuteText(text, kind string) string {
+	text = strings.ToLower(text)
+	for _, sep := range MuteSeparators(kind) {
+		text = strings.ReplaceAll(text, sep, " ")
+	}
+	return " " + text + " "
+}
+
+// NormalizeMuteWord turns what a user asked to mute into the stored word: a
+// keyword or phrase of single-spaced words, or a hashtag with its '#'. It
+// returns "" when nothing mutable is left.
+func NormalizeMuteWord(word, kind string) string {
+	if kind == MuteHashtag {
+		tag := strings.Fields(MuteText(strings.TrimLeft(strings.TrimSpace(word), "#"), MuteKeyword))
+		if len(tag) != 1 {
+			return ""
+		}
+		return "#" + tag[0]
+	}
+	return strings.Join(strings.Fields(MuteText(word, kind)), " ")
+}
+
+// Matches reports whether text contains the muted word, phrase or hashtag
+func (m *Mute) Matches(text string) bool {
+	return m.Word != "" && strings.Contains(MuteText(text, m.Kind), " "+m.Word+" ")
+}
@@ -1,15 +1,154 @@
 package models
 
 import (
+	"fmt"
 	"time"
+
+	"github.com/google/uuid"
+)
+
+// Notification types
+const (
+	NotifyFollow        = "follow"
+	NotifyComment       = "comment" // on your post, or a reply to your comment
+	NotifyVote          = "vote"    // upvotes only
+	NotifyFriendRequest = "friend_request"
+	NotifyFriendAccept  = "friend_accept"
+	NotifyMention       = "mention"
+	NotifyMessage       = "message"
+)
+
+// NotificationTypes lists every notification type, in the order
+// preferences are shown
+var NotificationTypes = []string{
+	NotifyFollow, NotifyComment, NotifyVote, NotifyFriendRequest,
+	NotifyFriendAccept, NotifyMention, NotifyMessage,
+}
+
+// Entity types a notification can point at
+const (
+	EntityPost          = "post"
+	EntityComment       = "comment"
+	EntityConversation  = "conversation"
+	EntityFriendRequest = "friend_request"
 )
 
+// Notification tells a user that others acted on something of theirs.
+// While unread, later events of the same type on the same entity join it
+// instead of adding rows, so it reads "Alice and 12 others upvoted your post".
 type Notification struct {
-	ID          int64     `json:"id"`
-	UserID      int64     `json:"user_id"`       // Who receives it
-	ActorID     int64     `json:"actor_id"`      // Who triggered it
-	Type        string    `json:"type"`          // e.g., "comment", "follow", "message", etc.
-	EntityID    int64     `json:"entity_id"`     // ID of related entity (post, message, etc.)
-	IsRead      bool      `json:"is_read"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID         uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID     uuid.UUID  `gorm:"type:uuid;not null;index:idx_notifications_user_updated,priority:1" json:"user_id"` // who receives it
+	ActorID    uuid.UUID  `gorm:"type:uuid;not null" json:"actor_id"`                                                // latest to act
+	ActorCount int        `gorm:"not null;default:1" json:"actor_count"`                                             // distinct actors
+	Type       string     `gorm:"size:32;not null" json:"type"`
+	EntityType string     `gorm:"size:32" json:"entity_type,omitempty"` // empty for follow and friend_accept
+	EntityID   string     `gorm:"size:64" json:"entity_id,omitempty"`
+	IsRead     bool       `gorm:"not null;default:false" json:"is_read"`
+	EmailedAt  *time.Time `json:"-"`                                                                 // last sent by email, instantly or in a digest
+	CreatedAt  time.Time  `json:"created_at"`                                                        // first event
+	UpdatedAt  time.Time  `gorm:"index:idx_notifications_user_updated,priority:2" json:"updated_at"` // latest event
+}
+
+// Summary reads like "alice and 12 others upvoted your post", given the
+// names of the most recent actors and how many there are in all
+func (n *Notification) Summary(names []string, count int) string {
+	who := names[0]
+	switch {
+	case count == 2 && len(names) > 1:
+		who += " and " + names[1]
+	case count > 1:
+		who += fmt.Sprintf(" and %d others", count-1)
+	}
+
+	switch n.Type {
+	case NotifyFollow:
+		return who + " followed you"
+	case NotifyFriendRequest:
+		return who + " sent you a friend request"
+	case NotifyFriendAccept:
+		return who + " accepted your friend request"
+	case NotifyMessage:
+		return who + " sent you a message"
+	case NotifyVote:
+		return who + " upvoted your " + n.EntityType
+	case NotifyMention:
+		return who + " mentioned you in a " + n.EntityType
+	case NotifyComment:
+		if n.EntityType == EntityComment {
+			return who + " replied to your comment"
+		}
+		return who + " commented on your post"
+	}
+	return who
+}
+
+// NotificationActor records each user who joined a notification, once
+type NotificationActor struct {
+	NotificationID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	ActorID        uuid.UUID `gorm:"type:uuid;primaryKey"`
+	CreatedAt      time.Time
+}
+
+// Delivery settings of a notification channel. Only email has a digest.
+const (
+	DeliveryOff     = "off"
+	DeliveryInstant = "instant"
+	DeliveryDaily   = "daily"
+)
+
+// NotificationPreference sets how one type of notification reaches a user:
+// listed in the app, emailed, and pushed over the real-time channel. Types
+// without a row use DefaultNotificationPreference.
+type NotificationPreference struct {
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey" json:"-"`
+	Type      string    `gorm:"size:32;primaryKey" json:"-"`
+	InApp     string    `gorm:"size:16;not null;default:instant" json:"in_app"`
+	Email     string    `gorm:"size:16;not null;default:daily" json:"email"`
+	Push      string    `gorm:"size:16;not null;default:instant" json:"push"`
+	UpdatedAt time.Time `json:"-"`
+}
+
+func DefaultNotificationPreference(userID uuid.UUID, kind string) NotificationPreference {
+	return NotificationPreference{
+		UserID: userID,
+		Type:   kind,
+		InApp:  DeliveryInstant,
+		Email:  DeliveryDaily,
+		Push:   DeliveryInstant,
+	}
+}
+
+// Off reports whether the notification reaches the user at all
+func (p *NotificationPreference) Off() bool {
+	return p.InApp == DeliveryOff && p.Email == DeliveryOff && p.Push == DeliveryOff
+}
+
+// NotificationSettings are a user's notification settings that apply to
+// every type. During quiet hours nothing is pushed or emailed; held emails
+// go out in the next digest after they end.
+type NotificationSettings struct {
+	UserID       uuid.UUID  `gorm:"type:uuid;primaryKey" json:"-"`
+	Timezone     string     `gorm:"size:64;not null;default:UTC" json:"timezone"` // IANA name
+	QuietStart   string     `gorm:"size:5" json:"quiet_start"`                    // "22:00"; empty when there are no quiet hours
+	QuietEnd     string     `gorm:"size:5" json:"quiet_end"`                      // may be before QuietStart, wrapping midnight
+	LastDigestAt *time.Time `json:"-"`
+	UpdatedAt    time.Time  `json:"-"`
+}
+
+// Quiet reports whether now falls in the user's quiet hours, read in
+// their timezone
+func (s *NotificationSettings) Quiet(now time.Time) bool {
+	if s.QuietStart == "" || s.QuietEnd == "" || s.QuietStart == s.QuietEnd {
+		return false
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	clock := now.In(loc).Format("15:04")
+	if s.QuietStart < s.QuietEnd {
+		return clock >= s.QuietStart && clock < s.QuietEnd
+	}
+	return clock >= s.QuietStart || clock < s.QuietEnd
 }
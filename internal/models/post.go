@@ -2,14 +2,27 @@ package models
 
 import (
 	"time"
+
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type Post struct {
-	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
-	UserID    uuid.UUID `gorm:"type:uuid;not null" json:"user_id"` // Foreign key
-	Title     string    `gorm:"size:255;not null" json:"title"`
-	Content   string    `gorm:"type:text" json:"content"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID      uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID  uuid.UUID `gorm:"type:uuid;not null" json:"user_id"` // Foreign key
+	Title   string    `gorm:"size:255;not null" json:"title"`
+	Content string    `gorm:"type:text" json:"content"`
+	// Counters maintained alongside votes and comments
+	Score        int64 `gorm:"not null;default:0" json:"score"`
+	Upvotes      int64 `gorm:"not null;default:0" json:"upvotes"`
+	Downvotes    int64 `gorm:"not null;default:0" json:"downvotes"`
+	CommentCount int64 `gorm:"not null;default:0" json:"comment_count"`
+	// Set once the post is in its followers' timelines; timelines pull the
+	// rest live, so a post keeps showing however its author's following changes
+	FannedOut bool           `gorm:"not null;default:false" json:"-"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	EditedAt  *time.Time     `json:"edited_at,omitempty"` // last edit of title or content
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`      // restorable until purged
+	DeletedBy *uuid.UUID     `gorm:"type:uuid" json:"-"`
 }
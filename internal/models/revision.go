@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PostRevision is one version of a post. Revision 1 is the original text;
+// every edit adds the next number.
+type PostRevision struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	PostID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_post_revision" json:"post_id"`
+	Number    int       `gorm:"not null;uniqueIndex:idx_post_revision" json:"number"`
+	EditorID  uuid.UUID `gorm:"type:uuid;not null" json:"editor_id"`
+	Title     string    `gorm:"size:255;not null" json:"title"`
+	Content   string    `gorm:"type:text" json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CommentRevision is one version of a comment, numbered like PostRevision
+type CommentRevision struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	CommentID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_comment_revision" json:"comment_id"`
+	Number    int       `gorm:"not null;uniqueIndex:idx_comment_revision" json:"number"`
+	EditorID  uuid.UUID `gorm:"type:uuid;not null" json:"editor_id"`
+	Content   string    `gorm:"type:text;not null" json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TimelineEntry is a post pushed into a follower's materialized timeline
+type TimelineEntry struct {
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey"` // timeline owner
+	PostID    uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	AuthorID  uuid.UUID `gorm:"type:uuid;not null;index"`
+	CreatedAt time.Time `gorm:"not null"` // when the post was created
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TrendingPost is a post's place in a trending window, rewritten on every
+// refresh
+type TrendingPost struct {
+	Window     string    `gorm:"column:time_window;size:8;primaryKey"` // 1h, 24h or 7d
+	PostID     uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	Rank       int       `gorm:"not null"` // 1 is the hottest
+	Score      float64   `gorm:"not null"`
+	ComputedAt time.Time `gorm:"not null"`
+}
@@ -4,19 +4,74 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Roles, from least to most privileged
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
 )
 
 type User struct {
-	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
-	Username  string    `gorm:"unique;not null" json:"username"`
-	Email     string    `gorm:"unique;not null" json:"email"`
-	Password  string    `json:"-"`
-	Avatar    string    `json:"avatar,omitempty"`
-	Bio       string    `gorm:"size:500" json:"bio,omitempty"`
-	Website   string    `gorm:"size:255" json:"website,omitempty"`
-	Location  string    `gorm:"size:100" json:"location,omitempty"`
-	IsPrivate bool      `gorm:"default:false" json:"is_private"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID            uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	Username      string    `gorm:"unique;not null" json:"username"`
+	Email         string    `gorm:"unique;not null" json:"email"`
+	EmailVerified bool      `gorm:"not null;default:false" json:"email_verified"` // set by /verify-email
+	Password      string    `json:"-"`
+	Avatar        string    `json:"avatar,omitempty"`
+	Bio           string    `gorm:"size:500" json:"bio,omitempty"`
+	Website       string    `gorm:"size:255" json:"website,omitempty"`
+	Location      string    `gorm:"size:100" json:"location,omitempty"`
+	IsPrivate     bool      `gorm:"default:false" json:"is_private"`
+	// Counters maintained alongside follows and posts
+	FollowerCount  int64 `gorm:"not null;default:0" json:"follower_count"`
+	FollowingCount int64 `gorm:"not null;default:0" json:"following_count"`
+	PostCount      int64 `gorm:"not null;default:0" json:"post_count"`
+	// Staff-only fields; the admin user listing shows them as AdminUser
+	Role          string         `gorm:"size:16;not null;default:user" json:"-"`
+	SuspendedAt   *time.Time     `json:"-"` // suspended accounts cannot sign in
+	SuspendReason string         `gorm:"size:255" json:"-"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"` // restorable until purged
+	DeletedBy     *uuid.UUID     `gorm:"type:uuid" json:"-"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
 	// Other fields...
 }
+
+// Mute kinds
+const (
+	MuteAccount = "account"
+	MuteKeyword = "keyword"
+	MuteHashtag = "hashtag"
+)
+
+// Mute hides an account, word or hashtag from one user's reads. The muted
+// side is never told.
+type Mute struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"` // who muted
+	Kind      string     `gorm:"size:16;not null" json:"kind"`
+	TargetID  *uuid.UUID `gorm:"type:uuid" json:"target_id,omitempty"` // muted account
+	Word      string     `gorm:"size:100" json:"word,omitempty"`       // lowercased; hashtags keep their '#'
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`                 // nil mutes forever
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Active reports whether the mute still applies at now
+func (m *Mute) Active(now time.Time) bool {
+	return m.ExpiresAt == nil || now.Before(*m.ExpiresAt)
+}
+
+// AdminUser is a user as staff see them, with their role and suspension
+type AdminUser struct {
+	User
+	Role          string     `json:"role"`
+	SuspendedAt   *time.Time `json:"suspended_at,omitempty"`
+	SuspendReason string     `json:"suspend_reason,omitempty"`
+}
+
+func NewAdminUser(u User) AdminUser {
+	return AdminUser{User: u, Role: u.Role, SuspendedAt: u.SuspendedAt, SuspendReason: u.SuspendReason}
+}
@@ -14,3 +14,13 @@ type Vote struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
+
+// CommentVote is a vote on a comment; a user has at most one per comment
+type CommentVote struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_comment_vote"`
+	CommentID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_comment_vote;index"`
+	Value     int8      `gorm:"not null"` // +1 for upvote, -1 for downvote
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
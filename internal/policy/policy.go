@@ -0,0 +1,147 @@
+// Package policy decides who may change what. Handlers load the resource,
+// ask here, and answer 403 when the answer is no.
+package policy
+
+import (
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/google/uuid"
+)
+
+// Actor is the authenticated user a decision is made for
+type Actor struct {
+	ID   uuid.UUID
+	Role string
+}
+
+// roleRank orders roles; each role holds every permission of those below it
+var roleRank = map[string]int{
+	models.RoleUser:      1,
+	models.RoleModerator: 2,
+	models.RoleAdmin:     3,
+}
+
+// ValidRole reports whether role is one of the known roles
+func ValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// HasRole reports whether role is min or above. Unknown roles have none.
+func HasRole(role, min string) bool {
+	rank, ok := roleRank[role]
+	return ok && rank >= roleRank[min]
+}
+
+func (a Actor) IsAdmin() bool {
+	return HasRole(a.Role, models.RoleAdmin)
+}
+
+// IsModerator is also true for admins
+func (a Actor) IsModerator() bool {
+	return HasRole(a.Role, models.RoleModerator)
+}
+
+// Only authors edit their own words. Moderators and admins may remove them.
+
+func CanEditPost(a Actor, p *models.Post) bool {
+	return a.ID == p.UserID
+}
+
+func CanDeletePost(a Actor, p *models.Post) bool {
+	return a.ID == p.UserID || a.IsModerator()
+}
+
+func CanEditComment(a Actor, c *models.Comment) bool {
+	return a.ID == c.UserID
+}
+
+// CanDeleteComment also lets the post's author clean up their own thread
+func CanDeleteComment(a Actor, c *models.Comment, post *models.Post) bool {
+	return a.ID == c.UserID || a.ID == post.UserID || a.IsModerator()
+}
+
+// Deleted posts and comments come back only through whoever deleted them,
+// or a moderator, so an author cannot undo a removal by staff.
+
+func CanRestorePost(a Actor, p *models.Post) bool {
+	return deletedBy(a, p.DeletedBy, p.UserID) || a.IsModerator()
+}
+
+func CanRestoreComment(a Actor, c *models.Comment) bool {
+	return deletedBy(a, c.DeletedBy, c.UserID) || a.IsModerator()
+}
+
+// CanRestoreAccount tells whether the owner may restore their own account;
+// accounts deleted by an admin are restored by an admin
+func CanRestoreAccount(u *models.User) bool {
+	return deletedBy(Actor{ID: u.ID}, u.DeletedBy, u.ID)
+}
+
+// deletedBy reports whether a removed the item; rows deleted before this was
+// recorded count as removed by their owner
+func deletedBy(a Actor, by *uuid.UUID, owner uuid.UUID) bool {
+	if by == nil {
+		return a.ID == owner
+	}
+	return a.ID == *by
+}
+
+// Accounts are managed by their owner, or by an admin.
+
+func CanEditProfile(a Actor, u *models.User) bool {
+	return a.ID == u.ID || a.IsAdmin()
+}
+
+func CanDeleteAccount(a Actor, u *models.User) bool {
+	return a.ID == u.ID || a.IsAdmin()
+}
+
+// CanChangePassword is owner only; the old password is checked as well
+func CanChangePassword(a Actor, u *models.User) bool {
+	return a.ID == u.ID
+}
+
+// Staff actions. Nobody acts on themselves, and moderators only act on
+// regular users.
+
+func CanSuspend(a Actor, u *models.User) bool {
+	if a.ID == u.ID {
+		return false
+	}
+	return a.IsAdmin() || (a.IsModerator() && !HasRole(u.Role, models.RoleModerator))
+}
+
+func CanChangeRole(a Actor, u *models.User) bool {
+	return a.ID != u.ID && a.IsAdmin()
+}
+
+// Groups are run by their owner and admins. Admins manage plain members;
+// only the owner manages admins or hands over the group.
+
+// groupRank orders roles within a group like roleRank does site-wide
+var groupRank = map[string]int{
+	models.GroupMember: 1,
+	models.GroupAdmin:  2,
+	models.GroupOwner:  3,
+}
+
+// ValidGroupRole reports whether role is one of the roles within a group
+func ValidGroupRole(role string) bool {
+	_, ok := groupRank[role]
+	return ok
+}
+
+// CanManageGroup covers renaming, adding members and invite links
+func CanManageGroup(m *models.ConversationMember) bool {
+	return groupRank[m.Role] >= groupRank[models.GroupAdmin]
+}
+
+// CanRemoveMember lets the owner remove anyone and admins remove plain
+// members. Leaving is not removal and needs no permission.
+func CanRemoveMember(m, target *models.ConversationMember) bool {
+	return m.UserID != target.UserID && CanManageGroup(m) && groupRank[m.Role] > groupRank[target.Role]
+}
+
+func CanChangeGroupRole(m, target *models.ConversationMember) bool {
+	return m.UserID != target.UserID && m.Role == models.GroupOwner
+}
@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter allows at most max events per key within a sliding window. It is
+// safe for concurrent use and keeps state in memory only.
+type Limiter struct {
+	mu     sync.Mutex
+	max    int
+	window time.Duration
+	events map[string][]time.Time
+	swept  time.Time
+}
+
+func New(max int, window time.Duration) *Limiter {
+	return &Limiter{
+		max:    max,
+		window: window,
+		events: make(map[string][]time.Time),
+	}
+}
+
+// Allow records an event for key and reports whether it is within the limit
+func (l *Limiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-l.window)
+
+	if now.Sub(l.swept) > l.window {
+		l.sweep(cutoff)
+		l.swept = now
+	}
+
+	recent := prune(l.events[key], cutoff)
+	if len(recent) >= l.max {
+		l.events[key] = recent
+		return false
+	}
+	l.events[key] = append(recent, now)
+	return true
+}
+
+// sweep drops keys with no events inside the window so memory stays bounded
+func (l *Limiter) sweep(cutoff time.Time) {
+	for key, times := range l.events {
+		if recent := prune(times, cutoff); len(recent) == 0 {
+			delete(l.events, key)
+		} else {
+			l.events[key] = recent
+		}
+	}
+}
+
+func prune(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	return times[i:]
+}
@@ -0,0 +1,344 @@
+package search
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BM25 parameters, at their usual values
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+const (
+	// minPrefix is the shortest prefix a prefix field matches on
+	minPrefix = 2
+	// prefixWeight discounts a prefix match against a whole-word one
+	prefixWeight = 0.5
+	// snippetWords bounds a highlight; snippetLead words of context come
+	// before the first match
+	snippetWords = 30
+	snippetLead  = 5
+)
+
+// field is one searchable text of a document
+type field struct {
+	name  string // key in Hit.Highlights
+	boost float64
+	// prefixes also matches words by their beginning, for typeahead
+	prefixes bool
+}
+
+type document struct {
+	id        uuid.UUID
+	authorID  uuid.UUID
+	createdAt time.Time
+	texts     []string // per field, kept for highlighting
+	tags      map[string]bool
+	keys      []string // postings the document is listed in
+	length    float64  // boosted word count
+}
+
+// occurrences holds a term's word positions in each field of a document
+type occurrences [][]int
+
+// index is an inverted index with word positions, which answers phrase
+// queries, and BM25 ranking. It is not safe for concurrent use.
+type index struct {
+	fields      []field
+	docs        map[uuid.UUID]*document
+	postings    map[string]map[uuid.UUID]occurrences
+	totalLength float64
+}
+
+func newIndex(fields []field) *index {
+	return &index{
+		fields:   fields,
+		docs:     map[uuid.UUID]*document{},
+		postings: map[string]map[uuid.UUID]occurrences{},
+	}
+}
+
+// prefixKey lists a word under one of its prefixes, apart from whole words
+func prefixKey(prefix string) string {
+	return "\x00" + prefix
+}
+
+// put adds or replaces a document; texts follow the index's fields
+func (ix *index) put(id, authorID uuid.UUID, createdAt time.Time, texts ...string) {
+	ix.remove(id)
+
+	d := &document{id: id, authorID: authorID, createdAt: createdAt, texts: texts, tags: map[string]bool{}}
+	for f, text := range texts {
+		tokens := tokenize(text)
+		d.length += ix.fields[f].boost * float64(len(tokens))
+		for pos, t := range tokens {
+			ix.add(d, t.term, f, pos)
+			if ix.fields[f].prefixes {
+				rs := []rune(t.term)
+				for n := minPrefix; n < len(rs); n++ {
+					ix.add(d, prefixKey(string(rs[:n])), f, pos)
+				}
+			}
+		}
+		for _, tag := range Tags(text) {
+			d.tags[tag] = true
+		}
+	}
+
+	ix.docs[id] = d
+	ix.totalLength += d.length
+}
+
+func (ix *index) add(d *document, key string, f, pos int) {
+	docs := ix.postings[key]
+	if docs == nil {
+		docs = map[uuid.UUID]occurrences{}
+		ix.postings[key] = docs
+	}
+	occ, ok := docs[d.id]
+	if !ok {
+		occ = make(occurrences, len(ix.fields))
+		d.keys = append(d.keys, key)
+	}
+	occ[f] = append(occ[f], pos)
+	docs[d.id] = occ
+}
+
+func (ix *index) remove(id uuid.UUID) {
+	d, ok := ix.docs[id]
+	if !ok {
+		return
+	}
+	for _, key := range d.keys {
+		delete(ix.postings[key], id)
+		if len(ix.postings[key]) == 0 {
+			delete(ix.postings, key)
+		}
+	}
+	ix.totalLength -= d.length
+	delete(ix.docs, id)
+}
+
+// match is a document that satisfies a query, with its BM25 score
+type match struct {
+	doc   *document
+	score float64
+}
+
+// search returns the documents matching q that keep accepts, best first.
+// An empty query matches every document, newest first.
+func (ix *index) search(q Query, keep func(*document) bool) []match {
+	var candidates map[uuid.UUID]bool
+	if q.Empty() {
+		candidates = make(map[uuid.UUID]bool, len(ix.docs))
+		for id := range ix.docs {
+			candidates[id] = true
+		}
+	}
+	for i, clause := range q.Clauses {
+		found := map[uuid.UUID]bool{}
+		for _, phrase := range clause {
+			for id := range ix.phraseDocs(phrase) {
+				if i == 0 || candidates[id] {
+					found[id] = true
+				}
+			}
+		}
+		candidates = found
+	}
+	for _, phrase := range q.Excluded {
+		for id := range ix.phraseDocs(phrase) {
+			delete(candidates, id)
+		}
+	}
+
+	terms := q.Terms()
+	matches := make([]match, 0, len(candidates))
+	for id := range candidates {
+		d := ix.docs[id]
+		if keep(d) {
+			matches = append(matches, match{doc: d, score: ix.score(d, terms)})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if !a.doc.createdAt.Equal(b.doc.createdAt) {
+			return a.doc.createdAt.After(b.doc.createdAt)
+		}
+		return a.doc.id.String() < b.doc.id.String()
+	})
+	return matches
+}
+
+// lookup returns where term occurs in each document, prefix matches
+// included
+func (ix *index) lookup(term string) map[uuid.UUID]occurrences {
+	exact, prefix := ix.postings[term], ix.postings[prefixKey(term)]
+	if len(prefix) == 0 {
+		return exact
+	}
+
+	merged := make(map[uuid.UUID]occurrences, len(exact)+len(prefix))
+	for id, occ := range exact {
+		merged[id] = occ
+	}
+	for id, occ := range prefix {
+		have, ok := merged[id]
+		if !ok {
+			merged[id] = occ
+			continue
+		}
+		both := make(occurrences, len(ix.fields))
+		for f := range both {
+			both[f] = append(slices.Clone(have[f]), occ[f]...)
+		}
+		merged[id] = both
+	}
+	return merged
+}
+
+// phraseDocs returns the documents where the phrase's terms appear in
+// order, next to each other, within one field
+func (ix *index) phraseDocs(phrase Phrase) map[uuid.UUID]bool {
+	lists := make([]map[uuid.UUID]occurrences, len(phrase))
+	for i, term := range phrase {
+		lists[i] = ix.lookup(term)
+		if len(lists[i]) == 0 {
+			return nil
+		}
+	}
+
+	docs := map[uuid.UUID]bool{}
+	for id, first := range lists[0] {
+		if adjacent(lists, id, first) {
+			docs[id] = true
+		}
+	}
+	return docs
+}
+
+func adjacent(lists []map[uuid.UUID]occurrences, id uuid.UUID, first occurrences) bool {
+	for f, positions := range first {
+	next:
+		for _, pos := range positions {
+			for k := 1; k < len(lists); k++ {
+				occ, ok := lists[k][id]
+				if !ok || !slices.Contains(occ[f], pos+k) {
+					continue next
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// score is the document's BM25 score for terms, with term frequencies
+// weighted by field boost
+func (ix *index) score(d *document, terms []string) float64 {
+	n := float64(len(ix.docs))
+	avgLength := ix.totalLength / n
+	if avgLength <= 0 {
+		avgLength = 1
+	}
+
+	var score float64
+	for _, term := range terms {
+		exact, prefix := ix.postings[term], ix.postings[prefixKey(term)]
+		tf := ix.frequency(exact[d.id]) + prefixWeight*ix.frequency(prefix[d.id])
+		if tf == 0 {
+			continue
+		}
+		df := float64(max(len(exact), len(prefix)))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		score += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*d.length/avgLength))
+	}
+	return score
+}
+
+func (ix *index) frequency(occ occurrences) float64 {
+	var tf float64
+	for f, positions := range occ {
+		tf += ix.fields[f].boost * float64(len(positions))
+	}
+	return tf
+}
+
+// highlight marks the query terms in each field of the document that has
+// one, cutting long texts down to a snippet around the first match
+func (ix *index) highlight(d *document, terms []string) map[string]string {
+	highlights := map[string]string{}
+	for f, text := range d.texts {
+		tokens := tokenize(text)
+		var matched []int
+		for i, t := range tokens {
+			if ix.matches(f, t.term, terms) {
+				matched = append(matched, i)
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+
+		first, last := 0, len(tokens)
+		if len(tokens) > snippetWords {
+			first = max(0, matched[0]-snippetLead)
+			last = min(len(tokens), first+snippetWords)
+		}
+
+		var b strings.Builder
+		start := tokens[first].start
+		if first > 0 {
+			b.WriteString("… ")
+		} else {
+			start = 0
+		}
+		end := tokens[last-1].end
+		if last == len(tokens) {
+			end = len(text)
+		}
+		pos := start
+		for _, i := range matched {
+			if i < first || i >= last {
+				continue
+			}
+			t := tokens[i]
+			b.WriteString(text[pos:t.start])
+			b.WriteString(markOpen + text[t.start:t.end] + markClose)
+			pos = t.end
+		}
+		b.WriteString(text[pos:end])
+		if last < len(tokens) {
+			b.WriteString(" …")
+		}
+
+		if snippet, ok := markup(b.String()); ok {
+			highlights[ix.fields[f].name] = snippet
+		}
+	}
+	return highlights
+}
+
+// matches reports whether a word of field f is one of the terms, or starts
+// with one in a prefix field
+func (ix *index) matches(f int, word string, terms []string) bool {
+	for _, term := range terms {
+		if word == term {
+			return true
+		}
+		if ix.fields[f].prefixes && len([]rune(term)) >= minPrefix && strings.HasPrefix(word, term) {
+			return true
+		}
+	}
+	return false
+}
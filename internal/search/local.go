@@ -0,0 +1,143 @@
+package search
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+	"github.com/google/uuid"
+)
+
+const (
+	// syncOverlap re-reads changes this far behind the newest one indexed,
+	// so rows committed late with an earlier timestamp are not missed
+	syncOverlap = time.Minute
+	// rebuildInterval bounds how long purged rows, which leave no trace to
+	// sync from, stay in an index
+	rebuildInterval = time.Hour
+)
+
+// localKind is the index of one kind and where its documents come from
+type localKind struct {
+	fields []field
+	load   func(since time.Time) ([]store.SearchDoc, error)
+	texts  func(d store.SearchDoc) []string
+
+	index   *index
+	synced  time.Time // newest UpdatedAt indexed
+	builtAt time.Time
+}
+
+// Local is the engine for the embedded mode. It keeps an inverted index in
+// memory and brings it up to date from the database before every search,
+// so writes need no hooks.
+type Local struct {
+	mu    sync.Mutex
+	kinds map[Kind]*localKind
+}
+
+// NewLocal builds the indexes from the database
+func NewLocal(docs store.SearchStore) (*Local, error) {
+	titleAndBody := func(d store.SearchDoc) []string { return []string{d.Title, d.Body} }
+	l := &Local{kinds: map[Kind]*localKind{
+		Posts: {
+			fields: []field{{name: "title", boost: 2}, {name: "content", boost: 1}},
+			load:   docs.PostDocs,
+			texts:  titleAndBody,
+		},
+		Comments: {
+			fields: []field{{name: "content", boost: 1}},
+			load:   docs.CommentDocs,
+			texts:  func(d store.SearchDoc) []string { return []string{d.Body} },
+		},
+		Users: {
+			fields: []field{{name: "username", boost: 3, prefixes: true}, {name: "bio", boost: 1}},
+			load:   docs.UserDocs,
+			texts:  titleAndBody,
+		},
+	}}
+
+	for kind, k := range l.kinds {
+		if err := k.sync(time.Now()); err != nil {
+			return nil, fmt.Errorf("build %s index: %w", kind, err)
+		}
+	}
+	return l, nil
+}
+
+func (l *Local) Search(r Request) ([]Hit, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	k, ok := l.kinds[r.Kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown search kind %q", r.Kind)
+	}
+	if err := k.sync(time.Now()); err != nil {
+		return nil, err
+	}
+
+	q := Parse(r.Text)
+	if r.Limit <= 0 {
+		return nil, nil
+	}
+	offset := max(r.Offset, 0)
+	matches := k.index.search(q, r.keeps)
+	matches = matches[min(offset, len(matches)):min(offset+r.Limit, len(matches))]
+
+	terms := q.Terms()
+	hits := make([]Hit, len(matches))
+	for i, m := range matches {
+		hits[i] = Hit{ID: m.doc.id, Score: m.score, Highlights: k.index.highlight(m.doc, terms)}
+	}
+	return hits, nil
+}
+
+// sync indexes rows changed since the last sync, or rebuilds the index from
+// scratch once it is older than rebuildInterval
+func (k *localKind) sync(now time.Time) error {
+	ix, synced := k.index, k.synced
+	rebuild := ix == nil || now.Sub(k.builtAt) > rebuildInterval
+	since := time.Time{}
+	if rebuild {
+		ix, synced = newIndex(k.fields), time.Time{}
+	} else if !synced.IsZero() {
+		since = synced.Add(-syncOverlap)
+	}
+
+	docs, err := k.load(since)
+	if err != nil {
+		return err
+	}
+	for _, d := range docs {
+		if d.UpdatedAt.After(synced) {
+			synced = d.UpdatedAt
+		}
+		if d.Deleted {
+			ix.remove(d.ID)
+			continue
+		}
+		ix.put(d.ID, d.AuthorID, d.CreatedAt, k.texts(d)...)
+	}
+
+	k.index, k.synced = ix, synced
+	if rebuild {
+		k.builtAt = now
+	}
+	return nil
+}
+
+// keeps applies the request's filters to a document
+func (r Request) keeps(d *document) bool {
+	if r.AuthorID != uuid.Nil && d.authorID != r.AuthorID {
+		return false
+	}
+	if !r.From.IsZero() && d.createdAt.Before(r.From) {
+		return false
+	}
+	if !r.To.IsZero() && !d.createdAt.Before(r.To) {
+		return false
+	}
+	return r.Tag == "" || d.tags[r.Tag]
+}
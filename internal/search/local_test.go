@@ -0,0 +1,83 @@
+package search
+
+import (
+	"testing"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/config"
+	db "github.com/am4rknvl/local-micro-blogging-service.git/internal/database"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+	"github.com/google/uuid"
+)
+
+func TestLocalSearchPaging(t *testing.T) {
+	conn, err := db.Open(config.DatabaseConfig{
+		Driver:       db.DriverSQLite,
+		DSN:          "file:localsearch?mode=memory&cache=shared",
+		MaxOpenConns: 1,
+		MaxIdleConns: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := conn.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	s := store.New(conn)
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	author := models.User{ID: uuid.New(), Username: "author", Email: "author@example.com", EmailVerified: true}
+	if err := s.Users.Create(&author); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 3 {
+		post := models.Post{ID: uuid.New(), UserID: author.ID, Title: "hello", Content: "paging", CreatedAt: time.Now().Add(time.Duration(i) * time.Second)}
+		if err := s.Posts.Create(&post); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l, err := NewLocal(s.Search)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := l.Search(Request{Kind: Posts, Text: "hello", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("%d hits, want 3", len(all))
+	}
+
+	for _, tc := range []struct {
+		name          string
+		limit, offset int
+		want          []Hit
+	}{
+		{"zero limit", 0, 0, nil},
+		{"negative limit", -1, 0, nil},
+		{"negative offset", 2, -1, all[:2]},
+		{"offset", 2, 1, all[1:]},
+		{"offset past the end", 2, 5, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hits, err := l.Search(Request{Kind: Posts, Text: "hello", Limit: tc.limit, Offset: tc.offset})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(hits) != len(tc.want) {
+				t.Fatalf("%d hits, want %d", len(hits), len(tc.want))
+			}
+			for i := range hits {
+				if hits[i].ID != tc.want[i].ID {
+					t.Errorf("hit %d is %s, want %s", i, hits[i].ID, tc.want[i].ID)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// tsQuery parses the request text; websearch_to_tsquery understands the
+// same syntax as Parse
+const tsQuery = "websearch_to_tsquery('english', ?)"
+
+// headlineOptions makes ts_headline mark matches the way markup expects
+const headlineOptions = `StartSel="` + markOpen + `", StopSel="` + markClose + `", ` +
+	`MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=" … "`
+
+// pgKind is the table searched for a kind and its highlighted columns, in
+// the order of their highlightN aliases
+type pgKind struct {
+	table   string
+	vector  string // expression the search_vector column is generated from
+	columns []string
+	fields  []string // Hit.Highlights keys of columns
+	author  string   // column filtered by Request.AuthorID
+}
+
+var pgKinds = map[Kind]pgKind{
+	Posts: {
+		table: "posts",
+		vector: `setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+			setweight(to_tsvector('english', coalesce(content, '')), 'B')`,
+		columns: []string{"posts.title", "posts.content"},
+		fields:  []string{"title", "content"},
+		author:  "posts.user_id",
+	},
+	Comments: {
+		table:   "comments",
+		vector:  `to_tsvector('english', coalesce(content, ''))`,
+		columns: []string{"comments.content"},
+		fields:  []string{"content"},
+		author:  "comments.user_id",
+	},
+	Users: {
+		table: "users",
+		vector: `setweight(to_tsvector('english', coalesce(username, '')), 'A') ||
+			setweight(to_tsvector('english', coalesce(bio, '')), 'B')`,
+		columns: []string{"users.username", "users.bio"},
+		fields:  []string{"username", "bio"},
+	},
+}
+
+// Postgres searches generated tsvector columns through GIN indexes. The
+// database keeps the columns current, so writes need no hooks.
+type Postgres struct {
+	db *gorm.DB
+}
+
+// NewPostgres adds the search_vector columns and their indexes if missing
+func NewPostgres(db *gorm.DB) (*Postgres, error) {
+	for _, k := range pgKinds {
+		statements := []string{
+			`ALTER TABLE ` + k.table + ` ADD COLUMN IF NOT EXISTS search_vector tsvector
+				GENERATED ALWAYS AS (` + k.vector + `) STORED`,
+			`CREATE INDEX IF NOT EXISTS idx_` + k.table + `_search_vector ON ` + k.table + ` USING GIN (search_vector)`,
+		}
+		for _, stmt := range statements {
+			if err := db.Exec(stmt).Error; err != nil {
+				return nil, fmt.Errorf("set up %s search: %w", k.table, err)
+			}
+		}
+	}
+	return &Postgres{db: db}, nil
+}
+
+// pgHit is a row of a search query; highlights are read positionally
+type pgHit struct {
+	ID         uuid.UUID
+	Score      float64
+	Highlight0 string
+	Highlight1 string
+}
+
+func (p *Postgres) Search(r Request) ([]Hit, error) {
+	k, ok := pgKinds[r.Kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown search kind %q", r.Kind)
+	}
+
+	query := p.db.Table(k.table).Where(k.table + ".deleted_at IS NULL")
+	if q := Parse(r.Text); q.Empty() {
+		// Filters only: newest first, nothing to highlight
+		query = query.Select(k.table + ".id, 0 AS score")
+		if len(q.Excluded) > 0 {
+			query = query.Where("NOT ("+k.table+".search_vector @@ "+tsQuery+")", excluded(q))
+		}
+	} else {
+		columns := []string{k.table + ".id"}
+		rank := "ts_rank_cd(" + k.table + ".search_vector, " + tsQuery + ")"
+		args := []interface{}{r.Text}
+		match := "(" + k.table + ".search_vector @@ " + tsQuery
+		matchArgs := []interface{}{r.Text}
+		if r.Kind == Users {
+			// Usernames also match as typed prefixes, ranked below exact ones
+			prefix := likePrefix(r.Text)
+			rank += " + CASE WHEN LOWER(users.username) = ? THEN 1 WHEN LOWER(users.username) LIKE ? THEN 0.5 ELSE 0 END"
+			args = append(args, strings.ToLower(strings.TrimSpace(r.Text)), prefix)
+			match += " OR LOWER(users.username) LIKE ?"
+			matchArgs = append(matchArgs, prefix)
+		}
+		columns = append(columns, rank+" AS score")
+		for i, column := range k.columns {
+			columns = append(columns, fmt.Sprintf("ts_headline('english', coalesce(%s, ''), %s, ?) AS highlight%d", column, tsQuery, i))
+			args = append(args, r.Text, headlineOptions)
+		}
+		query = query.Select(strings.Join(columns, ", "), args...).Where(match+")", matchArgs...)
+	}
+
+	if r.Kind != Users {
+		if r.AuthorID != uuid.Nil {
+			query = query.Where(k.author+" = ?", r.AuthorID)
+		}
+		if !r.From.IsZero() {
+			query = query.Where(k.table+".created_at >= ?", r.From)
+		}
+		if !r.To.IsZero() {
+			query = query.Where(k.table+".created_at < ?", r.To)
+		}
+		if r.Tag != "" {
+			// Tags are letters, digits and underscores, safe inside the pattern
+			query = query.Where("("+strings.Join(k.columns, " || ' ' || ")+") ~* ?",
+				`(^|[^[:alnum:]_])#`+r.Tag+`([^[:alnum:]_]|$)`)
+		}
+	}
+
+	var rows []pgHit
+	err := query.Order("score DESC, " + k.table + ".created_at DESC, " + k.table + ".id").
+		Limit(r.Limit).Offset(r.Offset).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make([]Hit, len(rows))
+	for i, row := range rows {
+		hits[i] = Hit{ID: row.ID, Score: row.Score, Highlights: map[string]string{}}
+		for f, snippet := range []string{row.Highlight0, row.Highlight1}[:len(k.fields)] {
+			if marked, ok := markup(snippet); ok {
+				hits[i].Highlights[k.fields[f]] = marked
+			}
+		}
+	}
+	return hits, nil
+}
+
+// excluded rewrites the exclusions of q as a query matching any of them
+func excluded(q Query) string {
+	phrases := make([]string, len(q.Excluded))
+	for i, phrase := range q.Excluded {
+		phrases[i] = `"` + strings.Join(phrase, " ") + `"`
+	}
+	return strings.Join(phrases, " OR ")
+}
+
+// likePrefix matches values starting with text, taken literally
+func likePrefix(text string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(strings.TrimSpace(text)))
+	return escaped + "%"
+}
@@ -0,0 +1,194 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Phrase is a run of terms that must appear next to each other, in order. A
+// single word is a phrase of one term.
+type Phrase []string
+
+// Query is a parsed search string. The syntax follows Postgres'
+// websearch_to_tsquery so both engines read it the same way: every word
+// must match, "quoted words" match as a phrase, OR between two items
+// matches either of them and a leading - excludes an item.
+type Query struct {
+	// Clauses must all match; a clause matches when any of its phrases does
+	Clauses  [][]Phrase
+	Excluded []Phrase
+}
+
+// Parse never fails; characters that are not part of a word are ignored
+func Parse(text string) Query {
+	var q Query
+	or := false
+	for _, it := range splitItems(text) {
+		if !it.quoted && !it.negated && strings.EqualFold(it.text, "or") {
+			or = len(q.Clauses) > 0
+			continue
+		}
+
+		var phrase Phrase
+		for _, t := range tokenize(it.text) {
+			phrase = append(phrase, t.term)
+		}
+		if len(phrase) == 0 {
+			continue
+		}
+
+		switch {
+		case it.negated:
+			q.Excluded = append(q.Excluded, phrase)
+		case or:
+			last := len(q.Clauses) - 1
+			q.Clauses[last] = append(q.Clauses[last], phrase)
+		default:
+			q.Clauses = append(q.Clauses, []Phrase{phrase})
+		}
+		or = false
+	}
+	return q
+}
+
+// Empty reports whether the query matches on nothing but its exclusions
+func (q Query) Empty() bool {
+	return len(q.Clauses) == 0
+}
+
+// Terms returns the distinct terms the query looks for
+func (q Query) Terms() []string {
+	seen := map[string]bool{}
+	var terms []string
+	for _, clause := range q.Clauses {
+		for _, phrase := range clause {
+			for _, t := range phrase {
+				if !seen[t] {
+					seen[t] = true
+					terms = append(terms, t)
+				}
+			}
+		}
+	}
+	return terms
+}
+
+// item is a word or quoted phrase of a query string
+type item struct {
+	text    string
+	quoted  bool
+	negated bool
+}
+
+func splitItems(text string) []item {
+	var items []item
+	rs := []rune(text)
+	for i := 0; i < len(rs); {
+		if unicode.IsSpace(rs[i]) {
+			i++
+			continue
+		}
+
+		var it item
+		if rs[i] == '-' && i+1 < len(rs) && !unicode.IsSpace(rs[i+1]) {
+			it.negated = true
+			i++
+		}
+
+		end := i
+		if rs[i] == '"' {
+			it.quoted = true
+			end = i + 1
+			for end < len(rs) && rs[end] != '"' {
+				end++
+			}
+			it.text = string(rs[i+1 : end])
+			end++ // closing quote
+		} else {
+			for end < len(rs) && !unicode.IsSpace(rs[end]) && rs[end] != '"' {
+				end++
+			}
+			it.text = string(rs[i:end])
+		}
+		items = append(items, it)
+		i = end
+	}
+	return items
+}
+
+// token is a word of a text with its byte offsets
+type token struct {
+	term       string
+	start, end int
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// tokenize splits text into lowercased runs of letters and digits
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, token{strings.ToLower(text[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{strings.ToLower(text[start:]), start, len(text)})
+	}
+	return tokens
+}
+
+func isTagRune(r rune) bool {
+	return isWordRune(r) || r == '_'
+}
+
+// Tags returns the distinct hashtags in text, lowercased and without their
+// '#'. A hashtag starts at a '#' that does not follow a word character.
+func Tags(text string) []string {
+	var tags []string
+	seen := map[string]bool{}
+	rs := []rune(text)
+	for i := 0; i < len(rs); i++ {
+		if rs[i] != '#' || (i > 0 && isTagRune(rs[i-1])) {
+			continue
+		}
+		end := i + 1
+		for end < len(rs) && isTagRune(rs[end]) {
+			end++
+		}
+		if end > i+1 {
+			tag := strings.ToLower(string(rs[i+1 : end]))
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+		i = end - 1
+	}
+	return tags
+}
+
+// NormalizeTag turns "#Go" or "go" into "go". It reports false for
+// anything that is not a single hashtag.
+func NormalizeTag(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+	if tag == "" {
+		return "", false
+	}
+	for _, r := range tag {
+		if !isTagRune(r) {
+			return "", false
+		}
+	}
+	return tag, true
+}
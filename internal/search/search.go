@@ -0,0 +1,93 @@
+// Package search finds posts, comments and users by their text. Two engines
+// implement Searcher: Postgres full-text search over tsvector columns, and an
+// in-process inverted index for the embedded SQLite mode.
+package search
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/config"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Kind is what a search looks for
+type Kind string
+
+const (
+	Posts    Kind = "posts"
+	Comments Kind = "comments"
+	Users    Kind = "users"
+)
+
+// Request is a search for one kind. Filters other than Text do not apply to
+// users.
+type Request struct {
+	Kind Kind
+	// Text is a query in the syntax described on Query
+	Text     string
+	AuthorID uuid.UUID // uuid.Nil for any author
+	From     time.Time // created at or after; zero for no bound
+	To       time.Time // created before; zero for no bound
+	Tag      string    // normalized hashtag, see NormalizeTag
+	Limit    int
+	Offset   int
+}
+
+// Hit is a matching row, best first. Highlights maps field names to a
+// snippet with the matched words wrapped in <mark> and everything else
+// HTML-escaped; fields without a match are absent.
+type Hit struct {
+	ID         uuid.UUID
+	Score      float64
+	Highlights map[string]string
+}
+
+// Searcher ranks the rows matching a request. Hits may include rows the
+// caller cannot see, so they are loaded through store.SearchStore, which
+// applies blocks, mutes and deletions.
+type Searcher interface {
+	Search(r Request) ([]Hit, error)
+}
+
+// New returns the engine selected by cfg.Engine on the given database
+func New(cfg config.SearchConfig, driver string, db *gorm.DB, docs store.SearchStore) (Searcher, error) {
+	engine := cfg.Engine
+	if engine == "auto" {
+		engine = "memory"
+		if driver == "postgres" {
+			engine = "postgres"
+		}
+	}
+
+	switch engine {
+	case "postgres":
+		return NewPostgres(db)
+	case "memory":
+		return NewLocal(docs)
+	default:
+		return nil, fmt.Errorf("unsupported search engine %q", engine)
+	}
+}
+
+// Engines mark matches with these control characters, which markup turns
+// into tags once the text around them is escaped
+const (
+	markOpen  = "\x02"
+	markClose = "\x03"
+)
+
+var marks = strings.NewReplacer(markOpen, "<mark>", markClose, "</mark>")
+
+// markup escapes a marked snippet for HTML. It reports false when nothing
+// in it was marked.
+func markup(snippet string) (string, bool) {
+	if !strings.Contains(snippet, markOpen) {
+		return "", false
+	}
+	return marks.Replace(html.EscapeString(snippet)), true
+}
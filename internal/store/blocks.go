@@ -0,0 +1,83 @@
+package store
+
+import (
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type blockStore struct {
+	db *gorm.DB
+}
+
+// Create blocks blockedID for blockerID and drops follows and timeline
+// entries in both directions. Blocking twice is not an error.
+func (s *blockStore) Create(blockerID, blockedID uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.Block{}).
+			Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			block := models.Block{ID: uuid.New(), BlockerID: blockerID, BlockedID: blockedID, CreatedAt: time.Now()}
+			if err := tx.Create(&block).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := unfollow(tx, blockerID, blockedID); err != nil {
+			return err
+		}
+		if err := unfollow(tx, blockedID, blockerID); err != nil {
+			return err
+		}
+
+		return tx.Where("(user_id = ? AND author_id = ?) OR (user_id = ? AND author_id = ?)",
+			blockerID, blockedID, blockedID, blockerID).
+			Delete(&models.TimelineEntry{}).Error
+	})
+}
+
+func (s *blockStore) Delete(blockerID, blockedID uuid.UUID) error {
+	return s.db.Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).Delete(&models.Block{}).Error
+}
+
+func (s *blockStore) Blocked(blockerID uuid.UUID) ([]models.User, error) {
+	var users []models.User
+	err := s.db.Model(&models.User{}).
+		Joins("JOIN blocks b ON b.blocked_id = users.id").
+		Where("b.blocker_id = ?", blockerID).
+		Order("b.created_at DESC").
+		Find(&users).Error
+	return users, err
+}
+
+func (s *blockStore) Between(a, b uuid.UUID) (bool, error) {
+	var count int64
+	err := s.db.Model(&models.Block{}).
+		Where("(blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)", a, b, b, a).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (s *blockStore) Blockers(blockedID uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := s.db.Model(&models.Block{}).Where("blocked_id = ?", blockedID).Pluck("blocker_id", &ids).Error
+	return ids, err
+}
+
+// visibleTo hides rows whose column holds a user that blocked viewerID or
+// that viewerID blocked. A nil viewer sees everything.
+func visibleTo(column string, viewerID uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if viewerID == uuid.Nil {
+			return db
+		}
+		return db.Where(column+" NOT IN (SELECT blocked_id FROM blocks WHERE blocker_id = ?)", viewerID).
+			Where(column+" NOT IN (SELECT blocker_id FROM blocks WHERE blocked_id = ?)", viewerID)
+	}
+}
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type commentStore struct {
+	db *gorm.DB
+}
+
+func (s *commentStore) Create(comment *models.Comment) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(comment).Error; err != nil {
+			return err
+		}
+		return bump(tx, &models.Post{}, comment.PostID, "comment_count", 1)
+	})
+}
+
+func (s *commentStore) GetByID(id uuid.UUID) (*models.Comment, error) {
+	var comment models.Comment
+	if err := s.db.First(&comment, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &comment, nil
+}
+
+func (s *commentStore) ListByPost(postID, viewerID uuid.UUID) ([]models.Comment, error) {
+	var comments []models.Comment
+	err := s.db.Unscoped().Where("post_id = ?", postID).Scopes(visibleTo("user_id", viewerID), unmuted(viewerID, "comments.user_id", "comments.content")).Order("created_at asc, id asc").Find(&comments).Error
+	return comments, err
+}
+
+func (s *commentStore) Save(comment *models.Comment) error {
+	return s.db.Save(comment).Error
+}
+
+func (s *commentStore) Edit(id, editorID uuid.UUID, content string) (*models.Comment, error) {
+	var comment models.Comment
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&comment, "id = ?", id).Error; err != nil {
+			return notFound(err)
+		}
+		if content == comment.Content {
+			return nil
+		}
+
+		var latest int
+		if err := tx.Model(&models.CommentRevision{}).Where("comment_id = ?", id).
+			Select("COALESCE(MAX(number), 0)").Scan(&latest).Error; err != nil {
+			return err
+		}
+		if latest == 0 {
+			// First edit: keep the original as revision 1
+			latest = 1
+			original := models.CommentRevision{
+				ID: uuid.New(), CommentID: id, Number: latest, EditorID: comment.UserID,
+				Content: comment.Content, CreatedAt: comment.CreatedAt,
+			}
+			if err := tx.Create(&original).Error; err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		comment.Content = content
+		comment.EditedAt = &now
+		comment.UpdatedAt = now
+		if err := tx.Model(&models.Comment{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"content": content, "edited_at": now, "updated_at": now,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.CommentRevision{
+			ID: uuid.New(), CommentID: id, Number: latest + 1, EditorID: editorID,
+			Content: content, CreatedAt: now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+func (s *commentStore) Revisions(commentID uuid.UUID) ([]models.CommentRevision, error) {
+	var revisions []models.CommentRevision
+	err := s.db.Where("comment_id = ?", commentID).Order("number ASC").Find(&revisions).Error
+	return revisions, err
+}
+
+func (s *commentStore) Delete(id, deletedBy uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var comment models.Comment
+		if err := tx.First(&comment, "id = ?", id).Error; err != nil {
+			return notFound(err)
+		}
+		if deleted, err := softDelete(tx, &models.Comment{}, id, deletedBy); err != nil || !deleted {
+			return err
+		}
+		return bump(tx, &models.Post{}, comment.PostID, "comment_count", -1)
+	})
+}
+
+func (s *commentStore) GetDeleted(id uuid.UUID) (*models.Comment, error) {
+	var comment models.Comment
+	if err := s.db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(&comment).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &comment, nil
+}
+
+func (s *commentStore) Restore(id uuid.UUID, cutoff time.Time) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var comment models.Comment
+		if err := tx.Unscoped().First(&comment, "id = ?", id).Error; err != nil {
+			return notFound(err)
+		}
+		if err := restore(tx, &models.Comment{}, id, cutoff); err != nil {
+			return err
+		}
+		return bump(tx, &models.Post{}, comment.PostID, "comment_count", 1)
+	})
+}
+
+// Purge leaves comments that still have replies; their tombstones hold the
+// thread together and go once the last reply is purged
+func (s *commentStore) Purge(cutoff time.Time) (int64, error) {
+	var ids []uuid.UUID
+	err := s.db.Unscoped().Model(&models.Comment{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Where("NOT EXISTS (SELECT 1 FROM comments r WHERE r.parent_id = comments.id)").
+		Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(ids)), purgeInBatches(s.db, ids, purgeComments)
+}
@@ -0,0 +1,430 @@
+package store
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type conversationStore struct {
+	db *gorm.DB
+}
+
+func (s *conversationStore) Create(conv *models.Conversation, memberIDs []uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(conv).Error; err != nil {
+			return err
+		}
+		members := make([]models.ConversationMember, len(memberIDs))
+		for i, id := range memberIDs {
+			members[i] = models.ConversationMember{ConversationID: conv.ID, UserID: id, Role: models.GroupMember, JoinedAt: conv.CreatedAt}
+			if conv.Type == models.ConversationGroup && id == conv.CreatedBy {
+				members[i].Role = models.GroupOwner
+			}
+		}
+		return tx.Create(&members).Error
+	})
+}
+
+func (s *conversationStore) Get(id uuid.UUID) (*models.Conversation, error) {
+	var conv models.Conversation
+	if err := s.db.First(&conv, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &conv, nil
+}
+
+func (s *conversationStore) Update(conv *models.Conversation) error {
+	conv.UpdatedAt = time.Now()
+	return s.db.Model(conv).Select("title", "avatar", "updated_at").Updates(conv).Error
+}
+
+func (s *conversationStore) Direct(a, b uuid.UUID) (*models.Conversation, error) {
+	var conv models.Conversation
+	if err := s.db.Where("direct_key = ?", models.DirectKey(a, b)).First(&conv).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &conv, nil
+}
+
+func (s *conversationStore) IsMember(conversationID, userID uuid.UUID) (bool, error) {
+	var count int64
+	err := s.db.Model(&models.ConversationMember{}).
+		Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (s *conversationStore) Member(conversationID, userID uuid.UUID) (*models.ConversationMember, error) {
+	var member models.ConversationMember
+	err := s.db.Where("conversation_id = ? AND user_id = ?", conversationID, userID).First(&member).Error
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &member, nil
+}
+
+func (s *conversationStore) MemberIDs(conversationID uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := s.db.Model(&models.ConversationMember{}).
+		Where("conversation_id = ?", conversationID).
+		Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+func (s *conversationStore) AddMembers(conversationID uuid.UUID, userIDs []uuid.UUID, at time.Time) ([]uuid.UUID, error) {
+	var added []uuid.UUID
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var existing []uuid.UUID
+		err := tx.Model(&models.ConversationMember{}).
+			Where("conversation_id = ? AND user_id IN ?", conversationID, userIDs).
+			Pluck("user_id", &existing).Error
+		if err != nil {
+			return err
+		}
+		for _, id := range userIDs {
+			if slices.Contains(existing, id) || slices.Contains(added, id) {
+				continue
+			}
+			member := models.ConversationMember{ConversationID: conversationID, UserID: id, Role: models.GroupMember, JoinedAt: at}
+			if err := tx.Create(&member).Error; err != nil {
+				return err
+			}
+			added = append(added, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+func (s *conversationStore) RemoveMember(conversationID, userID uuid.UUID) (*models.ConversationMember, error) {
+	var newOwner *models.ConversationMember
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var member models.ConversationMember
+		err := tx.Where("conversation_id = ? AND user_id = ?", conversationID, userID).First(&member).Error
+		if err != nil {
+			return notFound(err)
+		}
+		if err := tx.Delete(&member).Error; err != nil {
+			return err
+		}
+
+		var next models.ConversationMember
+		err = tx.Where("conversation_id = ?", conversationID).
+			Order("CASE WHEN role = '" + models.GroupAdmin + "' THEN 0 ELSE 1 END, joined_at, user_id").
+			First(&next).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Nobody is left to read the conversation
+			if err := tx.Where("conversation_id = ?", conversationID.String()).Delete(&models.Message{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("conversation_id = ?", conversationID).Delete(&models.ConversationInvite{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&models.Conversation{}, "id = ?", conversationID).Error
+		}
+		if err != nil {
+			return err
+		}
+		if member.Role != models.GroupOwner {
+			return nil
+		}
+		next.Role = models.GroupOwner
+		newOwner = &next
+		return tx.Model(&next).UpdateColumn("role", models.GroupOwner).Error
+	})
+	return newOwner, err
+}
+
+func (s *conversationStore) SetRole(conversationID, userID uuid.UUID, role string) error {
+	res := s.db.Model(&models.ConversationMember{}).
+		Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+		UpdateColumn("role", role)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *conversationStore) TransferOwnership(conversationID, from, to uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		txs := &conversationStore{db: tx}
+		if err := txs.SetRole(conversationID, from, models.GroupAdmin); err != nil {
+			return err
+		}
+		return txs.SetRole(conversationID, to, models.GroupOwner)
+	})
+}
+
+func (s *conversationStore) List(userID uuid.UUID, after *Cursor, limit int) ([]ConversationItem, error) {
+	query := s.db.Model(&models.Conversation{}).
+		Joins("JOIN conversation_members m ON m.conversation_id = conversations.id AND m.user_id = ?", userID)
+	if after != nil {
+		query = query.Where("(conversations.last_activity_at < ? OR (conversations.last_activity_at = ? AND conversations.id < ?))",
+			after.CreatedAt, after.CreatedAt, after.ID)
+	}
+	var convs []models.Conversation
+	err := query.Order("conversations.last_activity_at DESC, conversations.id DESC").Limit(limit).Find(&convs).Error
+	if err != nil {
+		return nil, err
+	}
+	return s.items(userID, convs)
+}
+
+func (s *conversationStore) Item(conversationID, userID uuid.UUID) (*ConversationItem, error) {
+	conv, err := s.Get(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.items(userID, []models.Conversation{*conv})
+	if err != nil {
+		return nil, err
+	}
+	return &items[0], nil
+}
+
+// items adds the members, last message and unread count for userID to
+// each conversation
+func (s *conversationStore) items(userID uuid.UUID, convs []models.Conversation) ([]ConversationItem, error) {
+	if len(convs) == 0 {
+		return nil, nil
+	}
+	ids := make([]uuid.UUID, len(convs))
+	keys := make([]string, len(convs))
+	for i, c := range convs {
+		ids[i] = c.ID
+		keys[i] = c.ID.String()
+	}
+
+	// Members, leaving out deleted accounts
+	var members []struct {
+		ConversationID uuid.UUID
+		ConversationMemberItem
+	}
+	err := s.db.Table("conversation_members").
+		Select("conversation_members.conversation_id, conversation_members.role AS group_role, users.id, users.username, users.avatar").
+		Joins("JOIN users ON users.id = conversation_members.user_id AND users.deleted_at IS NULL").
+		Where("conversation_members.conversation_id IN ?", ids).
+		Order("conversation_members.joined_at, users.username").
+		Scan(&members).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// The latest message of each
+	var last []models.Message
+	ranked := s.db.Table("messages").
+		Select("messages.*, ROW_NUMBER() OVER (PARTITION BY conversation_id ORDER BY created_at DESC, id DESC) AS n").
+		Where("conversation_id IN ?", keys)
+	if err := s.db.Table("(?) AS ranked", ranked).Where("n = 1").Scan(&last).Error; err != nil {
+		return nil, err
+	}
+
+	// Messages from others since the user last read, or joined
+	var unread []struct {
+		ConversationID string
+		Count          int64
+	}
+	err = s.db.Table("messages").
+		Select("messages.conversation_id, COUNT(*) AS count").
+		Joins("JOIN conversation_members m ON CAST(m.conversation_id AS TEXT) = messages.conversation_id AND m.user_id = ?", userID).
+		Where("messages.conversation_id IN ?", keys).
+		Where("messages.sender_id <> ?", userID.String()).
+		Where("messages.created_at > COALESCE(m.last_read_at, m.joined_at)").
+		Group("messages.conversation_id").
+		Scan(&unread).Error
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]ConversationItem, len(convs))
+	byID := make(map[uuid.UUID]*ConversationItem, len(convs))
+	for i, c := range convs {
+		items[i].Conversation = c
+		byID[c.ID] = &items[i]
+	}
+	for _, m := range members {
+		byID[m.ConversationID].Members = append(byID[m.ConversationID].Members, m.ConversationMemberItem)
+	}
+	for i := range last {
+		if id, err := uuid.Parse(last[i].ConversationID); err == nil && byID[id] != nil {
+			byID[id].LastMessage = &last[i]
+		}
+	}
+	for _, u := range unread {
+		if id, err := uuid.Parse(u.ConversationID); err == nil && byID[id] != nil {
+			byID[id].Unread = u.Count
+		}
+	}
+	return items, nil
+}
+
+func (s *conversationStore) MarkRead(conversationID, userID uuid.UUID, at time.Time) error {
+	return s.db.Model(&models.ConversationMember{}).
+		Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+		UpdateColumn("last_read_at", at).Error
+}
+
+func (s *conversationStore) CreateInvite(invite *models.ConversationInvite) error {
+	return s.db.Create(invite).Error
+}
+
+func (s *conversationStore) Invite(hash string) (*models.ConversationInvite, error) {
+	var invite models.ConversationInvite
+	if err := s.db.Where("token_hash = ?", hash).First(&invite).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &invite, nil
+}
+
+func (s *conversationStore) Invites(conversationID uuid.UUID, now time.Time) ([]models.ConversationInvite, error) {
+	var invites []models.ConversationInvite
+	err := s.db.Where("conversation_id = ? AND revoked_at IS NULL AND expires_at > ?", conversationID, now).
+		Order("created_at DESC").
+		Find(&invites).Error
+	return invites, err
+}
+
+func (s *conversationStore) RevokeInvite(conversationID, inviteID uuid.UUID, at time.Time) error {
+	res := s.db.Model(&models.ConversationInvite{}).
+		Where("id = ? AND conversation_id = ? AND revoked_at IS NULL", inviteID, conversationID).
+		UpdateColumn("revoked_at", at)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// adoptLegacyConversations gives each conversation ID that messages used
+// before conversations were stored a conversation of its own, with the
+// senders as members and their history counted as read. IDs that are UUIDs
+// are kept, so clients holding them still reach their messages.
+func adoptLegacyConversations(db *gorm.DB) error {
+	var legacy []string
+	err := db.Model(&models.Message{}).
+		Where("conversation_id NOT IN (SELECT CAST(id AS TEXT) FROM conversations)").
+		Distinct().
+		Pluck("conversation_id", &legacy).Error
+	if err != nil {
+		return err
+	}
+
+	for _, key := range legacy {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var senders []string
+			if err := tx.Model(&models.Message{}).Where("conversation_id = ?", key).Distinct().Pluck("sender_id", &senders).Error; err != nil {
+				return err
+			}
+			var members []uuid.UUID
+			for _, sender := range senders {
+				if id, err := uuid.Parse(sender); err == nil {
+					members = append(members, id)
+				}
+			}
+			var first, last models.Message
+			if err := tx.Where("conversation_id = ?", key).Order("created_at").First(&first).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("conversation_id = ?", key).Order("created_at DESC").First(&last).Error; err != nil {
+				return err
+			}
+
+			conv := models.Conversation{
+				Type:           models.ConversationGroup,
+				LastActivityAt: last.CreatedAt,
+				CreatedAt:      first.CreatedAt,
+				UpdatedAt:      last.CreatedAt,
+			}
+			if id, err := uuid.Parse(key); err == nil && id.String() == key {
+				conv.ID = id
+			} else {
+				conv.ID = uuid.New()
+			}
+			if len(members) > 0 {
+				conv.CreatedBy = members[0]
+			}
+			if len(members) == 2 {
+				// A pair that already has a direct conversation gets these
+				// messages merged into it
+				var existing models.Conversation
+				err := tx.Where("direct_key = ?", models.DirectKey(members[0], members[1])).First(&existing).Error
+				if err == nil {
+					return tx.Model(&models.Message{}).Where("conversation_id = ?", key).
+						UpdateColumn("conversation_id", existing.ID.String()).Error
+				}
+				if !errors.Is(err, gorm.ErrRecordNotFound) {
+					return err
+				}
+				directKey := models.DirectKey(members[0], members[1])
+				conv.Type = models.ConversationDirect
+				conv.DirectKey = &directKey
+			}
+
+			if err := tx.Create(&conv).Error; err != nil {
+				return err
+			}
+			for _, id := range members {
+				member := models.ConversationMember{ConversationID: conv.ID, UserID: id, Role: models.GroupMember, LastReadAt: &last.CreatedAt, JoinedAt: first.CreatedAt}
+				if conv.Type == models.ConversationGroup && id == conv.CreatedBy {
+					member.Role = models.GroupOwner
+				}
+				if err := tx.Create(&member).Error; err != nil {
+					return err
+				}
+			}
+			if conv.ID.String() == key {
+				return nil
+			}
+			return tx.Model(&models.Message{}).Where("conversation_id = ?", key).
+				UpdateColumn("conversation_id", conv.ID.String()).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assignGroupOwners makes the creator the owner of each group stored before
+// groups had roles, or the longest-standing member if the creator is gone
+func assignGroupOwners(db *gorm.DB) error {
+	var groups []models.Conversation
+	err := db.Where("type = ?", models.ConversationGroup).
+		Where("NOT EXISTS (SELECT 1 FROM conversation_members m WHERE m.conversation_id = conversations.id AND m.role = ?)", models.GroupOwner).
+		Find(&groups).Error
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		var members []models.ConversationMember
+		if err := db.Where("conversation_id = ?", g.ID).Order("joined_at, user_id").Find(&members).Error; err != nil {
+			return err
+		}
+		if len(members) == 0 {
+			continue
+		}
+		owner := members[0]
+		for _, m := range members {
+			if m.UserID == g.CreatedBy {
+				owner = m
+			}
+		}
+		if err := db.Model(&owner).UpdateColumn("role", models.GroupOwner).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
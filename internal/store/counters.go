@@ -0,0 +1,91 @@
+package store
+
+import (
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Counters on posts and users are kept up to date in the same transaction as
+// the rows they count. Paths that remove rows in bulk, like purges, recount
+// the affected rows instead, and a periodic repair recounts everything.
+
+// bump adds delta to a counter column without touching updated_at
+func bump(tx *gorm.DB, model interface{}, id uuid.UUID, column string, delta int) error {
+	if delta == 0 {
+		return nil
+	}
+	return tx.Unscoped().Model(model).Where("id = ?", id).
+		UpdateColumn(column, gorm.Expr(column+" + ?", delta)).Error
+}
+
+// bumpVote moves a post's counters from an old vote value to a new one; 0
+// stands for no vote
+func bumpVote(tx *gorm.DB, postID uuid.UUID, old, new int8) error {
+	oldUp, oldDown := voteSplit(old)
+	newUp, newDown := voteSplit(new)
+
+	if err := bump(tx, &models.Post{}, postID, "score", int(new)-int(old)); err != nil {
+		return err
+	}
+	if err := bump(tx, &models.Post{}, postID, "upvotes", newUp-oldUp); err != nil {
+		return err
+	}
+	return bump(tx, &models.Post{}, postID, "downvotes", newDown-oldDown)
+}
+
+// voteSplit counts a vote value as an upvote or a downvote
+func voteSplit(value int8) (up, down int) {
+	switch {
+	case value > 0:
+		return 1, 0
+	case value < 0:
+		return 0, 1
+	}
+	return 0, 0
+}
+
+// bumpFollow counts a follow being created (+1) or removed (-1)
+func bumpFollow(tx *gorm.DB, followerID, followeeID uuid.UUID, delta int) error {
+	if err := bump(tx, &models.User{}, followeeID, "follower_count", delta); err != nil {
+		return err
+	}
+	return bump(tx, &models.User{}, followerID, "following_count", delta)
+}
+
+var postCounters = map[string]interface{}{
+	"score":         gorm.Expr("COALESCE((SELECT SUM(v.value) FROM votes v WHERE v.post_id = posts.id), 0)"),
+	"upvotes":       gorm.Expr("(SELECT COUNT(*) FROM votes v WHERE v.post_id = posts.id AND v.value > 0)"),
+	"downvotes":     gorm.Expr("(SELECT COUNT(*) FROM votes v WHERE v.post_id = posts.id AND v.value < 0)"),
+	"comment_count": gorm.Expr("(SELECT COUNT(*) FROM comments c WHERE c.post_id = posts.id AND c.deleted_at IS NULL)"),
+}
+
+var userCounters = map[string]interface{}{
+	"follower_count":  gorm.Expr("(SELECT COUNT(*) FROM follows f WHERE f.followee_id = users.id)"),
+	"following_count": gorm.Expr("(SELECT COUNT(*) FROM follows f WHERE f.follower_id = users.id)"),
+	"post_count":      gorm.Expr("(SELECT COUNT(*) FROM posts p WHERE p.user_id = users.id AND p.deleted_at IS NULL)"),
+}
+
+// recountPosts recomputes the counters of the given posts
+func recountPosts(tx *gorm.DB, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return tx.Unscoped().Model(&models.Post{}).Where("id IN ?", ids).UpdateColumns(postCounters).Error
+}
+
+// recountUsers recomputes follower, following and post counts of the given
+// users
+func recountUsers(tx *gorm.DB, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return tx.Unscoped().Model(&models.User{}).Where("id IN ?", ids).UpdateColumns(userCounters).Error
+}
+
+// recountAll recomputes the counters of every row of model, reporting how
+// many rows were updated
+func recountAll(db *gorm.DB, model interface{}, counters map[string]interface{}) (int64, error) {
+	res := db.Unscoped().Model(model).Where("1 = 1").UpdateColumns(counters)
+	return res.RowsAffected, res.Error
+}
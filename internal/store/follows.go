@@ -0,0 +1,63 @@
+package store
+
+import (
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type followStore struct {
+	db *gorm.DB
+}
+
+func (s *followStore) Exists(followerID, followeeID uuid.UUID) (bool, error) {
+	var count int64
+	err := s.db.Model(&models.Follow{}).
+		Where("follower_id = ? AND followee_id = ?", followerID, followeeID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (s *followStore) Create(follow *models.Follow) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(follow).Error; err != nil {
+			return err
+		}
+		return bumpFollow(tx, follow.FollowerID, follow.FolloweeID, 1)
+	})
+}
+
+func (s *followStore) Delete(followerID, followeeID uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return unfollow(tx, followerID, followeeID)
+	})
+}
+
+// unfollow removes a follow and updates both users' counters
+func unfollow(tx *gorm.DB, followerID, followeeID uuid.UUID) error {
+	res := tx.Where("follower_id = ? AND followee_id = ?", followerID, followeeID).Delete(&models.Follow{})
+	if res.Error != nil {
+		return res.Error
+	}
+	return bumpFollow(tx, followerID, followeeID, -int(res.RowsAffected))
+}
+
+func (s *followStore) Followers(userID, viewerID uuid.UUID) ([]models.User, error) {
+	var followers []models.User
+	err := s.db.Model(&models.User{}).
+		Joins("JOIN follows f ON f.follower_id = users.id").
+		Where("f.followee_id = ?", userID).
+		Scopes(visibleTo("users.id", viewerID)).
+		Find(&followers).Error
+	return followers, err
+}
+
+func (s *followStore) Following(userID, viewerID uuid.UUID) ([]models.User, error) {
+	var following []models.User
+	err := s.db.Model(&models.User{}).
+		Joins("JOIN follows f ON f.followee_id = users.id").
+		Where("f.follower_id = ?", userID).
+		Scopes(visibleTo("users.id", viewerID)).
+		Find(&following).Error
+	return following, err
+}
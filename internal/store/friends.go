@@ -0,0 +1,148 @@
+package store
+
+import (
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type friendStore struct {
+	db *gorm.DB
+}
+
+func (s *friendStore) CreateRequest(senderID, receiverID string) (*models.FriendRequest, error) {
+	req := &models.FriendRequest{
+		SenderID:   senderID,
+		ReceiverID: receiverID,
+		Status:     "pending",
+		CreatedAt:  time.Now(),
+	}
+	if err := s.db.Create(req).Error; err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func (s *friendStore) GetRequest(id int) (*models.FriendRequest, error) {
+	var req models.FriendRequest
+	if err := s.db.First(&req, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &req, nil
+}
+
+// Accept marks the request accepted, records the friendship and makes both
+// users follow each other, all in one transaction
+func (s *friendStore) Accept(req *models.FriendRequest) error {
+	senderID, err := uuid.Parse(req.SenderID)
+	if err != nil {
+		return err
+	}
+	receiverID, err := uuid.Parse(req.ReceiverID)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := answer(tx, req.ID, "accepted"); err != nil {
+			return err
+		}
+
+		friend := models.Friend{User1ID: req.SenderID, User2ID: req.ReceiverID, CreatedAt: time.Now()}
+		if err := tx.Create(&friend).Error; err != nil {
+			return err
+		}
+
+		// Auto-follow both directions
+		for _, pair := range [][2]uuid.UUID{{senderID, receiverID}, {receiverID, senderID}} {
+			var count int64
+			if err := tx.Model(&models.Follow{}).Where("follower_id = ? AND followee_id = ?", pair[0], pair[1]).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				continue
+			}
+			follow := models.Follow{ID: uuid.New(), FollowerID: pair[0], FolloweeID: pair[1], CreatedAt: time.Now()}
+			if err := tx.Create(&follow).Error; err != nil {
+				return err
+			}
+			if err := bumpFollow(tx, pair[0], pair[1], 1); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *friendStore) Reject(id int) error {
+	return answer(s.db, id, "rejected")
+}
+
+// answer moves a pending request to status, so a request is answered once
+// even when two answers race
+func answer(db *gorm.DB, id int, status string) error {
+	res := db.Model(&models.FriendRequest{}).Where("id = ? AND status = ?", id, "pending").Update("status", status)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotPending
+	}
+	return nil
+}
+
+func (s *friendStore) Pending(receiverID string) ([]PendingFriendRequest, error) {
+	var requests []PendingFriendRequest
+	err := s.db.Raw(`
+		SELECT fr.id, u.id as sender_id, u.username, u.avatar, fr.created_at
+		FROM friend_requests fr
+		JOIN users u ON u.id = fr.sender_id AND u.deleted_at IS NULL
+		WHERE fr.receiver_id = ? AND fr.status = 'pending'
+	`, receiverID).Scan(&requests).Error
+	return requests, err
+}
+
+func (s *friendStore) Mutuals(userID string) ([]models.User, error) {
+	var users []models.User
+	err := s.db.Raw(`
+		SELECT u.id, u.username, u.avatar
+		FROM follows f1
+		JOIN follows f2 ON f1.follower_id = f2.followee_id AND f1.followee_id = f2.follower_id
+		JOIN users u ON u.id = f1.followee_id AND u.deleted_at IS NULL
+		WHERE f1.follower_id = ?
+	`, userID).Scan(&users).Error
+	return users, err
+}
+
+func (s *friendStore) MutualsOf(userIDs []uuid.UUID) (map[uuid.UUID][]models.User, error) {
+	mutuals := make(map[uuid.UUID][]models.User, len(userIDs))
+	if len(userIDs) == 0 {
+		return mutuals, nil
+	}
+
+	var rows []struct {
+		OwnerID  uuid.UUID
+		ID       uuid.UUID
+		Username string
+		Avatar   string
+	}
+	err := s.db.Raw(`
+		SELECT f1.follower_id AS owner_id, u.id, u.username, u.avatar
+		FROM follows f1
+		JOIN follows f2 ON f1.follower_id = f2.followee_id AND f1.followee_id = f2.follower_id
+		JOIN users u ON u.id = f1.followee_id AND u.deleted_at IS NULL
+		WHERE f1.follower_id IN ?
+	`, userIDs).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		mutuals[row.OwnerID] = append(mutuals[row.OwnerID], models.User{
+			ID: row.ID, Username: row.Username, Avatar: row.Avatar,
+		})
+	}
+	return mutuals, nil
+}
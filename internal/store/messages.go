@@ -0,0 +1,60 @@
+package store
+
+import (
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type messageStore struct {
+	db *gorm.DB
+}
+
+func (s *messageStore) Create(msg *models.Message) error {
+	if msg.ID == uuid.Nil {
+		msg.ID = uuid.New()
+	}
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now()
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(msg).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Conversation{}).
+			Where("id = ?", msg.ConversationID).
+			UpdateColumn("last_activity_at", msg.CreatedAt).Error
+	})
+}
+
+func (s *messageStore) GetByID(id uuid.UUID) (*models.Message, error) {
+	var msg models.Message
+	if err := s.db.First(&msg, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &msg, nil
+}
+
+func (s *messageStore) ListByConversation(conversationID string) ([]models.Message, error) {
+	var messages []models.Message
+	err := s.db.Where("conversation_id = ?", conversationID).Order("created_at ASC").Find(&messages).Error
+	return messages, err
+}
+
+func (s *messageStore) MarkSaved(id uuid.UUID) error {
+	res := s.db.Model(&models.Message{}).Where("id = ?", id).Update("is_saved", true)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *messageStore) DeleteUnsavedBefore(cutoff time.Time) (int64, error) {
+	res := s.db.Where("is_saved = ? AND created_at < ?", false, cutoff).Delete(&models.Message{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type muteStore struct {
+	db *gorm.DB
+}
+
+// Create stores a mute, or refreshes the expiry of an identical one
+func (s *muteStore) Create(mute *models.Mute) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("user_id = ? AND kind = ?", mute.UserID, mute.Kind)
+		if mute.TargetID != nil {
+			query = query.Where("target_id = ?", *mute.TargetID)
+		} else {
+			query = query.Where("word = ?", mute.Word)
+		}
+
+		var existing models.Mute
+		err := query.First(&existing).Error
+		if err == nil {
+			if err := tx.Model(&existing).Update("expires_at", mute.ExpiresAt).Error; err != nil {
+				return err
+			}
+			mute.ID = existing.ID
+			mute.CreatedAt = existing.CreatedAt
+			return nil
+		}
+		if notFound(err) != ErrNotFound {
+			return err
+		}
+
+		if mute.ID == uuid.Nil {
+			mute.ID = uuid.New()
+		}
+		return tx.Create(mute).Error
+	})
+}
+
+func (s *muteStore) Delete(userID, id uuid.UUID) error {
+	res := s.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.Mute{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *muteStore) Active(userID uuid.UUID) ([]models.Mute, error) {
+	var mutes []models.Mute
+	err := s.db.Where("user_id = ? AND (expires_at IS NULL OR expires_at > ?)", userID, time.Now()).
+		Order("created_at DESC").
+		Find(&mutes).Error
+	return mutes, err
+}
+
+func (s *muteStore) DeleteExpired(cutoff time.Time) (int64, error) {
+	res := s.db.Where("expires_at IS NOT NULL AND expires_at < ?", cutoff).Delete(&models.Mute{})
+	return res.RowsAffected, res.Error
+}
+
+// unmuted hides rows authored by accounts viewerID muted, or whose text
+// columns contain one of their muted words or hashtags. Matching is by
+// whole word and case-insensitive, as in models.Mute.Matches. A nil viewer
+// sees everything.
+func unmuted(viewerID uuid.UUID, userColumn string, textColumns ...string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if viewerID == uuid.Nil {
+			return db
+		}
+		now := time.Now()
+
+		db = db.Where(userColumn+` NOT IN (SELECT target_id FROM mutes
+			WHERE user_id = ? AND kind = ? AND target_id IS NOT NULL
+			AND (expires_at IS NULL OR expires_at > ?))`,
+			viewerID, models.MuteAccount, now)
+
+		// The muted word with LIKE wildcards escaped, between spaces, against
+		// the column as mute_text (see the db package) normalizes it
+		for _, column := range textColumns {
+			db = db.Where(`NOT EXISTS (SELECT 1 FROM mutes m
+				WHERE m.user_id = ? AND m.kind IN ? AND m.word <> ''
+				AND (m.expires_at IS NULL OR m.expires_at > ?)
+				AND mute_text(`+column+`, m.kind) LIKE
+					'% ' || REPLACE(REPLACE(REPLACE(m.word, '\', '\\'), '%', '\%'), '_', '\_') || ' %' ESCAPE '\')`,
+				viewerID, []string{models.MuteKeyword, models.MuteHashtag}, now)
+		}
+		return db
+	}
+}
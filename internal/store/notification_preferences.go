@@ -0,0 +1,107 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (s *notificationStore) Preferences(userID uuid.UUID) ([]models.NotificationPreference, error) {
+	var saved []models.NotificationPreference
+	if err := s.db.Where("user_id = ?", userID).Find(&saved).Error; err != nil {
+		return nil, err
+	}
+	byType := make(map[string]models.NotificationPreference, len(saved))
+	for _, p := range saved {
+		byType[p.Type] = p
+	}
+
+	prefs := make([]models.NotificationPreference, 0, len(models.NotificationTypes))
+	for _, kind := range models.NotificationTypes {
+		p, ok := byType[kind]
+		if !ok {
+			p = models.DefaultNotificationPreference(userID, kind)
+		}
+		prefs = append(prefs, p)
+	}
+	return prefs, nil
+}
+
+func (s *notificationStore) Preference(userID uuid.UUID, kind string) (models.NotificationPreference, error) {
+	var p models.NotificationPreference
+	err := s.db.Where("user_id = ? AND type = ?", userID, kind).First(&p).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.DefaultNotificationPreference(userID, kind), nil
+	}
+	return p, err
+}
+
+func (s *notificationStore) SavePreferences(prefs []models.NotificationPreference) error {
+	if len(prefs) == 0 {
+		return nil
+	}
+	now := time.Now()
+	for i := range prefs {
+		prefs[i].UpdatedAt = now
+	}
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "type"}},
+		DoUpdates: clause.AssignmentColumns([]string{"in_app", "email", "push", "updated_at"}),
+	}).Create(&prefs).Error
+}
+
+func (s *notificationStore) Settings(userID uuid.UUID) (models.NotificationSettings, error) {
+	var settings models.NotificationSettings
+	err := s.db.Where("user_id = ?", userID).First(&settings).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.NotificationSettings{UserID: userID, Timezone: "UTC"}, nil
+	}
+	return settings, err
+}
+
+func (s *notificationStore) SaveSettings(settings *models.NotificationSettings) error {
+	settings.UpdatedAt = time.Now()
+	return s.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(settings).Error
+}
+
+// pendingEmail scopes notifications to those waiting to be emailed. Types
+// without a preference row get the default, a daily digest.
+func pendingEmail(db *gorm.DB) *gorm.DB {
+	return db.Joins("LEFT JOIN notification_preferences p ON p.user_id = notifications.user_id AND p.type = notifications.type").
+		Where("notifications.is_read = ?", false).
+		Where("(notifications.emailed_at IS NULL OR notifications.emailed_at < notifications.updated_at)").
+		Where("COALESCE(p.email, ?) <> ?", models.DeliveryDaily, models.DeliveryOff)
+}
+
+func (s *notificationStore) EmailRecipients() ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := s.db.Model(&models.Notification{}).
+		Scopes(pendingEmail).
+		Distinct().
+		Pluck("notifications.user_id", &ids).Error
+	return ids, err
+}
+
+func (s *notificationStore) PendingEmail(userID uuid.UUID, limit int) ([]PendingEmail, error) {
+	var pending []PendingEmail
+	err := s.db.Table("notifications").
+		Select("notifications.*, COALESCE(p.email, ?) AS delivery", models.DeliveryDaily).
+		Scopes(pendingEmail, s.withVisibleActor(userID)).
+		Where("notifications.user_id = ?", userID).
+		Order("notifications.updated_at DESC, notifications.id DESC").
+		Limit(limit).
+		Scan(&pending).Error
+	return pending, err
+}
+
+func (s *notificationStore) MarkEmailed(ids []uuid.UUID, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	// UpdateColumn leaves updated_at alone, which tracks the latest event
+	return s.db.Model(&models.Notification{}).Where("id IN ?", ids).UpdateColumn("emailed_at", at).Error
+}
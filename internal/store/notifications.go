@@ -0,0 +1,153 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type notificationStore struct {
+	db *gorm.DB
+}
+
+func (s *notificationStore) Notify(n *models.Notification) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		var group models.Notification
+		err := tx.Where("user_id = ? AND type = ? AND entity_type = ? AND entity_id = ? AND is_read = ?",
+			n.UserID, n.Type, n.EntityType, n.EntityID, false).
+			Order("updated_at DESC").
+			First(&group).Error
+		if err == nil {
+			res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.NotificationActor{
+				NotificationID: group.ID, ActorID: n.ActorID, CreatedAt: now,
+			})
+			if res.Error != nil {
+				return res.Error
+			}
+			fields := map[string]interface{}{"actor_id": n.ActorID, "updated_at": now}
+			if res.RowsAffected > 0 {
+				fields["actor_count"] = gorm.Expr("actor_count + 1")
+			}
+			if err := tx.Model(&group).Updates(fields).Error; err != nil {
+				return err
+			}
+			return tx.First(n, "id = ?", group.ID).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		n.ID = uuid.New()
+		n.ActorCount = 1
+		n.IsRead = false
+		n.CreatedAt, n.UpdatedAt = now, now
+		if err := tx.Create(n).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.NotificationActor{NotificationID: n.ID, ActorID: n.ActorID, CreatedAt: now}).Error
+	})
+}
+
+// withVisibleActor hides notifications whose every actor is blocked, muted
+// or deleted as far as userID is concerned
+func (s *notificationStore) withVisibleActor(userID uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		actors := s.db.Table("notification_actors na").
+			Select("1").
+			Joins("JOIN users ON users.id = na.actor_id AND users.deleted_at IS NULL").
+			Where("na.notification_id = notifications.id").
+			Scopes(visibleTo("na.actor_id", userID), unmuted(userID, "na.actor_id"))
+		return db.Where("EXISTS (?)", actors)
+	}
+}
+
+// shownInApp leaves out the types userID turned off in the app
+func shownInApp(userID uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("notifications.type NOT IN (SELECT type FROM notification_preferences WHERE user_id = ? AND in_app = ?)",
+			userID, models.DeliveryOff)
+	}
+}
+
+func (s *notificationStore) Page(userID uuid.UUID, after *Cursor, limit int, unreadOnly bool) ([]models.Notification, error) {
+	query := s.db.Where("user_id = ?", userID).Scopes(s.withVisibleActor(userID), shownInApp(userID))
+	if unreadOnly {
+		query = query.Where("is_read = ?", false)
+	}
+	if after != nil {
+		query = query.Where("(updated_at < ? OR (updated_at = ? AND id < ?))",
+			after.CreatedAt, after.CreatedAt, after.ID)
+	}
+
+	var notifications []models.Notification
+	err := query.Order("updated_at DESC, id DESC").Limit(limit).Find(&notifications).Error
+	return notifications, err
+}
+
+func (s *notificationStore) Actors(userID uuid.UUID, ids []uuid.UUID, limit int) (map[uuid.UUID]NotificationActors, error) {
+	actors := make(map[uuid.UUID]NotificationActors, len(ids))
+	if len(ids) == 0 {
+		return actors, nil
+	}
+
+	ranked := s.db.Table("notification_actors na").
+		Select(`na.notification_id, users.id, users.username, users.avatar,
+			ROW_NUMBER() OVER (PARTITION BY na.notification_id ORDER BY na.created_at DESC, na.actor_id) AS n,
+			COUNT(*) OVER (PARTITION BY na.notification_id) AS total`).
+		Joins("JOIN users ON users.id = na.actor_id AND users.deleted_at IS NULL").
+		Where("na.notification_id IN ?", ids).
+		Scopes(visibleTo("na.actor_id", userID), unmuted(userID, "na.actor_id"))
+
+	var rows []struct {
+		NotificationID uuid.UUID
+		ID             uuid.UUID
+		Username       string
+		Avatar         string
+		Total          int
+	}
+	err := s.db.Table("(?) AS ranked", ranked).
+		Where("n <= ?", limit).
+		Order("notification_id, n").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		a := actors[row.NotificationID]
+		a.Count = row.Total
+		a.Recent = append(a.Recent, models.User{ID: row.ID, Username: row.Username, Avatar: row.Avatar})
+		actors[row.NotificationID] = a
+	}
+	return actors, nil
+}
+
+func (s *notificationStore) UnreadCount(userID uuid.UUID) (int64, error) {
+	var count int64
+	err := s.db.Model(&models.Notification{}).
+		Where("user_id = ? AND is_read = ?", userID, false).
+		Scopes(s.withVisibleActor(userID), shownInApp(userID)).
+		Count(&count).Error
+	return count, err
+}
+
+func (s *notificationStore) MarkRead(userID, id uuid.UUID) error {
+	var n models.Notification
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&n).Error; err != nil {
+		return notFound(err)
+	}
+	return s.db.Model(&n).UpdateColumn("is_read", true).Error
+}
+
+func (s *notificationStore) MarkAllRead(userID uuid.UUID) (int64, error) {
+	res := s.db.Model(&models.Notification{}).
+		Where("user_id = ? AND is_read = ?", userID, false).
+		UpdateColumn("is_read", true)
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"gorm.io/gorm"
+)
+
+type passwordResetStore struct {
+	db *gorm.DB
+}
+
+func (s *passwordResetStore) Create(token *models.PasswordResetToken) error {
+	return s.db.Create(token).Error
+}
+
+// Consume redeems an unused, unexpired token and invalidates every other
+// outstanding token of the same user. It returns ErrNotFound otherwise.
+func (s *passwordResetStore) Consume(hash string) (*models.PasswordResetToken, error) {
+	var token models.PasswordResetToken
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hash, now).
+			First(&token).Error; err != nil {
+			return notFound(err)
+		}
+
+		res := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", token.UserID).
+			Update("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			// Redeemed concurrently
+			return ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (s *passwordResetStore) DeleteExpired(cutoff time.Time) (int64, error) {
+	res := s.db.Where("expires_at < ? OR used_at < ?", cutoff, cutoff).Delete(&models.PasswordResetToken{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,160 @@
+package store
+
+import (
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type postStore struct {
+	db *gorm.DB
+}
+
+func (s *postStore) Create(post *models.Post) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(post).Error; err != nil {
+			return err
+		}
+		return bump(tx, &models.User{}, post.UserID, "post_count", 1)
+	})
+}
+
+func (s *postStore) GetByID(id uuid.UUID) (*models.Post, error) {
+	var post models.Post
+	err := s.db.Where("posts.user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)").
+		First(&post, "id = ?", id).Error
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &post, nil
+}
+
+func (s *postStore) List(filter PostFilter) ([]models.Post, error) {
+	query := s.db.Model(&models.Post{}).Scopes(
+		visibleTo("user_id", filter.ViewerID),
+		unmuted(filter.ViewerID, "posts.user_id", "posts.title", "posts.content"),
+	)
+	// Posts of deleted accounts stay hidden until the account is restored or purged
+	query = query.Where("posts.user_id NOT IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)")
+
+	var posts []models.Post
+	err := query.Order("created_at DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&posts).Error
+	return posts, err
+}
+
+// feedColumns selects a post with its author
+const feedColumns = `posts.*, users.username, users.avatar`
+
+func (s *postStore) Updates(id uuid.UUID, fields map[string]interface{}) error {
+	return s.db.Model(&models.Post{}).Where("id = ?", id).Updates(fields).Error
+}
+
+func (s *postStore) Edit(id, editorID uuid.UUID, title, content *string) (*models.Post, error) {
+	var post models.Post
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&post, "id = ?", id).Error; err != nil {
+			return notFound(err)
+		}
+
+		fields := map[string]interface{}{}
+		if title != nil && *title != post.Title {
+			fields["title"] = *title
+		}
+		if content != nil && *content != post.Content {
+			fields["content"] = *content
+		}
+		if len(fields) == 0 {
+			return nil
+		}
+
+		var latest int
+		if err := tx.Model(&models.PostRevision{}).Where("post_id = ?", id).
+			Select("COALESCE(MAX(number), 0)").Scan(&latest).Error; err != nil {
+			return err
+		}
+		if latest == 0 {
+			// First edit: keep the original as revision 1
+			latest = 1
+			original := models.PostRevision{
+				ID: uuid.New(), PostID: id, Number: latest, EditorID: post.UserID,
+				Title: post.Title, Content: post.Content, CreatedAt: post.CreatedAt,
+			}
+			if err := tx.Create(&original).Error; err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		fields["edited_at"] = now
+		fields["updated_at"] = now
+		if err := tx.Model(&models.Post{}).Where("id = ?", id).Updates(fields).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&post, "id = ?", id).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.PostRevision{
+			ID: uuid.New(), PostID: id, Number: latest + 1, EditorID: editorID,
+			Title: post.Title, Content: post.Content, CreatedAt: now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+func (s *postStore) Revisions(postID uuid.UUID) ([]models.PostRevision, error) {
+	var revisions []models.PostRevision
+	err := s.db.Where("post_id = ?", postID).Order("number ASC").Find(&revisions).Error
+	return revisions, err
+}
+
+func (s *postStore) Delete(id, deletedBy uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var post models.Post
+		if err := tx.First(&post, "id = ?", id).Error; err != nil {
+			return notFound(err)
+		}
+		if deleted, err := softDelete(tx, &models.Post{}, id, deletedBy); err != nil || !deleted {
+			return err
+		}
+		return bump(tx, &models.User{}, post.UserID, "post_count", -1)
+	})
+}
+
+func (s *postStore) GetDeleted(id uuid.UUID) (*models.Post, error) {
+	var post models.Post
+	if err := s.db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(&post).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &post, nil
+}
+
+func (s *postStore) Restore(id uuid.UUID, cutoff time.Time) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var post models.Post
+		if err := tx.Unscoped().First(&post, "id = ?", id).Error; err != nil {
+			return notFound(err)
+		}
+		if err := restore(tx, &models.Post{}, id, cutoff); err != nil {
+			return err
+		}
+		return bump(tx, &models.User{}, post.UserID, "post_count", 1)
+	})
+}
+
+func (s *postStore) RepairCounters() (int64, error) {
+	return recountAll(s.db, &models.Post{}, postCounters)
+}
+
+func (s *postStore) Purge(cutoff time.Time) (int64, error) {
+	ids, err := deletedBefore(s.db, &models.Post{}, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(ids)), purgeInBatches(s.db, ids, purgePosts)
+}
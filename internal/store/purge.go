@@ -0,0 +1,212 @@
+package store
+
+import (
+	"strings"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// purgeBatchSize bounds the IDs handled per purge transaction
+const purgeBatchSize = 200
+
+// deletedBefore returns IDs of rows of model soft-deleted before cutoff
+func deletedBefore(db *gorm.DB, model interface{}, cutoff time.Time) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := db.Unscoped().Model(model).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+// softDelete marks a row deleted and records who did it, which decides who
+// may restore it. It reports whether a live row was found.
+func softDelete(db *gorm.DB, model interface{}, id, deletedBy uuid.UUID) (bool, error) {
+	res := db.Model(model).Where("id = ?", id).Updates(map[string]interface{}{
+		"deleted_at": time.Now(),
+		"deleted_by": deletedBy,
+	})
+	return res.RowsAffected > 0, res.Error
+}
+
+// restore undoes softDelete for a row deleted after cutoff
+func restore(db *gorm.DB, model interface{}, id uuid.UUID, cutoff time.Time) error {
+	res := db.Unscoped().Model(model).
+		Where("id = ? AND deleted_at IS NOT NULL AND deleted_at >= ?", id, cutoff).
+		Updates(map[string]interface{}{"deleted_at": nil, "deleted_by": nil})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// purgeInBatches runs fn over ids in chunks, each chunk in its own transaction
+func purgeInBatches(db *gorm.DB, ids []uuid.UUID, fn func(tx *gorm.DB, batch []uuid.UUID) error) error {
+	for start := 0; start < len(ids); start += purgeBatchSize {
+		end := min(start+purgeBatchSize, len(ids))
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			return fn(tx, ids[start:end])
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purgeComments permanently removes comments with their revisions and votes
+func purgeComments(tx *gorm.DB, commentIDs []uuid.UUID) error {
+	if len(commentIDs) == 0 {
+		return nil
+	}
+	for _, model := range []interface{}{&models.CommentRevision{}, &models.CommentVote{}} {
+		if err := tx.Where("comment_id IN ?", commentIDs).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	if err := purgeNotifications(tx, models.EntityComment, commentIDs); err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("id IN ?", commentIDs).Delete(&models.Comment{}).Error
+}
+
+// purgePosts permanently removes posts with everything hanging off them
+func purgePosts(tx *gorm.DB, postIDs []uuid.UUID) error {
+	if len(postIDs) == 0 {
+		return nil
+	}
+
+	var commentIDs []uuid.UUID
+	if err := tx.Unscoped().Model(&models.Comment{}).Where("post_id IN ?", postIDs).Pluck("id", &commentIDs).Error; err != nil {
+		return err
+	}
+	if err := purgeComments(tx, commentIDs); err != nil {
+		return err
+	}
+
+	for _, model := range []interface{}{&models.Vote{}, &models.PostRevision{}, &models.TimelineEntry{}, &models.TrendingPost{}} {
+		if err := tx.Where("post_id IN ?", postIDs).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	if err := purgeNotifications(tx, models.EntityPost, postIDs); err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("id IN ?", postIDs).Delete(&models.Post{}).Error
+}
+
+// purgeNotifications removes notifications about purged entities
+func purgeNotifications(tx *gorm.DB, entityType string, ids []uuid.UUID) error {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = id.String()
+	}
+	about := tx.Model(&models.Notification{}).Select("id").Where("entity_type = ? AND entity_id IN ?", entityType, keys)
+	if err := tx.Where("notification_id IN (?)", about).Delete(&models.NotificationActor{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("entity_type = ? AND entity_id IN ?", entityType, keys).Delete(&models.Notification{}).Error
+}
+
+// purgeUsers permanently removes accounts and all data they own
+func purgeUsers(tx *gorm.DB, userIDs []uuid.UUID) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	// Other users' posts and accounts whose counters include these users
+	var touchedPosts, touchedUsers []uuid.UUID
+	if err := tx.Raw(`SELECT post_id FROM votes WHERE user_id IN ?
+		UNION SELECT post_id FROM comments WHERE user_id IN ? AND deleted_at IS NULL`,
+		userIDs, userIDs).Scan(&touchedPosts).Error; err != nil {
+		return err
+	}
+	if err := tx.Raw(`SELECT followee_id FROM follows WHERE follower_id IN ?
+		UNION SELECT follower_id FROM follows WHERE followee_id IN ?`,
+		userIDs, userIDs).Scan(&touchedUsers).Error; err != nil {
+		return err
+	}
+
+	var postIDs []uuid.UUID
+	if err := tx.Unscoped().Model(&models.Post{}).Where("user_id IN ?", userIDs).Pluck("id", &postIDs).Error; err != nil {
+		return err
+	}
+	if err := purgePosts(tx, postIDs); err != nil {
+		return err
+	}
+
+	// Comments others replied to are blanked into tombstones rather than
+	// removed, so the replies keep their place in the thread
+	hasReplies := "EXISTS (SELECT 1 FROM comments r WHERE r.parent_id = comments.id)"
+	if err := tx.Unscoped().Model(&models.Comment{}).
+		Where("user_id IN ? AND "+hasReplies, userIDs).
+		Updates(map[string]interface{}{"content": "", "deleted_at": gorm.Expr("COALESCE(deleted_at, ?)", time.Now())}).Error; err != nil {
+		return err
+	}
+	var commentIDs []uuid.UUID
+	if err := tx.Unscoped().Model(&models.Comment{}).
+		Where("user_id IN ? AND NOT "+hasReplies, userIDs).
+		Pluck("id", &commentIDs).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("comment_id IN (SELECT id FROM comments WHERE user_id IN ?)", userIDs).Delete(&models.CommentRevision{}).Error; err != nil {
+		return err
+	}
+	if err := purgeComments(tx, commentIDs); err != nil {
+		return err
+	}
+
+	// Friend requests, friendships and messages key users by string ID
+	userKeys := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		userKeys[i] = id.String()
+	}
+
+	deletes := []struct {
+		model interface{}
+		where string
+		arg   interface{}
+	}{
+		{&models.Vote{}, "user_id IN ?", userIDs},
+		{&models.CommentVote{}, "user_id IN ?", userIDs},
+		{&models.Follow{}, "follower_id IN ? OR followee_id IN ?", userIDs},
+		{&models.Block{}, "blocker_id IN ? OR blocked_id IN ?", userIDs},
+		{&models.Mute{}, "user_id IN ? OR target_id IN ?", userIDs},
+		{&models.TimelineEntry{}, "user_id IN ? OR author_id IN ?", userIDs},
+		{&models.RefreshToken{}, "user_id IN ?", userIDs},
+		{&models.Session{}, "user_id IN ?", userIDs},
+		{&models.PasswordResetToken{}, "user_id IN ?", userIDs},
+		{&models.EmailVerificationToken{}, "user_id IN ?", userIDs},
+		{&models.FriendRequest{}, "sender_id IN ? OR receiver_id IN ?", userKeys},
+		{&models.Friend{}, "user1_id IN ? OR user2_id IN ?", userKeys},
+		{&models.Message{}, "sender_id IN ?", userKeys},
+		{&models.ConversationMember{}, "user_id IN ?", userIDs},
+		{&models.ConversationInvite{}, "created_by IN ?", userIDs},
+		{&models.NotificationActor{}, "actor_id IN ? OR notification_id IN (SELECT id FROM notifications WHERE user_id IN ?)", userIDs},
+		{&models.Notification{}, "user_id IN ?", userIDs},
+		{&models.NotificationPreference{}, "user_id IN ?", userIDs},
+		{&models.NotificationSettings{}, "user_id IN ?", userIDs},
+	}
+	for _, d := range deletes {
+		// The same ID list fills every placeholder
+		args := make([]interface{}, strings.Count(d.where, "?"))
+		for i := range args {
+			args[i] = d.arg
+		}
+		if err := tx.Where(d.where, args...).Delete(d.model).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Unscoped().Where("id IN ?", userIDs).Delete(&models.User{}).Error; err != nil {
+		return err
+	}
+	if err := recountPosts(tx, touchedPosts); err != nil {
+		return err
+	}
+	return recountUsers(tx, touchedUsers)
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type searchStore struct {
+	db *gorm.DB
+}
+
+// docColumns selects the searchable text of a row as a SearchDoc
+const docColumns = `, created_at, updated_at, deleted_at IS NOT NULL AS deleted`
+
+func (s *searchStore) PostDocs(since time.Time) ([]SearchDoc, error) {
+	return s.docs(&models.Post{}, "id, user_id AS author_id, title, content AS body"+docColumns, since)
+}
+
+func (s *searchStore) CommentDocs(since time.Time) ([]SearchDoc, error) {
+	return s.docs(&models.Comment{}, "id, user_id AS author_id, '' AS title, content AS body"+docColumns, since)
+}
+
+func (s *searchStore) UserDocs(since time.Time) ([]SearchDoc, error) {
+	return s.docs(&models.User{}, "id, id AS author_id, username AS title, bio AS body"+docColumns, since)
+}
+
+func (s *searchStore) docs(model interface{}, columns string, since time.Time) ([]SearchDoc, error) {
+	var docs []SearchDoc
+	err := s.db.Unscoped().Model(model).
+		Select(columns).
+		Where("updated_at >= ?", since).
+		Order("updated_at ASC").
+		Scan(&docs).Error
+	return docs, err
+}
+
+func (s *searchStore) Posts(ids []uuid.UUID, viewerID uuid.UUID) ([]FeedItem, error) {
+	var items []FeedItem
+	if len(ids) == 0 {
+		return items, nil
+	}
+	err := s.db.Table("posts").
+		Select(feedColumns).
+		Joins("JOIN users ON users.id = posts.user_id AND users.deleted_at IS NULL").
+		Where("posts.id IN ? AND posts.deleted_at IS NULL", ids).
+		Scopes(
+			visibleTo("posts.user_id", viewerID),
+			unmuted(viewerID, "posts.user_id", "posts.title", "posts.content"),
+		).
+		Scan(&items).Error
+	return items, err
+}
+
+func (s *searchStore) Comments(ids []uuid.UUID, viewerID uuid.UUID) ([]CommentItem, error) {
+	var items []CommentItem
+	if len(ids) == 0 {
+		return items, nil
+	}
+	err := s.db.Table("comments").
+		Select("comments.*, users.username, users.avatar, posts.title AS post_title").
+		Joins("JOIN users ON users.id = comments.user_id AND users.deleted_at IS NULL").
+		Joins("JOIN posts ON posts.id = comments.post_id AND posts.deleted_at IS NULL").
+		Joins("JOIN users post_authors ON post_authors.id = posts.user_id AND post_authors.deleted_at IS NULL").
+		Where("comments.id IN ? AND comments.deleted_at IS NULL", ids).
+		Scopes(
+			visibleTo("comments.user_id", viewerID),
+			visibleTo("posts.user_id", viewerID),
+			unmuted(viewerID, "comments.user_id", "comments.content"),
+		).
+		Scan(&items).Error
+	return items, err
+}
+
+func (s *searchStore) Users(ids []uuid.UUID, viewerID uuid.UUID) ([]models.User, error) {
+	var users []models.User
+	if len(ids) == 0 {
+		return users, nil
+	}
+	err := s.db.Where("id IN ?", ids).
+		Scopes(visibleTo("id", viewerID)).
+		Find(&users).Error
+	return users, err
+}
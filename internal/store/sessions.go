@@ -0,0 +1,91 @@
+package store
+
+import (
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type sessionStore struct {
+	db *gorm.DB
+}
+
+func (s *sessionStore) Create(session *models.Session) error {
+	return s.db.Create(session).Error
+}
+
+func (s *sessionStore) GetByID(id uuid.UUID) (*models.Session, error) {
+	var session models.Session
+	if err := s.db.First(&session, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &session, nil
+}
+
+func (s *sessionStore) ListActive(userID uuid.UUID) ([]models.Session, error) {
+	var sessions []models.Session
+	err := s.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (s *sessionStore) Touch(id uuid.UUID, ip string, expiresAt *time.Time) error {
+	fields := map[string]interface{}{"last_seen_at": time.Now(), "ip": ip}
+	if expiresAt != nil {
+		fields["expires_at"] = *expiresAt
+	}
+	return s.db.Model(&models.Session{}).Where("id = ?", id).Updates(fields).Error
+}
+
+// Revoke ends one of the user's sessions together with its refresh tokens
+func (s *sessionStore) Revoke(userID, id uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		res := tx.Model(&models.Session{}).
+			Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+			Update("revoked_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return tx.Model(&models.RefreshToken{}).
+			Where("family_id = ? AND revoked_at IS NULL", id).
+			Update("revoked_at", now).Error
+	})
+}
+
+// RevokeAll ends every session of the user
+func (s *sessionStore) RevokeAll(userID uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&models.Session{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error
+	})
+}
+
+// DeleteStale removes sessions and refresh tokens that expired or were
+// revoked before cutoff
+func (s *sessionStore) DeleteStale(cutoff time.Time) (int64, error) {
+	var deleted int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expires_at < ? OR revoked_at < ?", cutoff, cutoff).
+			Delete(&models.RefreshToken{}).Error; err != nil {
+			return err
+		}
+		res := tx.Where("expires_at < ? OR revoked_at < ?", cutoff, cutoff).Delete(&models.Session{})
+		deleted = res.RowsAffected
+		return res.Error
+	})
+	return deleted, err
+}
@@ -0,0 +1,535 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrNotFound is returned when a lookup matches no rows
+var ErrNotFound = errors.New("record not found")
+
+// ErrTokenUsed is returned when a refresh token was already rotated
+var ErrTokenUsed = errors.New("refresh token already used")
+
+// ErrNotPending is returned when a friend request was already answered
+var ErrNotPending = errors.New("friend request already answered")
+
+// UserFilter narrows down the admin user listing
+type UserFilter struct {
+	Search    string // matches username or email
+	Role      string
+	Suspended *bool
+	Limit     int
+	Offset    int
+}
+
+type UserStore interface {
+	Create(user *models.User) error
+	GetByID(id uuid.UUID) (*models.User, error)
+	// GetByIDs loads many users in one query; unknown or deleted IDs are
+	// left out
+	GetByIDs(ids []uuid.UUID) ([]models.User, error)
+	GetByEmail(email string) (*models.User, error)
+	GetByUsername(username string) (*models.User, error)
+	// GetByUsernames leaves out unknown and deleted names
+	GetByUsernames(usernames []string) ([]models.User, error)
+	Save(user *models.User) error
+	Updates(id uuid.UUID, fields map[string]interface{}) error
+	// Delete is a soft delete; the account can be restored until purged
+	Delete(id, deletedBy uuid.UUID) error
+	GetDeletedByEmail(email string) (*models.User, error)
+	// Restore undoes a delete made after cutoff
+	Restore(id uuid.UUID, cutoff time.Time) error
+	// Purge permanently removes accounts deleted before cutoff and everything
+	// they own
+	Purge(cutoff time.Time) (int64, error)
+	List(filter UserFilter) ([]models.User, error)
+	// RepairCounters recomputes follower, following and post counts from
+	// the source tables
+	RepairCounters() (int64, error)
+}
+
+// PostFilter narrows down a post listing
+type PostFilter struct {
+	Limit  int
+	Offset int
+	// ViewerID hides posts by users in a block relation with the viewer,
+	// and posts matching the viewer's mutes
+	ViewerID uuid.UUID
+}
+
+// Cursor is a keyset position: the next page starts strictly after the row
+// with this creation time and ID, so inserts never shift pages
+type Cursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// FeedItem is a post joined with its author
+type FeedItem struct {
+	models.Post
+	Username string
+	Avatar   string
+}
+
+type PostStore interface {
+	Create(post *models.Post) error
+	GetByID(id uuid.UUID) (*models.Post, error)
+	List(filter PostFilter) ([]models.Post, error)
+	Updates(id uuid.UUID, fields map[string]interface{}) error
+	// Edit changes title and/or content, sets edited_at and records the new
+	// version as a revision. Unchanged values are a no-op.
+	Edit(id, editorID uuid.UUID, title, content *string) (*models.Post, error)
+	Revisions(postID uuid.UUID) ([]models.PostRevision, error)
+	// Delete is a soft delete; the post can be restored until purged
+	Delete(id, deletedBy uuid.UUID) error
+	GetDeleted(id uuid.UUID) (*models.Post, error)
+	// Restore undoes a delete made after cutoff
+	Restore(id uuid.UUID, cutoff time.Time) error
+	// Purge permanently removes posts deleted before cutoff with their
+	// comments, votes and revisions
+	Purge(cutoff time.Time) (int64, error)
+	// RepairCounters recomputes vote and comment counts from the source
+	// tables
+	RepairCounters() (int64, error)
+}
+
+// TimelineStore keeps a materialized timeline per user. Posts are pushed to
+// followers when written, except for accounts with at least maxFollowers
+// followers, whose posts are pulled from the posts table when read. Which
+// way a post went is recorded on it as FannedOut.
+type TimelineStore interface {
+	// FanOut pushes a post to the timelines of its author's followers and
+	// records whether it did
+	FanOut(post *models.Post, maxFollowers int) error
+	// Backfill copies an author's latest posts into a new follower's timeline
+	Backfill(userID, authorID uuid.UUID, limit int) error
+	RemoveAuthor(userID, authorID uuid.UUID) error
+	RemovePost(postID uuid.UUID) error
+	// Page returns the user's timeline newest first, starting after the
+	// cursor when one is given. The user's own posts are always included.
+	Page(userID uuid.UUID, after *Cursor, limit int) ([]FeedItem, error)
+	// Audience returns those of userIDs whose timeline shows the post: the
+	// author and followers who neither block nor mute it
+	Audience(post *models.Post, userIDs []uuid.UUID) ([]uuid.UUID, error)
+}
+
+// TrendingSignal is a post's activity within a trending window and within
+// its most recent part
+type TrendingSignal struct {
+	PostID         uuid.UUID
+	CreatedAt      time.Time
+	Votes          int64 // net votes cast or changed in the window
+	Comments       int64
+	RecentVotes    int64
+	RecentComments int64
+}
+
+// TrendingItem is a ranked post in a trending window
+type TrendingItem struct {
+	FeedItem
+	Rank int
+	Hot  float64
+}
+
+// TrendingStore holds the ranked posts of each trending window, which a job
+// recomputes from Signals and stores with Replace
+type TrendingStore interface {
+	// Signals returns every live post created or active since the given time
+	Signals(since, recentSince time.Time) ([]TrendingSignal, error)
+	// Replace swaps the ranking of a window in one transaction
+	Replace(window string, entries []models.TrendingPost) error
+	// Page hides posts by users in a block relation with viewerID and
+	// posts matching their mutes
+	Page(window string, limit int, viewerID uuid.UUID) ([]TrendingItem, error)
+}
+
+// SearchDoc is the searchable text of a post, comment or user. For users
+// AuthorID is the user's own ID, Title the username and Body the bio.
+type SearchDoc struct {
+	ID        uuid.UUID
+	AuthorID  uuid.UUID
+	Title     string
+	Body      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Deleted   bool
+}
+
+// CommentItem is a comment joined with its author and the post it is on
+type CommentItem struct {
+	models.Comment
+	Username  string
+	Avatar    string
+	PostTitle string
+}
+
+// SearchStore feeds search engines that keep their own index and loads the
+// rows behind search hits
+type SearchStore interface {
+	// PostDocs, CommentDocs and UserDocs return rows updated at or after
+	// since, oldest first, soft-deleted ones included
+	PostDocs(since time.Time) ([]SearchDoc, error)
+	CommentDocs(since time.Time) ([]SearchDoc, error)
+	UserDocs(since time.Time) ([]SearchDoc, error)
+	// Posts, Comments and Users load live rows by ID in no particular
+	// order. Rows by users in a block relation with viewerID, and posts and
+	// comments matching their mutes, are left out.
+	Posts(ids []uuid.UUID, viewerID uuid.UUID) ([]FeedItem, error)
+	Comments(ids []uuid.UUID, viewerID uuid.UUID) ([]CommentItem, error)
+	Users(ids []uuid.UUID, viewerID uuid.UUID) ([]models.User, error)
+}
+
+type FollowStore interface {
+	Exists(followerID, followeeID uuid.UUID) (bool, error)
+	Create(follow *models.Follow) error
+	Delete(followerID, followeeID uuid.UUID) error
+	// Followers and Following hide users in a block relation with viewerID
+	Followers(userID, viewerID uuid.UUID) ([]models.User, error)
+	Following(userID, viewerID uuid.UUID) ([]models.User, error)
+}
+
+// VoteStore keeps the post's score, upvotes and downvotes in step with
+// every change
+type VoteStore interface {
+	Get(userID, postID uuid.UUID) (*models.Vote, error)
+	Create(vote *models.Vote) error
+	Save(vote *models.Vote) error
+	Delete(vote *models.Vote) error
+}
+
+// VoteTally counts the up and down votes on an item
+type VoteTally struct {
+	Up   int64
+	Down int64
+}
+
+func (t VoteTally) Score() int64 {
+	return t.Up - t.Down
+}
+
+type CommentVoteStore interface {
+	Get(userID, commentID uuid.UUID) (*models.CommentVote, error)
+	Create(vote *models.CommentVote) error
+	Save(vote *models.CommentVote) error
+	Delete(vote *models.CommentVote) error
+	// TalliesByPost counts votes for every comment on a post in one query;
+	// comments without votes are absent
+	TalliesByPost(postID uuid.UUID) (map[uuid.UUID]VoteTally, error)
+}
+
+type CommentStore interface {
+	Create(comment *models.Comment) error
+	GetByID(id uuid.UUID) (*models.Comment, error)
+	// ListByPost hides comments by users in a block relation with viewerID
+	// and comments matching their mutes. Deleted comments are included so
+	// threads can show tombstones.
+	ListByPost(postID, viewerID uuid.UUID) ([]models.Comment, error)
+	Save(comment *models.Comment) error
+	// Edit works like PostStore.Edit
+	Edit(id, editorID uuid.UUID, content string) (*models.Comment, error)
+	Revisions(commentID uuid.UUID) ([]models.CommentRevision, error)
+	// Delete is a soft delete, like PostStore.Delete
+	Delete(id, deletedBy uuid.UUID) error
+	GetDeleted(id uuid.UUID) (*models.Comment, error)
+	Restore(id uuid.UUID, cutoff time.Time) error
+	Purge(cutoff time.Time) (int64, error)
+}
+
+type MessageStore interface {
+	// Create also moves the conversation's last activity to the message
+	Create(msg *models.Message) error
+	GetByID(id uuid.UUID) (*models.Message, error)
+	ListByConversation(conversationID string) ([]models.Message, error)
+	MarkSaved(id uuid.UUID) error
+	DeleteUnsavedBefore(cutoff time.Time) (int64, error)
+}
+
+// ConversationItem is a conversation as listed for one of its members
+type ConversationItem struct {
+	models.Conversation
+	Members     []ConversationMemberItem // live accounts only
+	LastMessage *models.Message
+	Unread      int64 // messages from others since the member last read
+}
+
+// ConversationMemberItem is a member as listed with their conversation
+type ConversationMemberItem struct {
+	models.User
+	GroupRole string // owner, admin or member within the conversation
+}
+
+type ConversationStore interface {
+	// Create stores the conversation and its members together. The creator
+	// of a group owns it.
+	Create(conv *models.Conversation, memberIDs []uuid.UUID) error
+	Get(id uuid.UUID) (*models.Conversation, error)
+	// Update saves the title and avatar
+	Update(conv *models.Conversation) error
+	// Direct returns ErrNotFound if the two users have no direct conversation
+	Direct(a, b uuid.UUID) (*models.Conversation, error)
+	IsMember(conversationID, userID uuid.UUID) (bool, error)
+	// Member returns ErrNotFound if the user is not a member
+	Member(conversationID, userID uuid.UUID) (*models.ConversationMember, error)
+	MemberIDs(conversationID uuid.UUID) ([]uuid.UUID, error)
+	// AddMembers adds the users who are not members yet as plain members and
+	// returns those it added
+	AddMembers(conversationID uuid.UUID, userIDs []uuid.UUID, at time.Time) ([]uuid.UUID, error)
+	// RemoveMember takes the user out of the conversation. When the owner
+	// goes, the longest-standing admin, or else member, takes over and is
+	// returned. When the last member goes, the conversation is deleted.
+	RemoveMember(conversationID, userID uuid.UUID) (newOwner *models.ConversationMember, err error)
+	// SetRole sets admin or member; see TransferOwnership for the owner
+	SetRole(conversationID, userID uuid.UUID, role string) error
+	// TransferOwnership makes to the owner and the previous owner an admin
+	TransferOwnership(conversationID, from, to uuid.UUID) error
+	// List returns the user's conversations by latest activity, starting
+	// after the cursor (last activity and ID) when one is given
+	List(userID uuid.UUID, after *Cursor, limit int) ([]ConversationItem, error)
+	// Item returns one conversation as List would show it to userID
+	Item(conversationID, userID uuid.UUID) (*ConversationItem, error)
+	MarkRead(conversationID, userID uuid.UUID, at time.Time) error
+
+	CreateInvite(invite *models.ConversationInvite) error
+	// Invite finds an invite by token hash, expired and revoked ones
+	// included, and returns ErrNotFound otherwise
+	Invite(hash string) (*models.ConversationInvite, error)
+	// Invites lists the conversation's usable invites, newest first
+	Invites(conversationID uuid.UUID, now time.Time) ([]models.ConversationInvite, error)
+	// RevokeInvite returns ErrNotFound unless the invite belongs to the
+	// conversation and is not revoked yet
+	RevokeInvite(conversationID, inviteID uuid.UUID, at time.Time) error
+}
+
+// PendingFriendRequest is a friend request joined with its sender
+type PendingFriendRequest struct {
+	ID        int       `json:"id"`
+	SenderID  string    `json:"sender_id"`
+	Username  string    `json:"username"`
+	Avatar    string    `json:"avatar"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type FriendStore interface {
+	CreateRequest(senderID, receiverID string) (*models.FriendRequest, error)
+	GetRequest(id int) (*models.FriendRequest, error)
+	// Accept and Reject answer a pending request, or fail with ErrNotPending
+	Accept(req *models.FriendRequest) error
+	Reject(id int) error
+	Pending(receiverID string) ([]PendingFriendRequest, error)
+	// Mutuals returns users that follow userID and are followed back by them
+	Mutuals(userID string) ([]models.User, error)
+	// MutualsOf runs Mutuals for many users in one query, keyed by user
+	MutualsOf(userIDs []uuid.UUID) (map[uuid.UUID][]models.User, error)
+}
+
+type BlockStore interface {
+	// Create also removes follows between the two users in both directions
+	Create(blockerID, blockedID uuid.UUID) error
+	Delete(blockerID, blockedID uuid.UUID) error
+	Blocked(blockerID uuid.UUID) ([]models.User, error)
+	// Between reports whether either user has blocked the other
+	Between(a, b uuid.UUID) (bool, error)
+	// Blockers returns the users who blocked blockedID
+	Blockers(blockedID uuid.UUID) ([]uuid.UUID, error)
+}
+
+type MuteStore interface {
+	// Create refreshes the expiry when the same mute already exists
+	Create(mute *models.Mute) error
+	Delete(userID, id uuid.UUID) error
+	// Active returns the user's mutes that have not expired
+	Active(userID uuid.UUID) ([]models.Mute, error)
+	DeleteExpired(cutoff time.Time) (int64, error)
+}
+
+// NotificationActors are the users behind a notification that its
+// recipient may see: how many, and the most recent few
+type NotificationActors struct {
+	Count  int
+	Recent []models.User
+}
+
+type NotificationStore interface {
+	// Notify records an event for n.UserID. An unread notification of the
+	// same type on the same entity absorbs it, counting each actor once;
+	// n is filled in with the stored notification either way.
+	Notify(n *models.Notification) error
+	// Page returns the user's notifications by latest activity, starting
+	// after the cursor when one is given. Notifications whose actors are
+	// all blocked, muted or deleted are left out, as are types the user
+	// turned off in the app.
+	Page(userID uuid.UUID, after *Cursor, limit int, unreadOnly bool) ([]models.Notification, error)
+	// Actors returns up to limit recent actors of each notification,
+	// hiding those userID blocked or muted
+	Actors(userID uuid.UUID, ids []uuid.UUID, limit int) (map[uuid.UUID]NotificationActors, error)
+	UnreadCount(userID uuid.UUID) (int64, error)
+	// MarkRead returns ErrNotFound unless the notification is the user's
+	MarkRead(userID, id uuid.UUID) error
+	MarkAllRead(userID uuid.UUID) (int64, error)
+
+	// Preferences returns the user's preference for every type, defaults
+	// included
+	Preferences(userID uuid.UUID) ([]models.NotificationPreference, error)
+	Preference(userID uuid.UUID, kind string) (models.NotificationPreference, error)
+	SavePreferences(prefs []models.NotificationPreference) error
+	// Settings returns the user's settings, or the defaults if never saved
+	Settings(userID uuid.UUID) (models.NotificationSettings, error)
+	SaveSettings(settings *models.NotificationSettings) error
+
+	// EmailRecipients returns the users with notifications waiting to be
+	// emailed: unread, changed since last emailed and not turned off by email
+	EmailRecipients() ([]uuid.UUID, error)
+	// PendingEmail returns up to limit of the user's waiting notifications
+	// by latest activity, each with its email delivery setting
+	PendingEmail(userID uuid.UUID, limit int) ([]PendingEmail, error)
+	MarkEmailed(ids []uuid.UUID, at time.Time) error
+}
+
+// PendingEmail is a notification waiting to be emailed. Instant ones were
+// held back by quiet hours.
+type PendingEmail struct {
+	models.Notification
+	Delivery string
+}
+
+type RefreshTokenStore interface {
+	Create(token *models.RefreshToken) error
+	GetByHash(hash string) (*models.RefreshToken, error)
+	Rotate(old, next *models.RefreshToken) error
+	RevokeFamily(familyID uuid.UUID) error
+}
+
+type SessionStore interface {
+	Create(session *models.Session) error
+	GetByID(id uuid.UUID) (*models.Session, error)
+	ListActive(userID uuid.UUID) ([]models.Session, error)
+	// Touch records activity; a non-nil expiresAt also extends the session
+	Touch(id uuid.UUID, ip string, expiresAt *time.Time) error
+	Revoke(userID, id uuid.UUID) error
+	RevokeAll(userID uuid.UUID) error
+	DeleteStale(cutoff time.Time) (int64, error)
+}
+
+type PasswordResetStore interface {
+	Create(token *models.PasswordResetToken) error
+	Consume(hash string) (*models.PasswordResetToken, error)
+	DeleteExpired(cutoff time.Time) (int64, error)
+}
+
+type VerificationStore interface {
+	Create(token *models.EmailVerificationToken) error
+	Consume(hash string) (*models.EmailVerificationToken, error)
+	DeleteExpired(cutoff time.Time) (int64, error)
+}
+
+// Store bundles every repository the handlers and jobs depend on
+type Store struct {
+	Users         UserStore
+	Posts         PostStore
+	Follows       FollowStore
+	Timelines     TimelineStore
+	Trending      TrendingStore
+	Search        SearchStore
+	Votes         VoteStore
+	Comments      CommentStore
+	CommentVotes  CommentVoteStore
+	Messages      MessageStore
+	Conversations ConversationStore
+	Friends       FriendStore
+	Blocks        BlockStore
+	Mutes         MuteStore
+	Notifications NotificationStore
+	RefreshTokens RefreshTokenStore
+	Sessions      SessionStore
+	PasswordReset PasswordResetStore
+	Verifications VerificationStore
+
+	db *gorm.DB
+}
+
+// New wires the gorm-backed repositories on top of an open connection. The
+// same implementation serves both the Postgres and the embedded SQLite driver.
+func New(db *gorm.DB) *Store {
+	return &Store{
+		Users:         &userStore{db: db},
+		Posts:         &postStore{db: db},
+		Follows:       &followStore{db: db},
+		Timelines:     &timelineStore{db: db},
+		Trending:      &trendingStore{db: db},
+		Search:        &searchStore{db: db},
+		Votes:         &voteStore{db: db},
+		Comments:      &commentStore{db: db},
+		CommentVotes:  &commentVoteStore{db: db},
+		Messages:      &messageStore{db: db},
+		Conversations: &conversationStore{db: db},
+		Friends:       &friendStore{db: db},
+		Blocks:        &blockStore{db: db},
+		Mutes:         &muteStore{db: db},
+		Notifications: &notificationStore{db: db},
+		RefreshTokens: &refreshTokenStore{db: db},
+		Sessions:      &sessionStore{db: db},
+		PasswordReset: &passwordResetStore{db: db},
+		Verifications: &verificationStore{db: db},
+		db:            db,
+	}
+}
+
+// Migrate creates or updates the schema for all models
+func (s *Store) Migrate() error {
+	// Notifications had integer IDs before anything wrote them; the old
+	// table is dropped rather than converted
+	m := s.db.Migrator()
+	if m.HasTable(&models.Notification{}) && !m.HasColumn(&models.Notification{}, "entity_type") {
+		if err := m.DropTable(&models.Notification{}); err != nil {
+			return err
+		}
+	}
+
+	err := s.db.AutoMigrate(
+		&models.User{},
+		&models.Post{},
+		&models.Follow{},
+		&models.TimelineEntry{},
+		&models.TrendingPost{},
+		&models.Vote{},
+		&models.Comment{},
+		&models.CommentVote{},
+		&models.PostRevision{},
+		&models.CommentRevision{},
+		&models.Message{},
+		&models.Conversation{},
+		&models.ConversationMember{},
+		&models.ConversationInvite{},
+		&models.FriendRequest{},
+		&models.Friend{},
+		&models.Block{},
+		&models.Mute{},
+		&models.Notification{},
+		&models.NotificationActor{},
+		&models.NotificationPreference{},
+		&models.NotificationSettings{},
+		&models.RefreshToken{},
+		&models.Session{},
+		&models.PasswordResetToken{},
+		&models.EmailVerificationToken{},
+	)
+	if err != nil {
+		return err
+	}
+	if err := adoptLegacyConversations(s.db); err != nil {
+		return err
+	}
+	return assignGroupOwners(s.db)
+}
+
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,154 @@
+package store
+
+import (
+	"slices"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// fanOutBatchSize bounds the rows sent per INSERT while fanning out
+const fanOutBatchSize = 500
+
+type timelineStore struct {
+	db *gorm.DB
+}
+
+func (s *timelineStore) FanOut(post *models.Post, maxFollowers int) error {
+	var followers int64
+	if err := s.db.Model(&models.User{}).Where("id = ?", post.UserID).Select("follower_count").Scan(&followers).Error; err != nil {
+		return err
+	}
+	if followers >= int64(maxFollowers) {
+		return s.markFannedOut(post, false)
+	}
+
+	var followerIDs []uuid.UUID
+	if err := s.db.Model(&models.Follow{}).Where("followee_id = ?", post.UserID).Pluck("follower_id", &followerIDs).Error; err != nil {
+		return err
+	}
+
+	entries := make([]models.TimelineEntry, 0, len(followerIDs))
+	for _, id := range followerIDs {
+		entries = append(entries, models.TimelineEntry{
+			UserID:    id,
+			PostID:    post.ID,
+			AuthorID:  post.UserID,
+			CreatedAt: post.CreatedAt,
+		})
+	}
+	if err := s.insert(entries); err != nil {
+		return err
+	}
+	return s.markFannedOut(post, true)
+}
+
+func (s *timelineStore) markFannedOut(post *models.Post, fannedOut bool) error {
+	post.FannedOut = fannedOut
+	return s.db.Model(&models.Post{}).Where("id = ?", post.ID).UpdateColumn("fanned_out", fannedOut).Error
+}
+
+func (s *timelineStore) Backfill(userID, authorID uuid.UUID, limit int) error {
+	var posts []models.Post
+	err := s.db.Select("id", "created_at").
+		Where("user_id = ?", authorID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&posts).Error
+	if err != nil {
+		return err
+	}
+
+	entries := make([]models.TimelineEntry, 0, len(posts))
+	for _, p := range posts {
+		entries = append(entries, models.TimelineEntry{
+			UserID:    userID,
+			PostID:    p.ID,
+			AuthorID:  authorID,
+			CreatedAt: p.CreatedAt,
+		})
+	}
+	return s.insert(entries)
+}
+
+// insert skips entries that are already present
+func (s *timelineStore) insert(entries []models.TimelineEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return s.db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(entries, fanOutBatchSize).Error
+}
+
+func (s *timelineStore) RemoveAuthor(userID, authorID uuid.UUID) error {
+	return s.db.Where("user_id = ? AND author_id = ?", userID, authorID).Delete(&models.TimelineEntry{}).Error
+}
+
+func (s *timelineStore) RemovePost(postID uuid.UUID) error {
+	return s.db.Where("post_id = ?", postID).Delete(&models.TimelineEntry{}).Error
+}
+
+func (s *timelineStore) Page(userID uuid.UUID, after *Cursor, limit int) ([]FeedItem, error) {
+	// Pushed entries, the user's own posts, and posts of followed accounts
+	// that were not fanned out, pulled live
+	query := s.db.Table("posts").
+		Select(feedColumns).
+		Joins("JOIN users ON users.id = posts.user_id AND users.deleted_at IS NULL").
+		Where("posts.deleted_at IS NULL").
+		Where(`(posts.id IN (SELECT post_id FROM timeline_entries WHERE user_id = ?)
+			OR posts.user_id = ?
+			OR (NOT posts.fanned_out
+				AND posts.user_id IN (SELECT followee_id FROM follows WHERE follower_id = ?)))`,
+			userID, userID, userID).
+		Scopes(
+			visibleTo("posts.user_id", userID),
+			unmuted(userID, "posts.user_id", "posts.title", "posts.content"),
+		)
+
+	if after != nil {
+		query = query.Where("posts.created_at < ? OR (posts.created_at = ? AND posts.id < ?)",
+			after.CreatedAt, after.CreatedAt, after.ID)
+	}
+
+	var items []FeedItem
+	err := query.Order("posts.created_at DESC, posts.id DESC").Limit(limit).Scan(&items).Error
+	return items, err
+}
+
+func (s *timelineStore) Audience(post *models.Post, userIDs []uuid.UUID) ([]uuid.UUID, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+
+	var candidates []uuid.UUID
+	err := s.db.Model(&models.Follow{}).
+		Where("followee_id = ? AND follower_id IN ?", post.UserID, userIDs).
+		Pluck("follower_id", &candidates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var audience []uuid.UUID
+	if slices.Contains(userIDs, post.UserID) {
+		audience = append(audience, post.UserID)
+	}
+	// Blocks and mutes are per viewer, so each follower is checked on its own
+	for _, id := range candidates {
+		var visible int64
+		err := s.db.Table("posts").
+			Where("posts.id = ?", post.ID).
+			Scopes(
+				visibleTo("posts.user_id", id),
+				unmuted(id, "posts.user_id", "posts.title", "posts.content"),
+			).
+			Count(&visible).Error
+		if err != nil {
+			return nil, err
+		}
+		if visible > 0 {
+			audience = append(audience, id)
+		}
+	}
+	return audience, nil
+}
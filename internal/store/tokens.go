@@ -0,0 +1,48 @@
+package store
+
+import (
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type refreshTokenStore struct {
+	db *gorm.DB
+}
+
+func (s *refreshTokenStore) Create(token *models.RefreshToken) error {
+	return s.db.Create(token).Error
+}
+
+func (s *refreshTokenStore) GetByHash(hash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	if err := s.db.Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &token, nil
+}
+
+// Rotate marks old as used and stores next in the same transaction. It fails
+// with ErrTokenUsed when another request already rotated old.
+func (s *refreshTokenStore) Rotate(old, next *models.RefreshToken) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", old.ID).
+			Update("used_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrTokenUsed
+		}
+		return tx.Create(next).Error
+	})
+}
+
+func (s *refreshTokenStore) RevokeFamily(familyID uuid.UUID) error {
+	return s.db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
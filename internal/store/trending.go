@@ -0,0 +1,61 @@
+package store
+
+import (
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type trendingStore struct {
+	db *gorm.DB
+}
+
+func (s *trendingStore) Signals(since, recentSince time.Time) ([]TrendingSignal, error) {
+	var signals []TrendingSignal
+	err := s.db.Table("posts").
+		Select(`posts.id AS post_id, posts.created_at,
+			COALESCE((SELECT SUM(v.value) FROM votes v WHERE v.post_id = posts.id AND v.updated_at >= ?), 0) AS votes,
+			(SELECT COUNT(*) FROM comments c WHERE c.post_id = posts.id AND c.deleted_at IS NULL AND c.created_at >= ?) AS comments,
+			COALESCE((SELECT SUM(v.value) FROM votes v WHERE v.post_id = posts.id AND v.updated_at >= ?), 0) AS recent_votes,
+			(SELECT COUNT(*) FROM comments c WHERE c.post_id = posts.id AND c.deleted_at IS NULL AND c.created_at >= ?) AS recent_comments`,
+			since, since, recentSince, recentSince).
+		Joins("JOIN users ON users.id = posts.user_id AND users.deleted_at IS NULL").
+		Where("posts.deleted_at IS NULL").
+		Where(`(posts.created_at >= ?
+			OR EXISTS (SELECT 1 FROM votes v WHERE v.post_id = posts.id AND v.updated_at >= ?)
+			OR EXISTS (SELECT 1 FROM comments c WHERE c.post_id = posts.id AND c.created_at >= ?))`,
+			since, since, since).
+		Scan(&signals).Error
+	return signals, err
+}
+
+func (s *trendingStore) Replace(window string, entries []models.TrendingPost) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("time_window = ?", window).Delete(&models.TrendingPost{}).Error; err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(entries, 100).Error
+	})
+}
+
+func (s *trendingStore) Page(window string, limit int, viewerID uuid.UUID) ([]TrendingItem, error) {
+	var items []TrendingItem
+	err := s.db.Table("trending_posts tp").
+		Select(feedColumns+", tp.rank, tp.score AS hot").
+		Joins("JOIN posts ON posts.id = tp.post_id AND posts.deleted_at IS NULL").
+		Joins("JOIN users ON users.id = posts.user_id AND users.deleted_at IS NULL").
+		Where("tp.time_window = ?", window).
+		Scopes(
+			visibleTo("posts.user_id", viewerID),
+			unmuted(viewerID, "posts.user_id", "posts.title", "posts.content"),
+		).
+		Order("tp.rank ASC").
+		Limit(limit).
+		Scan(&items).Error
+	return items, err
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"strings"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type userStore struct {
+	db *gorm.DB
+}
+
+func (s *userStore) Create(user *models.User) error {
+	return s.db.Create(user).Error
+}
+
+func (s *userStore) GetByID(id uuid.UUID) (*models.User, error) {
+	var user models.User
+	if err := s.db.First(&user, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (s *userStore) GetByIDs(ids []uuid.UUID) ([]models.User, error) {
+	var users []models.User
+	if len(ids) == 0 {
+		return users, nil
+	}
+	err := s.db.Where("id IN ?", ids).Find(&users).Error
+	return users, err
+}
+
+func (s *userStore) GetByEmail(email string) (*models.User, error) {
+	var user models.User
+	if err := s.db.Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (s *userStore) GetByUsername(username string) (*models.User, error) {
+	var user models.User
+	if err := s.db.Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (s *userStore) GetByUsernames(usernames []string) ([]models.User, error) {
+	var users []models.User
+	if len(usernames) == 0 {
+		return users, nil
+	}
+	err := s.db.Where("username IN ?", usernames).Find(&users).Error
+	return users, err
+}
+
+func (s *userStore) Save(user *models.User) error {
+	return s.db.Save(user).Error
+}
+
+func (s *userStore) Updates(id uuid.UUID, fields map[string]interface{}) error {
+	return s.db.Model(&models.User{}).Where("id = ?", id).Updates(fields).Error
+}
+
+func (s *userStore) Delete(id, deletedBy uuid.UUID) error {
+	_, err := softDelete(s.db, &models.User{}, id, deletedBy)
+	return err
+}
+
+func (s *userStore) GetDeletedByEmail(email string) (*models.User, error) {
+	var user models.User
+	if err := s.db.Unscoped().Where("email = ? AND deleted_at IS NOT NULL", email).First(&user).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (s *userStore) Restore(id uuid.UUID, cutoff time.Time) error {
+	return restore(s.db, &models.User{}, id, cutoff)
+}
+
+func (s *userStore) RepairCounters() (int64, error) {
+	return recountAll(s.db, &models.User{}, userCounters)
+}
+
+func (s *userStore) Purge(cutoff time.Time) (int64, error) {
+	ids, err := deletedBefore(s.db, &models.User{}, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(ids)), purgeInBatches(s.db, ids, purgeUsers)
+}
+
+func (s *userStore) List(filter UserFilter) ([]models.User, error) {
+	query := s.db.Model(&models.User{})
+
+	if filter.Search != "" {
+		like := "%" + strings.ToLower(filter.Search) + "%"
+		query = query.Where("LOWER(username) LIKE ? OR LOWER(email) LIKE ?", like, like)
+	}
+	if filter.Role != "" {
+		query = query.Where("role = ?", filter.Role)
+	}
+	if filter.Suspended != nil {
+		if *filter.Suspended {
+			query = query.Where("suspended_at IS NOT NULL")
+		} else {
+			query = query.Where("suspended_at IS NULL")
+		}
+	}
+
+	var users []models.User
+	err := query.Order("created_at DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&users).Error
+	return users, err
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"gorm.io/gorm"
+)
+
+type verificationStore struct {
+	db *gorm.DB
+}
+
+func (s *verificationStore) Create(token *models.EmailVerificationToken) error {
+	return s.db.Create(token).Error
+}
+
+// Consume redeems an unused, unexpired token and marks its user verified in
+// the same transaction. It returns ErrNotFound otherwise.
+func (s *verificationStore) Consume(hash string) (*models.EmailVerificationToken, error) {
+	var token models.EmailVerificationToken
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hash, now).
+			First(&token).Error; err != nil {
+			return notFound(err)
+		}
+
+		res := tx.Model(&models.EmailVerificationToken{}).
+			Where("user_id = ? AND used_at IS NULL", token.UserID).
+			Update("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		return tx.Model(&models.User{}).Where("id = ?", token.UserID).
+			Updates(map[string]interface{}{"email_verified": true, "updated_at": now}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (s *verificationStore) DeleteExpired(cutoff time.Time) (int64, error) {
+	res := s.db.Where("expires_at < ? OR used_at < ?", cutoff, cutoff).Delete(&models.EmailVerificationToken{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,103 @@
+package store
+
+import (
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type voteStore struct {
+	db *gorm.DB
+}
+
+func (s *voteStore) Get(userID, postID uuid.UUID) (*models.Vote, error) {
+	var vote models.Vote
+	if err := s.db.Where("user_id = ? AND post_id = ?", userID, postID).First(&vote).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &vote, nil
+}
+
+func (s *voteStore) Create(vote *models.Vote) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(vote).Error; err != nil {
+			return err
+		}
+		return bumpVote(tx, vote.PostID, 0, vote.Value)
+	})
+}
+
+func (s *voteStore) Save(vote *models.Vote) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var old models.Vote
+		if err := tx.First(&old, "id = ?", vote.ID).Error; err != nil {
+			return notFound(err)
+		}
+		if err := tx.Save(vote).Error; err != nil {
+			return err
+		}
+		return bumpVote(tx, vote.PostID, old.Value, vote.Value)
+	})
+}
+
+func (s *voteStore) Delete(vote *models.Vote) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var old models.Vote
+		if err := tx.First(&old, "id = ?", vote.ID).Error; err != nil {
+			return notFound(err)
+		}
+		if err := tx.Delete(&old).Error; err != nil {
+			return err
+		}
+		return bumpVote(tx, old.PostID, old.Value, 0)
+	})
+}
+
+type commentVoteStore struct {
+	db *gorm.DB
+}
+
+func (s *commentVoteStore) Get(userID, commentID uuid.UUID) (*models.CommentVote, error) {
+	var vote models.CommentVote
+	if err := s.db.Where("user_id = ? AND comment_id = ?", userID, commentID).First(&vote).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &vote, nil
+}
+
+func (s *commentVoteStore) Create(vote *models.CommentVote) error {
+	return s.db.Create(vote).Error
+}
+
+func (s *commentVoteStore) Save(vote *models.CommentVote) error {
+	return s.db.Save(vote).Error
+}
+
+func (s *commentVoteStore) Delete(vote *models.CommentVote) error {
+	return s.db.Delete(vote).Error
+}
+
+func (s *commentVoteStore) TalliesByPost(postID uuid.UUID) (map[uuid.UUID]VoteTally, error) {
+	var rows []struct {
+		CommentID uuid.UUID
+		Up        int64
+		Down      int64
+	}
+	err := s.db.Table("comment_votes cv").
+		Select(`cv.comment_id,
+			SUM(CASE WHEN cv.value > 0 THEN 1 ELSE 0 END) AS up,
+			SUM(CASE WHEN cv.value < 0 THEN 1 ELSE 0 END) AS down`).
+		Joins("JOIN comments c ON c.id = cv.comment_id").
+		Where("c.post_id = ?", postID).
+		Group("cv.comment_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	tallies := make(map[uuid.UUID]VoteTally, len(rows))
+	for _, row := range rows {
+		tallies[row.CommentID] = VoteTally{Up: row.Up, Down: row.Down}
+	}
+	return tallies, nil
+}
@@ -0,0 +1,84 @@
+// Package trending ranks posts by recent activity, in the spirit of Hacker
+// News and Reddit "hot" rankings: votes and comments push a post up, age
+// pulls it down, and activity in the last part of the window counts twice so
+// fast-rising posts overtake ones that were busy earlier.
+package trending
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+)
+
+// Windows are the selectable trending periods
+var Windows = map[string]time.Duration{
+	"1h":  time.Hour,
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+}
+
+const DefaultWindow = "24h"
+
+// MaxEntries is how many posts are kept per window
+const MaxEntries = 100
+
+const (
+	// commentWeight values a comment over a vote; it takes more effort
+	commentWeight = 1.5
+	// gravity is how fast age wins over activity
+	gravity = 1.5
+	// recentShare is the final part of the window that counts as recent
+	recentShare = 4
+	// ageUnits splits a window into the steps age is counted in, so a post
+	// ages as fast relative to its window in 1h as in 7d
+	ageUnits = 24
+)
+
+// RecentSince is where the recent part of a window starts
+func RecentSince(window time.Duration, now time.Time) time.Time {
+	return now.Add(-window / recentShare)
+}
+
+// Hot scores a post: activity plus recent activity, over its age raised to
+// the gravity. Posts with no net positive activity score zero or less.
+func Hot(s store.TrendingSignal, window time.Duration, now time.Time) float64 {
+	activity := float64(s.Votes) + commentWeight*float64(s.Comments)
+	recent := float64(s.RecentVotes) + commentWeight*float64(s.RecentComments)
+
+	age := float64(now.Sub(s.CreatedAt)) / float64(window/ageUnits)
+	return (activity + recent) / math.Pow(max(age, 0)+2, gravity)
+}
+
+// Rank orders the signals of a window hottest first and keeps the top
+// MaxEntries with a positive score
+func Rank(window string, signals []store.TrendingSignal, now time.Time) []models.TrendingPost {
+	period := Windows[window]
+
+	entries := make([]models.TrendingPost, 0, len(signals))
+	for _, s := range signals {
+		score := Hot(s, period, now)
+		if score <= 0 {
+			continue
+		}
+		entries = append(entries, models.TrendingPost{
+			Window:     window,
+			PostID:     s.PostID,
+			Score:      score,
+			ComputedAt: now,
+		})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Score > entries[j].Score
+	})
+	if len(entries) > MaxEntries {
+		entries = entries[:MaxEntries]
+	}
+	for i := range entries {
+		entries[i].Rank = i + 1
+	}
+	return entries
+}
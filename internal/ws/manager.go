@@ -2,28 +2,74 @@ package ws
 
 import (
 	"log"
+	"slices"
 	"sync"
-
-	"github.com/gofiber/websocket/v2"
 )
 
+// Client is one open chat connection of a conversation. Like a Subscriber,
+// the manager queues messages on Send and closes it when the client is
+// unregistered or kicked; the connection's handler is the only one writing
+// to the socket.
 type Client struct {
-	Conn           *websocket.Conn
 	UserID         string
 	ConversationID string
+	Send           chan []byte
+}
+
+func NewClient(userID, conversationID string) *Client {
+	return &Client{UserID: userID, ConversationID: conversationID, Send: make(chan []byte, subscriberBuffer)}
+}
+
+// subscriberBuffer is how many events a subscriber or client may fall
+// behind before further ones are dropped
+const subscriberBuffer = 32
+
+// queueBuffer is how many Push and Kick requests may wait for the manager,
+// so the requests sending them do not wait on it
+const queueBuffer = 256
+
+// Subscriber is one open real-time connection of a user, over WebSocket or
+// SSE. The manager queues events on Send and closes it on Unsubscribe; the
+// connection's handler is the only one writing to the client.
+type Subscriber struct {
+	UserID string
+	Send   chan []byte
+}
+
+func NewSubscriber(userID string) *Subscriber {
+	return &Subscriber{UserID: userID, Send: make(chan []byte, subscriberBuffer)}
 }
 
 type Manager struct {
-	mu         sync.RWMutex
-	clients    map[string][]*Client // conversationID -> []*Client
-	Register   chan *Client
-	Unregister chan *Client
-	Broadcast  chan MessagePayload
+	mu          sync.RWMutex
+	clients     map[string][]*Client     // conversationID -> []*Client
+	subscribers map[string][]*Subscriber // userID -> []*Subscriber
+	Register    chan *Client
+	Unregister  chan *Client
+	Broadcast   chan MessagePayload
+	Subscribe   chan *Subscriber
+	Unsubscribe chan *Subscriber
+	Push        chan UserPayload
+	Kick        chan MemberPayload
 }
 
 type MessagePayload struct {
 	ConversationID string
 	Data           []byte
+	Except         []string // users not to send it to
+}
+
+// UserPayload is an event for every open connection of a user
+type UserPayload struct {
+	UserID string
+	Data   []byte
+}
+
+// MemberPayload names a user of a conversation whose chat connections are
+// closed, once they are no longer a member
+type MemberPayload struct {
+	ConversationID string
+	UserID         string
 }
 
 // Global manager instance
@@ -31,13 +77,37 @@ var ManagerInstance = NewManager()
 
 func NewManager() *Manager {
 	return &Manager{
-		clients:    make(map[string][]*Client),
-		Register:   make(chan *Client),
-		Unregister: make(chan *Client),
-		Broadcast:  make(chan MessagePayload),
+		clients:     make(map[string][]*Client),
+		subscribers: make(map[string][]*Subscriber),
+		Register:    make(chan *Client),
+		Unregister:  make(chan *Client),
+		Broadcast:   make(chan MessagePayload),
+		Subscribe:   make(chan *Subscriber),
+		Unsubscribe: make(chan *Subscriber),
+		Push:        make(chan UserPayload, queueBuffer),
+		Kick:        make(chan MemberPayload, queueBuffer),
 	}
 }
 
+// Online reports whether the user has a real-time connection open, so
+// events nobody would receive need not be built
+func (m *Manager) Online(userID string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.subscribers[userID]) > 0
+}
+
+// OnlineUsers lists the users with a real-time connection open
+func (m *Manager) OnlineUsers() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	users := make([]string, 0, len(m.subscribers))
+	for userID := range m.subscribers {
+		users = append(users, userID)
+	}
+	return users
+}
+
 func (m *Manager) Run() {
 	for {
 		select {
@@ -47,25 +117,86 @@ func (m *Manager) Run() {
 			m.mu.Unlock()
 
 		case client := <-m.Unregister:
+			// A kicked client is already gone and its Send closed
 			m.mu.Lock()
 			convoClients := m.clients[client.ConversationID]
 			for i, c := range convoClients {
 				if c == client {
 					m.clients[client.ConversationID] = append(convoClients[:i], convoClients[i+1:]...)
+					close(client.Send)
 					break
 				}
 			}
+			if len(m.clients[client.ConversationID]) == 0 {
+				delete(m.clients, client.ConversationID)
+			}
 			m.mu.Unlock()
 
 		case payload := <-m.Broadcast:
 			m.mu.RLock()
-			convoClients := m.clients[payload.ConversationID]
+			for _, c := range m.clients[payload.ConversationID] {
+				if slices.Contains(payload.Except, c.UserID) {
+					continue
+				}
+				select {
+				case c.Send <- payload.Data:
+				default:
+					log.Println("dropping message for slow chat client of user", c.UserID)
+				}
+			}
 			m.mu.RUnlock()
-			for _, c := range convoClients {
-				if err := c.Conn.WriteMessage(websocket.TextMessage, payload.Data); err != nil {
-					log.Println("WS write error:", err)
+
+		case sub := <-m.Subscribe:
+			m.mu.Lock()
+			m.subscribers[sub.UserID] = append(m.subscribers[sub.UserID], sub)
+			m.mu.Unlock()
+
+		case sub := <-m.Unsubscribe:
+			m.mu.Lock()
+			userSubs := m.subscribers[sub.UserID]
+			for i, s := range userSubs {
+				if s == sub {
+					userSubs = append(userSubs[:i], userSubs[i+1:]...)
+					close(sub.Send)
+					break
 				}
 			}
+			if len(userSubs) == 0 {
+				delete(m.subscribers, sub.UserID)
+			} else {
+				m.subscribers[sub.UserID] = userSubs
+			}
+			m.mu.Unlock()
+
+		case payload := <-m.Push:
+			m.mu.RLock()
+			for _, s := range m.subscribers[payload.UserID] {
+				select {
+				case s.Send <- payload.Data:
+				default:
+					log.Println("dropping event for slow subscriber of user", payload.UserID)
+				}
+			}
+			m.mu.RUnlock()
+
+		case kick := <-m.Kick:
+			// Closing Send makes the handler close the connection, after
+			// the messages already queued
+			m.mu.Lock()
+			var kept []*Client
+			for _, c := range m.clients[kick.ConversationID] {
+				if c.UserID != kick.UserID {
+					kept = append(kept, c)
+					continue
+				}
+				close(c.Send)
+			}
+			if len(kept) == 0 {
+				delete(m.clients, kick.ConversationID)
+			} else {
+				m.clients[kick.ConversationID] = kept
+			}
+			m.mu.Unlock()
 		}
 	}
 }
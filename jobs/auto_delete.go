@@ -1,16 +1,21 @@
 package jobs
 
 import (
-	"database/sql"
 	"log"
 	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/config"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
 )
 
-func StartAutoDeleteJob(db *sql.DB) {
-	ticker := time.NewTicker(1 * time.Hour)
+const messageCleanupJob = "message_cleanup"
+
+func StartAutoDeleteJob(messages store.MessageStore, cfg config.MessageConfig) {
+	register(messageCleanupJob, cfg.CleanupInterval)
+	ticker := time.NewTicker(cfg.CleanupInterval)
 	go func() {
 		for range ticker.C {
-			if err := deleteOldMessages(db); err != nil {
+			if err := DeleteOldMessages(messages, cfg.Retention); err != nil {
 				log.Println("Error deleting old messages:", err)
 			} else {
 				log.Println("🧹 Old unsaved messages deleted.")
@@ -19,14 +24,15 @@ func StartAutoDeleteJob(db *sql.DB) {
 	}()
 }
 
-func deleteOldMessages(db *sql.DB) error {
-	_, err := db.Exec(`
-		DELETE FROM messages
-		WHERE is_saved = FALSE
-		AND created_at < NOW() - INTERVAL '24 HOURS'`)
+func deleteOldMessages(messages store.MessageStore, retention time.Duration) error {
+	_, err := messages.DeleteUnsavedBefore(time.Now().Add(-retention))
 	return err
 }
 
-func DeleteOldMessages(db *sql.DB) error {
-	return deleteOldMessages(db)
+// DeleteOldMessages runs one message cleanup pass; it is also triggered by
+// /admin/delete-old
+func DeleteOldMessages(messages store.MessageStore, retention time.Duration) error {
+	return run(messageCleanupJob, func() error {
+		return deleteOldMessages(messages, retention)
+	})
 }
@@ -0,0 +1,46 @@
+package jobs
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+)
+
+const counterRepairJob = "counter_repair"
+
+// StartCounterRepairJob recomputes post and user counters from the votes,
+// comments, follows and posts tables, correcting any drift. It also runs once
+// at startup so counters added to an existing database get filled in.
+func StartCounterRepairJob(s *store.Store, interval time.Duration) {
+	register(counterRepairJob, interval)
+	ticker := time.NewTicker(interval)
+	go func() {
+		repair := func() {
+			run(counterRepairJob, func() error {
+				return repairCounters(s)
+			})
+		}
+		repair()
+		for range ticker.C {
+			repair()
+		}
+	}()
+}
+
+func repairCounters(s *store.Store) error {
+	var errs []error
+
+	if _, err := s.Posts.RepairCounters(); err != nil {
+		log.Println("Error repairing post counters:", err)
+		errs = append(errs, err)
+	}
+
+	if _, err := s.Users.RepairCounters(); err != nil {
+		log.Println("Error repairing user counters:", err)
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,152 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/mail"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+	"github.com/google/uuid"
+)
+
+const (
+	digestJob = "notification_digest"
+	// digestPeriod is how often a user gets their daily digest
+	digestPeriod = 24 * time.Hour
+	// maxDigestItems bounds the notifications listed in one email
+	maxDigestItems = 50
+	// digestActors is how many actors each digest line names
+	digestActors = 3
+)
+
+// StartDigestJob emails each user their unread notifications in a single
+// message, through whichever mailer is configured
+func StartDigestJob(s *store.Store, mailer mail.Mailer, publicURL string, interval time.Duration) {
+	register(digestJob, interval)
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			run(digestJob, func() error {
+				return sendDigests(s, mailer, publicURL, time.Now())
+			})
+		}
+	}()
+}
+
+func sendDigests(s *store.Store, mailer mail.Mailer, publicURL string, now time.Time) error {
+	users, err := s.Notifications.EmailRecipients()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	sent := 0
+	for _, userID := range users {
+		ok, err := sendDigest(s, mailer, publicURL, userID, now)
+		if err != nil {
+			log.Println("Error sending notification digest:", err)
+			errs = append(errs, fmt.Errorf("digest for %s: %w", userID, err))
+		}
+		if ok {
+			sent++
+		}
+	}
+	if sent > 0 {
+		log.Printf("📬 Sent %d notification digests.", sent)
+	}
+	return errors.Join(errs...)
+}
+
+// sendDigest emails the user's waiting notifications when their daily
+// digest is due, or sooner when quiet hours held back instant ones. Nothing
+// goes out during quiet hours or to an unverified address.
+func sendDigest(s *store.Store, mailer mail.Mailer, publicURL string, userID uuid.UUID, now time.Time) (bool, error) {
+	settings, err := s.Notifications.Settings(userID)
+	if err != nil {
+		return false, err
+	}
+	if settings.Quiet(now) {
+		return false, nil
+	}
+
+	pending, err := s.Notifications.PendingEmail(userID, maxDigestItems+1)
+	if err != nil {
+		return false, err
+	}
+	held := false
+	for _, p := range pending {
+		held = held || p.Delivery == models.DeliveryInstant
+	}
+	due := settings.LastDigestAt == nil || now.Sub(*settings.LastDigestAt) >= digestPeriod
+	if len(pending) == 0 || !held && !due {
+		return false, nil
+	}
+
+	user, err := s.Users.GetByID(userID)
+	if errors.Is(err, store.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !user.EmailVerified {
+		return false, nil
+	}
+
+	more := len(pending) > maxDigestItems
+	if more {
+		pending = pending[:maxDigestItems]
+	}
+	ids := make([]uuid.UUID, len(pending))
+	for i, p := range pending {
+		ids[i] = p.ID
+	}
+	actors, err := s.Notifications.Actors(userID, ids, digestActors)
+	if err != nil {
+		return false, err
+	}
+
+	var lines []string
+	for _, p := range pending {
+		a := actors[p.ID]
+		if a.Count == 0 {
+			continue
+		}
+		names := make([]string, len(a.Recent))
+		for i, u := range a.Recent {
+			names[i] = u.Username
+		}
+		lines = append(lines, "- "+p.Summary(names, a.Count))
+	}
+	if len(lines) == 0 {
+		return false, nil
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Hi %s,\n\nHere is what happened while you were away:\n\n%s\n", user.Username, strings.Join(lines, "\n"))
+	if more {
+		body.WriteString("…and more.\n")
+	}
+	fmt.Fprintf(&body, "\nSee them all at %s/notifications\n\n"+
+		"Choose which notifications are emailed to you at %s/notifications/preferences\n", publicURL, publicURL)
+
+	subject := "You have a new notification"
+	if len(lines) > 1 {
+		subject = fmt.Sprintf("You have %d new notifications", len(lines))
+	}
+	if err := mailer.Send(mail.Message{To: user.Email, Subject: subject, Body: body.String()}); err != nil {
+		return false, err
+	}
+
+	// Recorded after sending: a failure here repeats a digest rather than
+	// losing one
+	if err := s.Notifications.MarkEmailed(ids, now); err != nil {
+		return true, err
+	}
+	settings.LastDigestAt = &now
+	return true, s.Notifications.SaveSettings(&settings)
+}
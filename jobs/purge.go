@@ -0,0 +1,47 @@
+package jobs
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+)
+
+const purgeJob = "purge"
+
+// StartPurgeJob permanently removes posts, comments and accounts that were
+// deleted longer than gracePeriod ago
+func StartPurgeJob(s *store.Store, gracePeriod, interval time.Duration) {
+	register(purgeJob, interval)
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			run(purgeJob, func() error {
+				return purgeDeleted(s, time.Now().Add(-gracePeriod))
+			})
+		}
+	}()
+}
+
+func purgeDeleted(s *store.Store, cutoff time.Time) error {
+	purges := []struct {
+		name  string
+		purge func(time.Time) (int64, error)
+	}{
+		{"comments", s.Comments.Purge},
+		{"posts", s.Posts.Purge},
+		{"accounts", s.Users.Purge},
+	}
+
+	var errs []error
+	for _, p := range purges {
+		if purged, err := p.purge(cutoff); err != nil {
+			log.Printf("Error purging deleted %s: %v", p.name, err)
+			errs = append(errs, err)
+		} else if purged > 0 {
+			log.Printf("🧹 Purged %d deleted %s.", purged, p.name)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,72 @@
+package jobs
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Status is a snapshot of one background job, served by /admin/jobs
+type Status struct {
+	Name         string     `json:"name"`
+	Interval     string     `json:"interval"`
+	Running      bool       `json:"running"`
+	Runs         int64      `json:"runs"`
+	Failures     int64      `json:"failures"`
+	LastRunAt    *time.Time `json:"last_run_at,omitempty"`
+	LastDuration string     `json:"last_duration,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+}
+
+var registry = struct {
+	sync.Mutex
+	jobs map[string]*Status
+}{jobs: map[string]*Status{}}
+
+// register makes a job visible before its first run
+func register(name string, interval time.Duration) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.jobs[name] = &Status{Name: name, Interval: interval.String()}
+}
+
+// run executes one pass of a job and records its outcome
+func run(name string, fn func() error) error {
+	registry.Lock()
+	status, ok := registry.jobs[name]
+	if !ok {
+		status = &Status{Name: name}
+		registry.jobs[name] = status
+	}
+	status.Running = true
+	registry.Unlock()
+
+	start := time.Now()
+	err := fn()
+
+	registry.Lock()
+	defer registry.Unlock()
+	status.Running = false
+	status.Runs++
+	status.LastRunAt = &start
+	status.LastDuration = time.Since(start).String()
+	status.LastError = ""
+	if err != nil {
+		status.Failures++
+		status.LastError = err.Error()
+	}
+	return err
+}
+
+// Statuses returns every registered job sorted by name
+func Statuses() []Status {
+	registry.Lock()
+	defer registry.Unlock()
+
+	result := make([]Status, 0, len(registry.jobs))
+	for _, s := range registry.jobs {
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
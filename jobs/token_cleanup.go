@@ -0,0 +1,55 @@
+package jobs
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+)
+
+const tokenCleanupJob = "token_cleanup"
+
+// StartTokenCleanupJob deletes sessions, refresh tokens, password reset and
+// email verification tokens that expired or were revoked or redeemed, along
+// with expired mutes
+func StartTokenCleanupJob(s *store.Store, interval time.Duration) {
+	register(tokenCleanupJob, interval)
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			run(tokenCleanupJob, func() error {
+				return cleanupTokens(s)
+			})
+		}
+	}()
+}
+
+func cleanupTokens(s *store.Store) error {
+	now := time.Now()
+	var errs []error
+
+	if deleted, err := s.Sessions.DeleteStale(now); err != nil {
+		log.Println("Error deleting stale sessions:", err)
+		errs = append(errs, err)
+	} else if deleted > 0 {
+		log.Printf("🧹 Deleted %d stale sessions.", deleted)
+	}
+
+	if _, err := s.PasswordReset.DeleteExpired(now); err != nil {
+		log.Println("Error deleting expired reset tokens:", err)
+		errs = append(errs, err)
+	}
+
+	if _, err := s.Verifications.DeleteExpired(now); err != nil {
+		log.Println("Error deleting expired verification tokens:", err)
+		errs = append(errs, err)
+	}
+
+	if _, err := s.Mutes.DeleteExpired(now); err != nil {
+		log.Println("Error deleting expired mutes:", err)
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
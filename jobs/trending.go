@@ -0,0 +1,45 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/trending"
+)
+
+const trendingJob = "trending"
+
+// StartTrendingJob recomputes the trending rankings of every window. It also
+// runs once at startup so /trending has data right away.
+func StartTrendingJob(s *store.Store, interval time.Duration) {
+	register(trendingJob, interval)
+	ticker := time.NewTicker(interval)
+	go func() {
+		refresh := func() {
+			run(trendingJob, func() error {
+				return refreshTrending(s.Trending, time.Now())
+			})
+		}
+		refresh()
+		for range ticker.C {
+			refresh()
+		}
+	}()
+}
+
+func refreshTrending(ts store.TrendingStore, now time.Time) error {
+	var errs []error
+	for window, period := range trending.Windows {
+		signals, err := ts.Signals(now.Add(-period), trending.RecentSince(period, now))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("trending %s: %w", window, err))
+			continue
+		}
+		if err := ts.Replace(window, trending.Rank(window, signals, now)); err != nil {
+			errs = append(errs, fmt.Errorf("trending %s: %w", window, err))
+		}
+	}
+	return errors.Join(errs...)
+}
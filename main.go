@@ -1,7 +1,7 @@
 // @title Social Network API
 // @version 1.0
 // @description This is a microblogging and social networking API.
-// @host localhost:8080
+// @host localhost:3000
 // @BasePath /
 
 package main
@@ -9,125 +9,239 @@ package main
 import (
 	"log"
 	"os"
+	_ "time/tzdata" // quiet hours are read in IANA timezones, even where the host has no zoneinfo
 
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/auth"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/config"
 	db "github.com/am4rknvl/local-micro-blogging-service.git/internal/database"
 	"github.com/am4rknvl/local-micro-blogging-service.git/internal/handlers"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/mail"
 	"github.com/am4rknvl/local-micro-blogging-service.git/internal/middleware"
 	"github.com/am4rknvl/local-micro-blogging-service.git/internal/models"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/search"
+	"github.com/am4rknvl/local-micro-blogging-service.git/internal/store"
 	"github.com/am4rknvl/local-micro-blogging-service.git/internal/ws"
 	"github.com/am4rknvl/local-micro-blogging-service.git/jobs"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/joho/godotenv"
 )
 
-func init() {
-	err := godotenv.Load()
+func main() {
+	// Validate configuration early
+	cfg, err := config.Load(os.Args[1:])
 	if err != nil {
-		log.Println("Warning: No .env file found, reading from environment variables")
+		log.Fatal(err)
 	}
-	// Validate JWT secret early
-	if os.Getenv("JWT_SECRET") == "" {
-		log.Fatal("JWT_SECRET environment variable not set")
+
+	if err := os.MkdirAll(cfg.Server.UploadDir, 0o755); err != nil {
+		log.Fatal("Failed to create upload directory: ", err)
 	}
-}
 
-func main() {
 	app := fiber.New()
-	db.Connect()
 
-	// Auto migrate all models
-	db.DB.AutoMigrate(&models.User{}, &models.Post{})
-	db.DB.AutoMigrate(&models.Follow{})
-	db.DB.AutoMigrate(&models.Vote{})
-	db.DB.AutoMigrate(&models.Comment{})
-	db.DB.AutoMigrate(&models.Message{})
-	db.DB.AutoMigrate(&models.Friend{})
-	db.DB.AutoMigrate(&models.Notification{})
-
-
-	// Get the underlying sql.DB for background jobs
-	sqlDB, err := db.DB.DB()
+	conn, err := db.Open(cfg.Database)
 	if err != nil {
-		log.Fatal("Failed to get underlying sql.DB:", err)
+		log.Fatal("Failed to connect to DB: ", err)
 	}
-	jobs.StartAutoDeleteJob(sqlDB)
 
-	// Public routes
-	app.Post("/signup", handlers.Signup)
-	app.Post("/login", handlers.Login)
-	app.Post("/users/:id/avatar", handlers.UploadAvatar)
-	app.Post("/block", handlers.BlockUser)
-	app.Post("/logout", handlers.Logout)
-	app.Post("/request-reset", handlers.RequestPasswordReset)
-	app.Post("/reset-password", handlers.ResetPassword)
+	s := store.New(conn)
 
-	// Protected routes - posts group with JWT middleware
-	post := app.Group("/posts", middleware.RequireAuth)
+	// Auto migrate all models
+	if err := s.Migrate(); err != nil {
+		log.Fatal("Failed to migrate database: ", err)
+	}
 
-	post.Post("/", handlers.CreatePost)
-	post.Get("/", handlers.GetPosts)
-	post.Get("/:id", handlers.GetPost)
-	post.Put("/:id", handlers.UpdatePost)
-	post.Patch("/:id", handlers.PatchPost)
-	post.Delete("/:id", handlers.DeletePost)
+	if cfg.Admin.Email != "" {
+		promoteAdmin(s, cfg.Admin.Email)
+	}
 
-	// Protected routes - profile group with JWT middleware
-	profile := app.Group("/profile", middleware.RequireAuth)
-	profile.Get("/:id", handlers.GetProfile)
-	profile.Put("/:id", handlers.UpdateProfile)
+	jobs.StartAutoDeleteJob(s.Messages, cfg.Messages)
+	jobs.StartTokenCleanupJob(s, cfg.Jobs.TokenCleanup)
+	jobs.StartPurgeJob(s, cfg.Deletion.GracePeriod, cfg.Jobs.Purge)
+	jobs.StartCounterRepairJob(s, cfg.Jobs.CounterRepair)
+	jobs.StartTrendingJob(s, cfg.Jobs.Trending)
 
-	// Protected routes - follow group with JWT middleware
-	follow := app.Group("/follow", middleware.RequireAuth)
-	follow.Post("/:id", handlers.FollowUser)
-	follow.Delete("/:id", handlers.UnfollowUser)
-	follow.Get("/followers/:id", handlers.GetFollowers)
-	follow.Get("/following/:id", handlers.GetFollowing)
+	authService := auth.NewService(cfg.JWT, s.RefreshTokens, s.Sessions)
+	requireAuth := middleware.RequireAuth(authService)
+	optionalAuth := middleware.OptionalAuth(authService)
+	requireVerified := middleware.RequireVerifiedEmail(cfg.Verification.UnverifiedPolicy, s.Users)
 
-	// Protected routes - vote group with JWT middleware
-	vote := app.Group("/votes", middleware.RequireAuth)
-	vote.Post("/:id", handlers.VotePost)
-	vote.Get("/:id/score", handlers.GetVoteScore)
+	mailer, err := mail.New(cfg.Mail)
+	if err != nil {
+		log.Fatal("Failed to set up mailer: ", err)
+	}
+	jobs.StartDigestJob(s, mailer, cfg.Server.PublicURL, cfg.Jobs.Digest)
 
-	// Protected routes - comment group with JWT middleware
-	comment := app.Group("/posts/:id/comments", middleware.RequireAuth)
+	searcher, err := search.New(cfg.Search, cfg.Database.Driver, conn, s.Search)
+	if err != nil {
+		log.Fatal("Failed to set up search: ", err)
+	}
 
-	comment.Post("/", handlers.CreateComment)
-	comment.Get("/", handlers.GetComments)
-	comment.Patch("/:commentId", handlers.UpdateComment)
-	comment.Delete("/:commentId", handlers.DeleteComment)
+	h := handlers.New(s, cfg, authService, mailer, searcher)
 
-	// Protected routes - messages group with JWT middleware
-	messages := app.Group("/conversations/:id/messages", middleware.RequireAuth)
-	messages.Post("/", handlers.SendMessage)
-	messages.Get("/", handlers.GetMessages)
+	// Public routes
+	app.Post("/signup", h.Signup)
+	app.Post("/login", h.Login)
+	app.Post("/token/refresh", h.RefreshToken)
+	app.Post("/logout", requireAuth, h.Logout)
+	app.Post("/request-reset", h.RequestPasswordReset)
+	app.Post("/reset-password", h.ResetPassword)
+	app.Get("/verify-email", h.VerifyEmail)
+	app.Post("/verify-email", h.VerifyEmail)
+	app.Post("/verify-email/resend", requireAuth, h.ResendVerification)
+	app.Post("/account/restore", h.RestoreAccount)
+
+	// Unverified accounts keep only what they need to sort out their account:
+	// /users/me, sessions, logout and resending the verification email. Every
+	// other authenticated route runs requireVerified.
+
+	// Protected routes - sessions group with JWT middleware
+	sessions := app.Group("/sessions", requireAuth)
+	sessions.Get("/", h.ListSessions)
+	sessions.Delete("/", h.RevokeAllSessions)
+	sessions.Delete("/:id", h.RevokeSession)
+
+	// Protected routes - users group with JWT middleware
+	users := app.Group("/users", requireAuth)
+	users.Get("/me", h.GetCurrentUser)
+	users.Patch("/:id", requireVerified, h.UpdateProfile)
+	users.Delete("/:id", requireVerified, h.DeleteUser)
+	users.Put("/:id/password", requireVerified, h.UpdatePassword)
+	users.Post("/:id/avatar", requireVerified, h.UploadAvatar)
+
+	// Protected routes - blocks group with JWT middleware
+	blocks := app.Group("/blocks", requireAuth, requireVerified)
+	blocks.Get("/", h.ListBlocks)
+	blocks.Post("/:id", h.BlockUser)
+	blocks.Delete("/:id", h.UnblockUser)
+
+	// Protected routes - mutes group with JWT middleware
+	mutes := app.Group("/mutes", requireAuth, requireVerified)
+	mutes.Get("/", h.ListMutes)
+	mutes.Post("/", h.CreateMute)
+	mutes.Delete("/:id", h.DeleteMute)
 
-	app.Post("/admin/delete-old", func(c *fiber.Ctx) error {
-		if err := jobs.DeleteOldMessages(sqlDB); err != nil {
-			return c.Status(500).SendString("Failed to delete old messages")
-		}
-		return c.SendString("Old unsaved messages deleted manually")
-	})
+	// Protected routes - posts group with JWT middleware
+	post := app.Group("/posts", requireAuth, requireVerified)
 
-	app.Patch("/messages/:id/save", handlers.SaveMessage(sqlDB))
+	post.Post("/", h.CreatePost)
+	post.Get("/", h.GetPosts)
+	post.Get("/:id", h.GetPost)
+	post.Get("/:id/revisions", h.GetPostRevisions)
+	post.Get("/:id/revisions/diff", h.GetPostRevisionDiff)
+	post.Put("/:id", h.UpdatePost)
+	post.Patch("/:id", h.PatchPost)
+	post.Delete("/:id", h.DeletePost)
+	post.Post("/:id/restore", h.RestorePost)
 
-	app.Get("/ws/chat/:conversationID", handlers.WebSocketHandler())
+	app.Get("/timeline", requireAuth, requireVerified, h.GetTimeline)
 
-	app.Post("/friend-request", handlers.SendFriendRequest)
-	app.Post("/respond-request", handlers.RespondToFriendRequest)
-	app.Get("/search", handlers.SearchUsers)
-	app.Get("/trending", handlers.TrendingPosts)
+	// Protected routes - profile group with JWT middleware
+	profile := app.Group("/profile", requireAuth, requireVerified)
+	profile.Get("/:id", h.GetProfile)
+	profile.Put("/:id", h.UpdateProfile)
 
-	app.Get("/friend-requests", handlers.GetFriendRequests)
-	app.Get("/friends", handlers.GetFriendTree)
-	app.Get("/friend-tree", handlers.GetFriendTree)
+	// Protected routes - follow group with JWT middleware
+	follow := app.Group("/follow", requireAuth, requireVerified)
+	follow.Post("/:id", h.FollowUser)
+	follow.Delete("/:id", h.UnfollowUser)
+	follow.Get("/followers/:id", h.GetFollowers)
+	follow.Get("/following/:id", h.GetFollowing)
 
+	// Protected routes - vote group with JWT middleware
+	vote := app.Group("/votes", requireAuth, requireVerified)
+	vote.Post("/:id", h.VotePost)
+	vote.Get("/:id/score", h.GetVoteScore)
 
+	// Protected routes - comment group with JWT middleware
+	comment := app.Group("/posts/:id/comments", requireAuth, requireVerified)
+
+	comment.Post("/", h.CreateComment)
+	comment.Get("/", h.GetComments)
+	comment.Post("/:commentId/replies", h.CreateReply)
+	comment.Get("/:commentId/replies", h.GetReplies)
+	comment.Post("/:commentId/vote", h.VoteComment)
+	comment.Patch("/:commentId", h.UpdateComment)
+	comment.Get("/:commentId/revisions", h.GetCommentRevisions)
+	comment.Delete("/:commentId", h.DeleteComment)
+	comment.Post("/:commentId/restore", h.RestoreComment)
+
+	// Protected routes - conversations, and messages for their members only
+	conversations := app.Group("/conversations", requireAuth, requireVerified)
+	conversations.Post("/", h.CreateConversation)
+	conversations.Get("/", h.GetConversations)
+	conversations.Post("/join/:code", h.JoinGroup)
+
+	// Groups, managed by their owner and admins
+	member := h.RequireConversationMember("id")
+	conversations.Get("/:id", member, h.GetConversation)
+	conversations.Patch("/:id", member, h.UpdateGroup)
+	conversations.Post("/:id/members", member, h.AddGroupMembers)
+	conversations.Delete("/:id/members/:userId", member, h.RemoveGroupMember)
+	conversations.Put("/:id/members/:userId/role", member, h.SetGroupRole)
+	conversations.Post("/:id/leave", member, h.LeaveGroup)
+	conversations.Post("/:id/invites", member, h.CreateGroupInvite)
+	conversations.Get("/:id/invites", member, h.GetGroupInvites)
+	conversations.Delete("/:id/invites/:inviteId", member, h.RevokeGroupInvite)
+
+	messages := app.Group("/conversations/:id/messages", requireAuth, requireVerified, h.RequireConversationMember("id"))
+	messages.Post("/", h.SendMessage)
+	messages.Get("/", h.GetMessages)
+
+	// Protected routes - the caller's notifications
+	notifications := app.Group("/notifications", requireAuth, requireVerified)
+	notifications.Get("/", h.GetNotifications)
+	notifications.Get("/stream", h.NotificationStream)
+	notifications.Get("/preferences", h.GetNotificationPreferences)
+	notifications.Patch("/preferences", h.UpdateNotificationPreferences)
+	notifications.Post("/read-all", h.MarkAllNotificationsRead)
+	notifications.Post("/:id/read", h.MarkNotificationRead)
+
+	// Staff routes - moderators and up, some admin only
+	requireAdmin := middleware.RequireRole(s.Users, models.RoleAdmin)
+	admin := app.Group("/admin", requireAuth, requireVerified, middleware.RequireRole(s.Users, models.RoleModerator))
+	admin.Get("/users", h.AdminListUsers)
+	admin.Post("/users/:id/suspend", h.AdminSuspendUser)
+	admin.Post("/users/:id/unsuspend", h.AdminUnsuspendUser)
+	admin.Put("/users/:id/role", requireAdmin, h.AdminSetRole)
+	admin.Delete("/users/:id", requireAdmin, h.DeleteUser)
+	admin.Post("/users/:id/restore", requireAdmin, h.AdminRestoreUser)
+	admin.Get("/jobs", requireAdmin, h.AdminJobStatus)
+	admin.Post("/delete-old", requireAdmin, h.AdminDeleteOldMessages)
+
+	app.Patch("/messages/:id/save", requireAuth, requireVerified, h.SaveMessage)
+
+	app.Get("/ws/chat/:conversationID", requireAuth, requireVerified, h.RequireConversationMember("conversationID"), h.WebSocketHandler())
+	app.Get("/ws/notifications", requireAuth, requireVerified, h.NotificationSocket())
+
+	app.Post("/friend-request", requireAuth, requireVerified, h.SendFriendRequest)
+	app.Post("/respond-request", requireAuth, requireVerified, h.RespondToFriendRequest)
+	app.Get("/search", requireAuth, requireVerified, h.Search)
+	app.Get("/trending", optionalAuth, h.TrendingPosts)
+
+	app.Get("/friend-requests", requireAuth, requireVerified, h.GetFriendRequests)
+	app.Get("/friends", requireAuth, requireVerified, h.GetFriendTree)
+	app.Get("/friend-tree", requireAuth, requireVerified, h.GetFriendTree)
 
 	// Start WebSocket manager
 	go ws.ManagerInstance.Run()
 
-	jobs.StartMessageCleanupJob()
 	// Start server
-	log.Fatal(app.Listen(":3000"))
+	log.Fatal(app.Listen(cfg.Server.ListenAddr))
+}
+
+// promoteAdmin gives the configured bootstrap account the admin role
+func promoteAdmin(s *store.Store, email string) {
+	user, err := s.Users.GetByEmail(email)
+	if err != nil {
+		log.Printf("Admin account %s not found; sign up and restart to promote it", email)
+		return
+	}
+	if user.Role == models.RoleAdmin {
+		return
+	}
+	if err := s.Users.Updates(user.ID, map[string]interface{}{"role": models.RoleAdmin}); err != nil {
+		log.Fatal("Failed to promote admin: ", err)
+	}
+	log.Printf("Promoted %s to admin", email)
 }